@@ -0,0 +1,136 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/vault"
+)
+
+// DefaultAccount is the account stored at the top level of the config file.
+const DefaultAccount = "default"
+
+type Account struct {
+	Name   string
+	Config *config.Config
+	Vault  *vault.Vault
+	// cancelled when the account is removed, ends its background loops
+	Context context.Context
+	cancel  context.CancelFunc
+}
+
+// Factory creates and starts the account for a new profile.
+type Factory func(name string) (*Account, error)
+
+var accounts = map[string]*Account{}
+var factory Factory
+var mu sync.Mutex
+
+func NewAccount(ctx context.Context, name string, cfg *config.Config, vault *vault.Vault) *Account {
+	accountCtx, cancel := context.WithCancel(ctx)
+	return &Account{
+		Name:    name,
+		Config:  cfg,
+		Vault:   vault,
+		Context: accountCtx,
+		cancel:  cancel,
+	}
+}
+
+func SetFactory(accountFactory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	factory = accountFactory
+}
+
+func Register(account *Account) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	accounts[account.Name] = account
+}
+
+// Get returns the account with the given name, or the default account for an empty name.
+func Get(name string) (*Account, bool) {
+	if name == "" {
+		name = DefaultAccount
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	account, ok := accounts[name]
+	return account, ok
+}
+
+// All returns the default account first, followed by the other accounts sorted by name.
+func All() []*Account {
+	mu.Lock()
+	defer mu.Unlock()
+
+	result := make([]*Account, 0, len(accounts))
+	for _, account := range accounts {
+		result = append(result, account)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name == DefaultAccount || result[j].Name == DefaultAccount {
+			return result[i].Name == DefaultAccount
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func Count() int {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return len(accounts)
+}
+
+func Add(name string) (*Account, error) {
+	mu.Lock()
+	accountFactory := factory
+	_, exists := accounts[name]
+	mu.Unlock()
+
+	if name == DefaultAccount || exists {
+		return nil, errors.New("account already exists")
+	}
+	if accountFactory == nil {
+		return nil, errors.New("accounts can not be added")
+	}
+
+	account, err := accountFactory(name)
+	if err != nil {
+		return nil, err
+	}
+	Register(account)
+	return account, nil
+}
+
+// Remove locks the account, stops its background loops and deletes its profile from the config file.
+func Remove(name string) error {
+	if name == DefaultAccount || name == "" {
+		return errors.New("the default account can not be removed")
+	}
+
+	mu.Lock()
+	account, ok := accounts[name]
+	defaultAccount := accounts[DefaultAccount]
+	delete(accounts, name)
+	mu.Unlock()
+	if !ok {
+		return errors.New("account not found")
+	}
+
+	account.cancel()
+	account.Config.Lock()
+	account.Vault.Clear()
+	account.Vault.Keyring.Lock()
+	return defaultAccount.Config.RemoveProfile(name)
+}
@@ -0,0 +1,74 @@
+package actions
+
+import (
+	"github.com/quexten/goldwarden/cli/agent/accounts"
+	"github.com/quexten/goldwarden/cli/agent/bitwarden"
+	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/sockets"
+	"github.com/quexten/goldwarden/cli/agent/systemauth"
+	"github.com/quexten/goldwarden/cli/agent/vault"
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+)
+
+func handleListAccounts(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	result := make([]messages.Account, 0)
+	for _, account := range accounts.All() {
+		result = append(result, messages.Account{
+			Name:     account.Name,
+			LoggedIn: account.Config.IsLoggedIn(),
+			Locked:   account.Config.IsLocked(),
+			ApiUrl:   account.Config.ConfigFile.ApiUrl,
+		})
+	}
+
+	return messages.IPCMessageFromPayload(messages.ListAccountsResponse{
+		Accounts: result,
+	})
+}
+
+func handleAddAccount(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(request).(messages.AddAccountRequest)
+	if _, err := accounts.Add(req.Name); err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	return messages.IPCMessageFromPayload(messages.ActionResponse{
+		Success: true,
+		Message: "account " + req.Name + " added",
+	})
+}
+
+func handleRemoveAccount(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(request).(messages.RemoveAccountRequest)
+	account, ok := accounts.Get(req.Name)
+	if !ok {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "account not found",
+			Code:    messages.ErrorCodeNotFound,
+		})
+	}
+
+	err = accounts.Remove(req.Name)
+	bitwarden.ForgetTokenManager(account.Config)
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	return messages.IPCMessageFromPayload(messages.ActionResponse{
+		Success: true,
+		Message: "account " + req.Name + " removed",
+	})
+}
+
+func init() {
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.ListAccountsRequest{}), handleListAccounts)
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.AddAccountRequest{}), ensureBiometricsAuthorized(systemauth.AccessVault, handleAddAccount))
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.RemoveAccountRequest{}), ensureBiometricsAuthorized(systemauth.AccessVault, handleRemoveAccount))
+}
@@ -2,12 +2,17 @@ package actions
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/quexten/goldwarden/cli/agent/audit"
 	"github.com/quexten/goldwarden/cli/agent/bitwarden"
 	"github.com/quexten/goldwarden/cli/agent/bitwarden/crypto"
+	"github.com/quexten/goldwarden/cli/agent/bitwarden/models"
 	"github.com/quexten/goldwarden/cli/agent/config"
 	"github.com/quexten/goldwarden/cli/agent/sockets"
 	"github.com/quexten/goldwarden/cli/agent/systemauth"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/pinentry"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/policy"
 	"github.com/quexten/goldwarden/cli/agent/vault"
 	"github.com/quexten/goldwarden/cli/ipc/messages"
 	"github.com/quexten/goldwarden/cli/logging"
@@ -36,6 +41,19 @@ func (registry *ActionsRegistry) Get(messageType messages.IPCMessageType) (Actio
 	return action, ok
 }
 
+func decryptOrEmpty(encString crypto.EncString, key crypto.SymmetricEncryptionKey) string {
+	if encString.IsNull() {
+		return ""
+	}
+
+	decrypted, err := crypto.DecryptWith(encString, key)
+	if err != nil {
+		actionsLog.Warn("Could not decrypt field: %s", err.Error())
+		return ""
+	}
+	return string(decrypted)
+}
+
 func ensureIsLoggedIn(action Action) Action {
 	return func(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (messages.IPCMessage, error) {
 		if hash, err := cfg.GetMasterPasswordHash(); err != nil || len(hash) == 0 {
@@ -43,6 +61,7 @@ func ensureIsLoggedIn(action Action) Action {
 			return messages.IPCMessageFromPayload(messages.ActionResponse{
 				Success: false,
 				Message: "Not logged in",
+				Code:    messages.ErrorCodeNotLoggedIn,
 			})
 		}
 
@@ -54,9 +73,8 @@ func sync(ctx context.Context, vault *vault.Vault, cfg *config.Config) bool {
 	token, err := cfg.GetToken()
 	if err == nil {
 		if token.AccessToken != "" {
-			refreshed := bitwarden.RefreshToken(ctx, cfg)
-			if !refreshed {
-				return false
+			if _, err := bitwarden.TokenManagerFor(cfg).GetValidToken(ctx); err != nil {
+				actionsLog.Warn("Could not refresh token, the vault cache will be used if the server is unreachable")
 			}
 
 			userSymmetricKey, err := cfg.GetUserSymmetricKey()
@@ -74,7 +92,7 @@ func sync(ctx context.Context, vault *vault.Vault, cfg *config.Config) bool {
 				return false
 			}
 
-			err = bitwarden.DoFullSync(context.WithValue(ctx, bitwarden.AuthToken{}, token.AccessToken), vault, cfg, &protectedUserSymmetricKey, true)
+			err = bitwarden.DoFullSync(bitwarden.WithAuthentication(ctx, cfg), vault, cfg, &protectedUserSymmetricKey, true)
 			if err != nil {
 				return false
 			}
@@ -94,11 +112,13 @@ func ensureIsNotLocked(action Action) Action {
 					return messages.IPCMessageFromPayload(messages.ActionResponse{
 						Success: false,
 						Message: err.Error(),
+						Code:    messages.ErrorCodeLocked,
 					})
 				} else {
 					return messages.IPCMessageFromPayload(messages.ActionResponse{
 						Success: false,
 						Message: "Could not sync vault",
+						Code:    messages.ErrorCodeLocked,
 					})
 				}
 			}
@@ -110,12 +130,53 @@ func ensureIsNotLocked(action Action) Action {
 	}
 }
 
+// approve consults the policy and falls back to asking the user
+func approve(ctx *sockets.CallingContext, cfg *config.Config, request policy.Request, title string, message string) bool {
+	approved, _ := approveWithMethod(ctx, cfg, request, title, message)
+	return approved
+}
+
+func approveWithMethod(ctx *sockets.CallingContext, cfg *config.Config, request policy.Request, title string, message string) (bool, string) {
+	if approved, method, decided := systemauth.CheckPolicy(request, *ctx, cfg, title, message); decided {
+		return approved, method
+	}
+
+	approved, err := pinentry.GetApproval(title, message)
+	return err == nil && approved, "prompt"
+}
+
+func cipherPolicyRequest(action policy.Action, ctx *sockets.CallingContext, vault *vault.Vault, cipher models.Cipher, name string) policy.Request {
+	request := policy.NewRequest(action, *ctx)
+	request.Cipher = name
+	request.Folder = vault.GetFolderName(cipher)
+	return request
+}
+
 func ensureBiometricsAuthorized(approvalType systemauth.SessionType, action Action) Action {
 	return func(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (messages.IPCMessage, error) {
+		policyAction := policy.ActionAccessVault
+		if approvalType == systemauth.SSHKey {
+			policyAction = policy.ActionUseSSHKey
+		}
+		message := fmt.Sprintf("Do you want to authorize %s>%s>%s to %s?", ctx.GrandParentProcessName, ctx.ParentProcessName, ctx.ProcessName, policyAction)
+		if approved, method, decided := systemauth.CheckPolicy(policy.NewRequest(policyAction, *ctx), *ctx, cfg, "Goldwarden authorization", message); decided {
+			if !approved {
+				audit.Log(audit.ActionAuthorize, *ctx, "", string(policyAction), false, method)
+				return messages.IPCMessageFromPayload(messages.ActionResponse{
+					Success: false,
+					Message: "not approved",
+					Code:    messages.ErrorCodeNotApproved,
+				})
+			}
+			return action(request, cfg, vault, ctx)
+		}
+
 		if permission, err := systemauth.GetPermission(approvalType, *ctx, cfg); err != nil || !permission {
+			audit.Log(audit.ActionAuthorize, *ctx, "", string(policyAction), false, "biometrics")
 			return messages.IPCMessageFromPayload(messages.ActionResponse{
 				Success: false,
 				Message: "Polkit authorization failed required",
+				Code:    messages.ErrorCodeNotApproved,
 			})
 		}
 
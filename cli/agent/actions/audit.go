@@ -0,0 +1,85 @@
+package actions
+
+import (
+	"errors"
+	"os"
+
+	"github.com/quexten/goldwarden/cli/agent/audit"
+	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/sockets"
+	"github.com/quexten/goldwarden/cli/agent/systemauth"
+	"github.com/quexten/goldwarden/cli/agent/vault"
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+)
+
+func handleListAuditLog(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(request).(messages.ListAuditLogRequest)
+
+	records, err := audit.Read(audit.Path())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "could not read audit log: " + err.Error(),
+		})
+	}
+
+	result := make([]messages.AuditRecord, 0)
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+		if req.Action != "" && record.Action != req.Action {
+			continue
+		}
+		if req.Limit > 0 && len(result) >= req.Limit {
+			break
+		}
+
+		result = append(result, messages.AuditRecord{
+			Sequence:               record.Sequence,
+			Time:                   record.Time.Unix(),
+			Action:                 record.Action,
+			CipherID:               record.CipherID,
+			Detail:                 record.Detail,
+			Decision:               record.Decision,
+			Method:                 record.Method,
+			UserName:               record.UserName,
+			ProcessName:            record.ProcessName,
+			ProcessPath:            record.ProcessPath,
+			ParentProcessName:      record.ParentProcessName,
+			GrandParentProcessName: record.GrandParentProcessName,
+			ProcessPid:             record.ProcessPid,
+			Hash:                   record.Hash,
+		})
+	}
+
+	return messages.IPCMessageFromPayload(messages.ListAuditLogResponse{
+		Records: result,
+	})
+}
+
+func handleVerifyAuditLog(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	key, err := cfg.AuditKey()
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "could not get audit key: " + err.Error(),
+		})
+	}
+	numberOfRecords, err := audit.Verify(audit.Path(), key)
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.VerifyAuditLogResponse{
+			Valid:   false,
+			Records: numberOfRecords,
+			Message: err.Error(),
+		})
+	}
+
+	return messages.IPCMessageFromPayload(messages.VerifyAuditLogResponse{
+		Valid:   true,
+		Records: numberOfRecords,
+	})
+}
+
+func init() {
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.ListAuditLogRequest{}), ensureEverything(systemauth.AccessVault, handleListAuditLog))
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.VerifyAuditLogRequest{}), ensureEverything(systemauth.AccessVault, handleVerifyAuditLog))
+}
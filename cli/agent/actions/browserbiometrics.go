@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/quexten/goldwarden/cli/agent/audit"
 	"github.com/quexten/goldwarden/cli/agent/config"
 	"github.com/quexten/goldwarden/cli/agent/notify"
 	"github.com/quexten/goldwarden/cli/agent/sockets"
 	"github.com/quexten/goldwarden/cli/agent/systemauth/biometrics"
 	"github.com/quexten/goldwarden/cli/agent/systemauth/pinentry"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/policy"
 	"github.com/quexten/goldwarden/cli/agent/vault"
 
 	"github.com/quexten/goldwarden/cli/ipc/messages"
@@ -19,6 +21,7 @@ import (
 func handleGetBiometricsKey(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
 	actionsLog.Info("Browser Biometrics: Key requested, verifying biometrics...")
 	authenticated := false
+	method := ""
 
 	if cfg.IsLocked() {
 		actionsLog.Info("Browser Biometrics: Vault is locked, asking for pin...")
@@ -35,12 +38,15 @@ func handleGetBiometricsKey(request messages.IPCMessage, cfg *config.Config, vau
 		}
 		actionsLog.Info("Browser Biometrics: Vault unlocked")
 		authenticated = true
+		method = "unlock"
 	} else {
 		authenticated = biometrics.CheckBiometrics(biometrics.BrowserBiometrics)
+		method = "biometrics"
 		if !authenticated {
 			// todo, skip when explicitly denied instead of error
 			actionsLog.Info("Browser Biometrics: Biometrics not approved, asking for pin...")
 			pin, err := pinentry.GetPassword("Goldwarden", "Enter your pin to unlock your vault")
+			method = "pin"
 			if err == nil {
 				authenticated = cfg.VerifyPin(pin)
 				if !authenticated {
@@ -55,9 +61,11 @@ func handleGetBiometricsKey(request messages.IPCMessage, cfg *config.Config, vau
 	}
 
 	if !authenticated {
+		audit.Log(audit.ActionBrowserBiometrics, *ctx, "", "", false, method)
 		response, err = messages.IPCMessageFromPayload(messages.ActionResponse{
 			Success: false,
 			Message: "not approved",
+			Code:    messages.ErrorCodeNotApproved,
 		})
 		if err != nil {
 			return messages.IPCMessage{}, err
@@ -66,10 +74,13 @@ func handleGetBiometricsKey(request messages.IPCMessage, cfg *config.Config, vau
 	}
 
 	actionsLog.Info("Browser Biometrics: Biometrics verified, asking for approval...")
-	if approved, err := pinentry.GetApproval("Approve Credential Access", fmt.Sprintf("%s on %s>%s>%s is trying to access your vault encryption key for browser biometric unlock.", ctx.UserName, ctx.GrandParentProcessName, ctx.ParentProcessName, ctx.ProcessName)); err != nil || !approved {
+	approved, approvalMethod := approveWithMethod(ctx, cfg, policy.NewRequest(policy.ActionBrowserBiometrics, *ctx), "Approve Credential Access", fmt.Sprintf("%s on %s>%s>%s is trying to access your vault encryption key for browser biometric unlock.", ctx.UserName, ctx.GrandParentProcessName, ctx.ParentProcessName, ctx.ProcessName))
+	audit.Log(audit.ActionBrowserBiometrics, *ctx, "", "", approved, method+", "+approvalMethod)
+	if !approved {
 		response, err = messages.IPCMessageFromPayload(messages.ActionResponse{
 			Success: false,
 			Message: "not approved",
+			Code:    messages.ErrorCodeNotApproved,
 		})
 		actionsLog.Info("Browser Biometrics: Biometrics not approved %v", err)
 		if err != nil {
@@ -0,0 +1,120 @@
+package actions
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/quexten/goldwarden/cli/agent/bitwarden/crypto"
+	"github.com/quexten/goldwarden/cli/agent/bitwarden/models"
+	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/sockets"
+	"github.com/quexten/goldwarden/cli/agent/systemauth"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/policy"
+	"github.com/quexten/goldwarden/cli/agent/vault"
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+)
+
+func decryptCard(card models.Cipher, key crypto.SymmetricEncryptionKey) messages.DecryptedCardCipher {
+	decryptedCard := messages.DecryptedCardCipher{
+		Name: decryptOrEmpty(card.Name, key),
+		UUID: card.ID.String(),
+	}
+	if card.OrganizationID != nil {
+		decryptedCard.OrganizationID = card.OrganizationID.String()
+	}
+	if card.Notes != nil {
+		decryptedCard.Notes = decryptOrEmpty(*card.Notes, key)
+	}
+	if card.Card != nil {
+		decryptedCard.CardholderName = decryptOrEmpty(card.Card.CardholderName, key)
+		decryptedCard.Brand = decryptOrEmpty(card.Card.Brand, key)
+		decryptedCard.Number = decryptOrEmpty(card.Card.Number, key)
+		decryptedCard.ExpMonth = decryptOrEmpty(card.Card.ExpMonth, key)
+		decryptedCard.ExpYear = decryptOrEmpty(card.Card.ExpYear, key)
+		decryptedCard.Code = decryptOrEmpty(card.Card.Code, key)
+	}
+	return decryptedCard
+}
+
+func maskCardNumber(number string) string {
+	if len(number) <= 4 {
+		return number
+	}
+	return "*" + number[len(number)-4:]
+}
+
+func handleGetCard(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(request).(messages.GetCardRequest)
+	card, err := vault.GetCardByFilter(req.UUID, req.OrgId, req.Name)
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "card not found",
+			Code:    messages.ErrorCodeNotFound,
+		})
+	}
+
+	cipherKey, err := card.GetKeyForCipher(*vault.Keyring)
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "could not get cipher key",
+		})
+	}
+
+	decryptedCard := decryptCard(card, cipherKey)
+	if !approve(ctx, cfg, cipherPolicyRequest(policy.ActionGetCard, ctx, vault, card, decryptedCard.Name), "Approve Credential Access", fmt.Sprintf("%s on %s>%s>%s is trying to access the card %s", ctx.UserName, ctx.GrandParentProcessName, ctx.ParentProcessName, ctx.ProcessName, decryptedCard.Name)) {
+		response, err = messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "not approved",
+			Code:    messages.ErrorCodeNotApproved,
+		})
+		if err != nil {
+			return messages.IPCMessage{}, err
+		}
+		return response, nil
+	}
+
+	return messages.IPCMessageFromPayload(messages.GetCardResponse{
+		Found:  true,
+		Result: decryptedCard,
+	})
+}
+
+func handleListCards(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	cards := vault.GetCards()
+	decryptedCards := make([]messages.DecryptedCardCipher, 0)
+	for _, card := range cards {
+		key, err := card.GetKeyForCipher(*vault.Keyring)
+		if err != nil {
+			actionsLog.Warn("Could not decrypt card:" + err.Error())
+			continue
+		}
+
+		// only expose non-sensitive fields when listing, use GetCardRequest for the full card
+		decryptedCard := decryptCard(card, key)
+		decryptedCards = append(decryptedCards, messages.DecryptedCardCipher{
+			Name:           decryptedCard.Name,
+			UUID:           decryptedCard.UUID,
+			OrganizationID: decryptedCard.OrganizationID,
+			CardholderName: decryptedCard.CardholderName,
+			Brand:          decryptedCard.Brand,
+			Number:         maskCardNumber(decryptedCard.Number),
+			ExpMonth:       decryptedCard.ExpMonth,
+			ExpYear:        decryptedCard.ExpYear,
+		})
+
+		// prevent deadlock from enclaves
+		debug.FreeOSMemory()
+	}
+
+	return messages.IPCMessageFromPayload(messages.GetCardsResponse{
+		Found:  len(decryptedCards) > 0,
+		Result: decryptedCards,
+	})
+}
+
+func init() {
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.GetCardRequest{}), ensureEverything(systemauth.AccessVault, handleGetCard))
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.ListCardsRequest{}), ensureEverything(systemauth.AccessVault, handleListCards))
+}
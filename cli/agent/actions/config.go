@@ -1,12 +1,12 @@
 package actions
 
 import (
-	"encoding/json"
-	"io"
-	"net/http"
+	"context"
 
+	"github.com/quexten/goldwarden/cli/agent/bitwarden"
 	"github.com/quexten/goldwarden/cli/agent/config"
 	"github.com/quexten/goldwarden/cli/agent/sockets"
+	"github.com/quexten/goldwarden/cli/agent/systemauth"
 	"github.com/quexten/goldwarden/cli/agent/vault"
 	"github.com/quexten/goldwarden/cli/ipc/messages"
 )
@@ -75,39 +75,10 @@ func handleSetVaultURL(request messages.IPCMessage, cfg *config.Config, vault *v
 	})
 }
 
-type ConfigResponse struct {
-	Version     string `json:"version"`
-	GitHash     string `json:"gitHash"`
-	Environment struct {
-		Vault         string `json:"vault"`
-		Api           string `json:"api"`
-		Identity      string `json:"identity"`
-		Notifications string `json:"notifications"`
-	}
-}
-
 func handleSetURLsAutomatically(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
 	autoconfigBaseURL := messages.ParsePayload(request).(messages.SetURLsAutomaticallyRequest).Value
 
-	// make http request
-	resp, err := http.Get(autoconfigBaseURL + "/api/config")
-	if err != nil {
-		return messages.IPCMessageFromPayload(messages.ActionResponse{
-			Success: false,
-			Message: err.Error(),
-		})
-	}
-
-	// parse response
-	var configResponse ConfigResponse
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return messages.IPCMessageFromPayload(messages.ActionResponse{
-			Success: false,
-			Message: err.Error(),
-		})
-	}
-	err = json.Unmarshal(body, &configResponse)
+	configResponse, err := bitwarden.GetServerConfig(context.Background(), autoconfigBaseURL)
 	if err != nil {
 		return messages.IPCMessageFromPayload(messages.ActionResponse{
 			Success: false,
@@ -196,6 +167,67 @@ func handleGetRuntimeConfig(request messages.IPCMessage, cfg *config.Config, vau
 	})
 }
 
+func handleGetHTTPSettings(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	defaultCfg, ok := defaultAccountConfig()
+	if !ok {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "default account not found",
+		})
+	}
+
+	settings := defaultCfg.HTTPSettings()
+	return messages.IPCMessageFromPayload(messages.GetHTTPSettingsResponse{
+		Settings: messages.HTTPSettings{
+			CABundle:          settings.CABundle,
+			ClientCertificate: settings.ClientCertificate,
+			ClientKey:         settings.ClientKey,
+			Proxy:             settings.Proxy,
+			Retries:           settings.Retries,
+		},
+	})
+}
+
+func handleSetHTTPSettings(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(request).(messages.SetHTTPSettingsRequest).Settings
+	defaultCfg, ok := defaultAccountConfig()
+	if !ok {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "default account not found",
+		})
+	}
+
+	settings := config.HTTPSettings{
+		CABundle:          req.CABundle,
+		ClientCertificate: req.ClientCertificate,
+		ClientKey:         req.ClientKey,
+		Proxy:             req.Proxy,
+		Retries:           req.Retries,
+	}
+	// apply first, so that unreadable certificates are not persisted
+	previousSettings := defaultCfg.HTTPSettings()
+	err = bitwarden.ConfigureHTTPClient(settings)
+	if err == nil {
+		err = defaultCfg.SetHTTPSettings(settings)
+		if err != nil {
+			if rollbackErr := bitwarden.ConfigureHTTPClient(previousSettings); rollbackErr != nil {
+				actionsLog.Warn("Could not restore http settings: %s", rollbackErr.Error())
+			}
+		}
+	}
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	return messages.IPCMessageFromPayload(messages.ActionResponse{
+		Success: true,
+	})
+}
+
 func init() {
 	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.SetIdentityURLRequest{}), handleSetIdentity)
 	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.SetApiURLRequest{}), handleSetApiURL)
@@ -206,4 +238,6 @@ func init() {
 	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.GetRuntimeConfigRequest{}), handleGetRuntimeConfig)
 	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.SetClientIDRequest{}), handleSetClientID)
 	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.SetClientSecretRequest{}), handleSetClientSecret)
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.GetHTTPSettingsRequest{}), handleGetHTTPSettings)
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.SetHTTPSettingsRequest{}), ensureBiometricsAuthorized(systemauth.AccessVault, handleSetHTTPSettings))
 }
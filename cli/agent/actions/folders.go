@@ -0,0 +1,42 @@
+package actions
+
+import (
+	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/sockets"
+	"github.com/quexten/goldwarden/cli/agent/vault"
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+)
+
+func handleListFolders(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	folders := make([]messages.Folder, 0)
+	for _, folder := range vault.GetFolders() {
+		folders = append(folders, messages.Folder{
+			ID:   folder.ID,
+			Name: folder.Name,
+		})
+	}
+
+	return messages.IPCMessageFromPayload(messages.ListFoldersResponse{
+		Folders: folders,
+	})
+}
+
+func handleListCollections(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	collections := make([]messages.Collection, 0)
+	for _, collection := range vault.GetCollections() {
+		collections = append(collections, messages.Collection{
+			ID:             collection.ID,
+			OrganizationID: collection.OrganizationID,
+			Name:           collection.Name,
+		})
+	}
+
+	return messages.IPCMessageFromPayload(messages.ListCollectionsResponse{
+		Collections: collections,
+	})
+}
+
+func init() {
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.ListFoldersRequest{}), ensureIsNotLocked(ensureIsLoggedIn(handleListFolders)))
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.ListCollectionsRequest{}), ensureIsNotLocked(ensureIsLoggedIn(handleListCollections)))
+}
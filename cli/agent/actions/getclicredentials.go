@@ -3,10 +3,11 @@ package actions
 import (
 	"fmt"
 
+	"github.com/quexten/goldwarden/cli/agent/audit"
 	"github.com/quexten/goldwarden/cli/agent/config"
 	"github.com/quexten/goldwarden/cli/agent/sockets"
 	"github.com/quexten/goldwarden/cli/agent/systemauth"
-	"github.com/quexten/goldwarden/cli/agent/systemauth/pinentry"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/policy"
 	"github.com/quexten/goldwarden/cli/agent/vault"
 	"github.com/quexten/goldwarden/cli/ipc/messages"
 )
@@ -14,10 +15,13 @@ import (
 func handleGetCliCredentials(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
 	req := messages.ParsePayload(request).(messages.GetCLICredentialsRequest)
 
-	if approved, err := pinentry.GetApproval("Approve Credential Access", fmt.Sprintf("%s on %s>%s>%s is trying to access credentials for %s", ctx.UserName, ctx.GrandParentProcessName, ctx.ParentProcessName, ctx.ProcessName, req.ApplicationName)); err != nil || !approved {
+	approved, method := approveWithMethod(ctx, cfg, policy.NewRequest(policy.ActionGetCLICredentials, *ctx), "Approve Credential Access", fmt.Sprintf("%s on %s>%s>%s is trying to access credentials for %s", ctx.UserName, ctx.GrandParentProcessName, ctx.ParentProcessName, ctx.ProcessName, req.ApplicationName))
+	if !approved {
+		audit.Log(audit.ActionGetCLICredentials, *ctx, "", req.ApplicationName, false, method)
 		response, err = messages.IPCMessageFromPayload(messages.ActionResponse{
 			Success: false,
 			Message: "not approved",
+			Code:    messages.ErrorCodeNotApproved,
 		})
 		if err != nil {
 			return messages.IPCMessage{}, err
@@ -25,11 +29,13 @@ func handleGetCliCredentials(request messages.IPCMessage, cfg *config.Config, va
 		return response, nil
 	}
 
-	env, found := vault.GetEnvCredentialForExecutable(req.ApplicationName)
+	env, cipherID, found := vault.GetEnvCredentialForExecutable(req.ApplicationName, req.Folder, req.Collection)
+	audit.Log(audit.ActionGetCLICredentials, *ctx, cipherID, req.ApplicationName, true, method)
 	if !found {
 		response, err = messages.IPCMessageFromPayload(messages.ActionResponse{
 			Success: false,
 			Message: "no credentials found for " + req.ApplicationName,
+			Code:    messages.ErrorCodeNotFound,
 		})
 		if err != nil {
 			return messages.IPCMessage{}, err
@@ -0,0 +1,126 @@
+package actions
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/quexten/goldwarden/cli/agent/bitwarden/crypto"
+	"github.com/quexten/goldwarden/cli/agent/bitwarden/models"
+	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/sockets"
+	"github.com/quexten/goldwarden/cli/agent/systemauth"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/policy"
+	"github.com/quexten/goldwarden/cli/agent/vault"
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+)
+
+func decryptIdentity(identity models.Cipher, key crypto.SymmetricEncryptionKey) messages.DecryptedIdentityCipher {
+	decryptedIdentity := messages.DecryptedIdentityCipher{
+		Name: decryptOrEmpty(identity.Name, key),
+		UUID: identity.ID.String(),
+	}
+	if identity.OrganizationID != nil {
+		decryptedIdentity.OrganizationID = identity.OrganizationID.String()
+	}
+	if identity.Notes != nil {
+		decryptedIdentity.Notes = decryptOrEmpty(*identity.Notes, key)
+	}
+	if identity.Identity == nil {
+		return decryptedIdentity
+	}
+
+	decryptedIdentity.Title = decryptOrEmpty(identity.Identity.Title, key)
+	decryptedIdentity.FirstName = decryptOrEmpty(identity.Identity.FirstName, key)
+	decryptedIdentity.MiddleName = decryptOrEmpty(identity.Identity.MiddleName, key)
+	decryptedIdentity.LastName = decryptOrEmpty(identity.Identity.LastName, key)
+	decryptedIdentity.Username = decryptOrEmpty(identity.Identity.Username, key)
+	decryptedIdentity.Company = decryptOrEmpty(identity.Identity.Company, key)
+	decryptedIdentity.SSN = decryptOrEmpty(identity.Identity.SSN, key)
+	decryptedIdentity.PassportNumber = decryptOrEmpty(identity.Identity.PassportNumber, key)
+	decryptedIdentity.LicenseNumber = decryptOrEmpty(identity.Identity.LicenseNumber, key)
+	decryptedIdentity.Email = decryptOrEmpty(identity.Identity.Email, key)
+	decryptedIdentity.Phone = decryptOrEmpty(identity.Identity.Phone, key)
+	decryptedIdentity.Address1 = decryptOrEmpty(identity.Identity.Address1, key)
+	decryptedIdentity.Address2 = decryptOrEmpty(identity.Identity.Address2, key)
+	decryptedIdentity.Address3 = decryptOrEmpty(identity.Identity.Address3, key)
+	decryptedIdentity.City = decryptOrEmpty(identity.Identity.City, key)
+	decryptedIdentity.State = decryptOrEmpty(identity.Identity.State, key)
+	decryptedIdentity.PostalCode = decryptOrEmpty(identity.Identity.PostalCode, key)
+	decryptedIdentity.Country = decryptOrEmpty(identity.Identity.Country, key)
+	return decryptedIdentity
+}
+
+func handleGetIdentity(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(request).(messages.GetIdentityRequest)
+	identity, err := vault.GetIdentityByFilter(req.UUID, req.OrgId, req.Name)
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "identity not found",
+			Code:    messages.ErrorCodeNotFound,
+		})
+	}
+
+	cipherKey, err := identity.GetKeyForCipher(*vault.Keyring)
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "could not get cipher key",
+		})
+	}
+
+	decryptedIdentity := decryptIdentity(identity, cipherKey)
+	if !approve(ctx, cfg, cipherPolicyRequest(policy.ActionGetIdentity, ctx, vault, identity, decryptedIdentity.Name), "Approve Credential Access", fmt.Sprintf("%s on %s>%s>%s is trying to access the identity %s", ctx.UserName, ctx.GrandParentProcessName, ctx.ParentProcessName, ctx.ProcessName, decryptedIdentity.Name)) {
+		response, err = messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "not approved",
+			Code:    messages.ErrorCodeNotApproved,
+		})
+		if err != nil {
+			return messages.IPCMessage{}, err
+		}
+		return response, nil
+	}
+
+	return messages.IPCMessageFromPayload(messages.GetIdentityResponse{
+		Found:  true,
+		Result: decryptedIdentity,
+	})
+}
+
+func handleListIdentities(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	identities := vault.GetIdentities()
+	decryptedIdentities := make([]messages.DecryptedIdentityCipher, 0)
+	for _, identity := range identities {
+		key, err := identity.GetKeyForCipher(*vault.Keyring)
+		if err != nil {
+			actionsLog.Warn("Could not decrypt identity:" + err.Error())
+			continue
+		}
+
+		// only expose non-sensitive fields when listing, use GetIdentityRequest for the full identity
+		decryptedIdentity := decryptIdentity(identity, key)
+		decryptedIdentities = append(decryptedIdentities, messages.DecryptedIdentityCipher{
+			Name:           decryptedIdentity.Name,
+			UUID:           decryptedIdentity.UUID,
+			OrganizationID: decryptedIdentity.OrganizationID,
+			FirstName:      decryptedIdentity.FirstName,
+			LastName:       decryptedIdentity.LastName,
+			Email:          decryptedIdentity.Email,
+			Company:        decryptedIdentity.Company,
+		})
+
+		// prevent deadlock from enclaves
+		debug.FreeOSMemory()
+	}
+
+	return messages.IPCMessageFromPayload(messages.GetIdentitiesResponse{
+		Found:  len(decryptedIdentities) > 0,
+		Result: decryptedIdentities,
+	})
+}
+
+func init() {
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.GetIdentityRequest{}), ensureEverything(systemauth.AccessVault, handleGetIdentity))
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.ListIdentitiesRequest{}), ensureEverything(systemauth.AccessVault, handleListIdentities))
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/quexten/goldwarden/cli/agent/bitwarden"
 	"github.com/quexten/goldwarden/cli/agent/bitwarden/crypto"
+	"github.com/quexten/goldwarden/cli/agent/bitwarden/twofactor"
 	"github.com/quexten/goldwarden/cli/agent/config"
 	"github.com/quexten/goldwarden/cli/agent/notify"
 	"github.com/quexten/goldwarden/cli/agent/sockets"
@@ -28,8 +29,16 @@ func handleLogin(msg messages.IPCMessage, cfg *config.Config, vault *vault.Vault
 	}
 
 	req := messages.ParsePayload(msg).(messages.DoLoginRequest)
+	if req.TwoFactorMethod != "" {
+		if _, err := twofactor.ParseProvider(req.TwoFactorMethod); err != nil {
+			return messages.IPCMessageFromPayload(messages.ActionResponse{
+				Success: false,
+				Message: fmt.Sprintf("Could not login: %s", err.Error()),
+			})
+		}
+	}
 
-	ctx := context.Background()
+	ctx := context.WithValue(context.Background(), bitwarden.TwoFactorMethod{}, req.TwoFactorMethod)
 	var token bitwarden.LoginResponseToken
 	var masterKey crypto.MasterKey
 	var masterpasswordHash string
@@ -65,7 +74,7 @@ func handleLogin(msg messages.IPCMessage, cfg *config.Config, vault *vault.Vault
 		Key:          token.Key,
 	})
 
-	profile, err := bitwarden.Sync(context.WithValue(ctx, bitwarden.AuthToken{}, token.AccessToken), cfg)
+	profile, err := bitwarden.Sync(bitwarden.WithAuthentication(ctx, cfg), cfg)
 	if err != nil {
 		var payload = messages.ActionResponse{
 			Success: false,
@@ -129,7 +138,7 @@ func handleLogin(msg messages.IPCMessage, cfg *config.Config, vault *vault.Vault
 		}
 		return
 	}
-	err = bitwarden.DoFullSync(context.WithValue(ctx, bitwarden.AuthToken{}, token.AccessToken), vault, cfg, &protectedUserSymmetricKey, false)
+	err = bitwarden.DoFullSync(bitwarden.WithAuthentication(ctx, cfg), vault, cfg, &protectedUserSymmetricKey, false)
 
 	response, err = messages.IPCMessageFromPayload(messages.ActionResponse{
 		Success: true,
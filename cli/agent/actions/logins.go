@@ -1,14 +1,20 @@
 package actions
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"runtime/debug"
 
+	"github.com/google/uuid"
+	"github.com/quexten/goldwarden/cli/agent/audit"
+	"github.com/quexten/goldwarden/cli/agent/bitwarden"
 	"github.com/quexten/goldwarden/cli/agent/bitwarden/crypto"
+	"github.com/quexten/goldwarden/cli/agent/bitwarden/models"
 	"github.com/quexten/goldwarden/cli/agent/config"
 	"github.com/quexten/goldwarden/cli/agent/sockets"
 	"github.com/quexten/goldwarden/cli/agent/systemauth"
-	"github.com/quexten/goldwarden/cli/agent/systemauth/pinentry"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/policy"
 	"github.com/quexten/goldwarden/cli/agent/vault"
 	"github.com/quexten/goldwarden/cli/ipc/messages"
 )
@@ -20,6 +26,7 @@ func handleGetLoginCipher(request messages.IPCMessage, cfg *config.Config, vault
 		return messages.IPCMessageFromPayload(messages.ActionResponse{
 			Success: false,
 			Message: "login not found",
+			Code:    messages.ErrorCodeNotFound,
 		})
 	}
 
@@ -66,19 +73,36 @@ func handleGetLoginCipher(request messages.IPCMessage, cfg *config.Config, vault
 			decryptedLogin.Notes = string(decryptedNotes)
 		}
 	}
-	if !login.Login.Totp.IsNull() {
-		decryptedTotp, err := crypto.DecryptWith(login.Login.Totp, cipherKey)
-		if err == nil {
-			decryptedLogin.TOTPSeed = string(decryptedTotp)
-		} else {
-			fmt.Println(string(decryptedTotp))
+	// the seed never leaves the daemon, codes are requested with GetTOTPRequest
+	decryptedLogin.HasTOTP = !login.Login.Totp.IsNull()
+
+	if login.Login.URIs != nil {
+		decryptedLogin.URIs = make([]string, 0)
+		for _, uri := range login.Login.URIs {
+			if uri.URI.IsNull() {
+				continue
+			}
+			decryptedLogin.URIs = append(decryptedLogin.URIs, decryptOrEmpty(uri.URI, cipherKey))
 		}
 	}
+	if !login.Login.URI.IsNull() {
+		decryptedLogin.URI = decryptOrEmpty(login.Login.URI, cipherKey)
+	}
+	for _, field := range login.Fields {
+		decryptedLogin.Fields = append(decryptedLogin.Fields, messages.LoginField{
+			Name:   decryptOrEmpty(field.Name, cipherKey),
+			Value:  decryptOrEmpty(field.Value, cipherKey),
+			Hidden: field.Type == models.FieldTypeHidden,
+		})
+	}
 
-	if approved, err := pinentry.GetApproval("Approve Credential Access", fmt.Sprintf("%s on %s>%s>%s is trying to access credentials for user %s on entry %s", ctx.UserName, ctx.GrandParentProcessName, ctx.ParentProcessName, ctx.ProcessName, decryptedLogin.Username, decryptedLogin.Name)); err != nil || !approved {
+	approved, method := approveWithMethod(ctx, cfg, cipherPolicyRequest(policy.ActionGetLogin, ctx, vault, login, decryptedLogin.Name), "Approve Credential Access", fmt.Sprintf("%s on %s>%s>%s is trying to access credentials for user %s on entry %s", ctx.UserName, ctx.GrandParentProcessName, ctx.ParentProcessName, ctx.ProcessName, decryptedLogin.Username, decryptedLogin.Name))
+	audit.Log(audit.ActionGetLogin, *ctx, decryptedLogin.UUID, "", approved, method)
+	if !approved {
 		response, err = messages.IPCMessageFromPayload(messages.ActionResponse{
 			Success: false,
 			Message: "not approved",
+			Code:    messages.ErrorCodeNotApproved,
 		})
 		if err != nil {
 			return messages.IPCMessage{}, err
@@ -104,16 +128,21 @@ func handleListLoginsRequest(request messages.IPCMessage, cfg *config.Config, va
 	// 	return response, nil
 	// }
 
+	req := messages.ParsePayload(request).(messages.ListLoginsRequest)
 	logins := vault.GetLogins()
 	decryptedLoginCiphers := make([]messages.DecryptedLoginCipher, 0)
 	for _, login := range logins {
+		if !vault.MatchesFilter(login, req.Folder, req.Collection) {
+			continue
+		}
+
 		key, err := login.GetKeyForCipher(*vault.Keyring)
 		if err != nil {
 			actionsLog.Warn("Could not decrypt login:" + err.Error())
 			continue
 		}
 
-		var decryptedName, decryptedUsername, decryptedPassword, decryptedTotp, decryptedURL []byte
+		var decryptedName, decryptedUsername, decryptedPassword, decryptedURL []byte
 
 		if !login.Name.IsNull() {
 			decryptedName, err = crypto.DecryptWith(login.Name, key)
@@ -145,16 +174,6 @@ func handleListLoginsRequest(request messages.IPCMessage, cfg *config.Config, va
 			decryptedPassword = []byte{}
 		}
 
-		if !login.Login.Totp.IsNull() {
-			decryptedTotp, err = crypto.DecryptWith(login.Login.Totp, key)
-			if err != nil {
-				actionsLog.Warn("Could not decrypt login:" + err.Error())
-				continue
-			}
-		} else {
-			decryptedTotp = []byte{}
-		}
-
 		if !login.Login.URI.IsNull() {
 			decryptedURL, err = crypto.DecryptWith(login.Login.URI, key)
 			if err != nil {
@@ -170,7 +189,7 @@ func handleListLoginsRequest(request messages.IPCMessage, cfg *config.Config, va
 			Username: string(decryptedUsername),
 			UUID:     login.ID.String(),
 			Password: string(decryptedPassword),
-			TOTPSeed: string(decryptedTotp),
+			HasTOTP:  !login.Login.Totp.IsNull(),
 			URI:      string(decryptedURL),
 		})
 
@@ -178,13 +197,329 @@ func handleListLoginsRequest(request messages.IPCMessage, cfg *config.Config, va
 		debug.FreeOSMemory()
 	}
 
+	audit.Log(audit.ActionListLogins, *ctx, "", fmt.Sprintf("%d logins", len(decryptedLoginCiphers)), true, "vault authorization")
+
 	return messages.IPCMessageFromPayload(messages.GetLoginsResponse{
 		Found:  len(decryptedLoginCiphers) > 0,
 		Result: decryptedLoginCiphers,
 	})
 }
 
+func encryptLoginValue(value string, key crypto.SymmetricEncryptionKey) (crypto.EncString, error) {
+	if value == "" {
+		return crypto.EncString{}, nil
+	}
+	return crypto.EncryptWith([]byte(value), crypto.AesCbc256_HmacSha256_B64, key)
+}
+
+func applyLoginEdit(cipher *models.Cipher, edit messages.EditLoginRequest, key crypto.SymmetricEncryptionKey) error {
+	var err error
+	if cipher.Login == nil {
+		cipher.Login = &models.LoginCipher{}
+	}
+
+	if edit.Name != nil {
+		if *edit.Name == "" {
+			return errors.New("name must not be empty")
+		}
+		if cipher.Name, err = encryptLoginValue(*edit.Name, key); err != nil {
+			return err
+		}
+	}
+	if edit.Username != nil {
+		if cipher.Login.Username, err = encryptLoginValue(*edit.Username, key); err != nil {
+			return err
+		}
+	}
+	if edit.Password != nil {
+		if cipher.Login.Password, err = encryptLoginValue(*edit.Password, key); err != nil {
+			return err
+		}
+	}
+	if edit.TOTP != nil {
+		if cipher.Login.Totp, err = encryptLoginValue(*edit.TOTP, key); err != nil {
+			return err
+		}
+	}
+	if edit.Notes != nil {
+		if *edit.Notes == "" {
+			cipher.Notes = nil
+		} else {
+			notes, err := encryptLoginValue(*edit.Notes, key)
+			if err != nil {
+				return err
+			}
+			cipher.Notes = &notes
+		}
+	}
+	if edit.URIs != nil {
+		cipher.Login.URI = crypto.EncString{}
+		cipher.Login.URIs = make([]models.URI, 0)
+		for _, uri := range *edit.URIs {
+			encryptedURI, err := encryptLoginValue(uri, key)
+			if err != nil {
+				return err
+			}
+			cipher.Login.URIs = append(cipher.Login.URIs, models.URI{URI: encryptedURI})
+		}
+		if len(cipher.Login.URIs) > 0 {
+			cipher.Login.URI = cipher.Login.URIs[0].URI
+		}
+	}
+	if edit.Fields != nil {
+		cipher.Fields = make([]models.Field, 0)
+		for _, field := range *edit.Fields {
+			encryptedName, err := encryptLoginValue(field.Name, key)
+			if err != nil {
+				return err
+			}
+			encryptedValue, err := encryptLoginValue(field.Value, key)
+			if err != nil {
+				return err
+			}
+			fieldType := models.FieldTypeText
+			if field.Hidden {
+				fieldType = models.FieldTypeHidden
+			}
+			cipher.Fields = append(cipher.Fields, models.Field{
+				Type:  fieldType,
+				Name:  encryptedName,
+				Value: encryptedValue,
+			})
+		}
+	}
+
+	return nil
+}
+
+func handleAddLogin(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(request).(messages.AddLoginRequest)
+
+	if req.Name == "" {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "name must not be empty",
+		})
+	}
+
+	cipher := models.Cipher{
+		Type:  models.CipherLogin,
+		Login: &models.LoginCipher{},
+	}
+	if req.OrgId != "" {
+		orgId, err := uuid.Parse(req.OrgId)
+		if err != nil {
+			return messages.IPCMessageFromPayload(messages.ActionResponse{
+				Success: false,
+				Message: "invalid organization id",
+			})
+		}
+		cipher.OrganizationID = &orgId
+	} else if len(req.CollectionIDs) > 0 {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "collections require an organization",
+		})
+	}
+
+	cipherKey, err := cipher.GetKeyForCipher(*vault.Keyring)
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "could not get cipher key",
+		})
+	}
+
+	err = applyLoginEdit(&cipher, messages.EditLoginRequest{
+		Name:     &req.Name,
+		Username: &req.Username,
+		Password: &req.Password,
+		URIs:     &req.URIs,
+		TOTP:     &req.TOTP,
+		Notes:    &req.Notes,
+		Fields:   &req.Fields,
+	}, cipherKey)
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	if !approve(ctx, cfg, cipherPolicyRequest(policy.ActionCreateLogin, ctx, vault, cipher, req.Name), "Approve Credential Creation", fmt.Sprintf("%s on %s>%s>%s is trying to create entry %s", ctx.UserName, ctx.GrandParentProcessName, ctx.ParentProcessName, ctx.ProcessName, req.Name)) {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "not approved",
+			Code:    messages.ErrorCodeNotApproved,
+		})
+	}
+
+	httpCtx := bitwarden.WithAuthentication(context.TODO(), cfg)
+	var postedCipher models.Cipher
+	if cipher.OrganizationID != nil {
+		postedCipher, err = bitwarden.PostCipherToCollections(httpCtx, cipher, req.CollectionIDs, cfg)
+	} else {
+		postedCipher, err = bitwarden.PostCipher(httpCtx, cipher, cfg)
+	}
+	if err != nil {
+		actionsLog.Warn("Error posting login cipher: " + err.Error())
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "could not create login: " + err.Error(),
+		})
+	}
+	vault.AddOrUpdateLogin(postedCipher)
+
+	return messages.IPCMessageFromPayload(messages.AddLoginResponse{
+		Name: req.Name,
+		UUID: postedCipher.ID.String(),
+	})
+}
+
+func handleEditLogin(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(request).(messages.EditLoginRequest)
+
+	if req.UUID == "" && req.LookupName == "" {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "uuid or name required",
+		})
+	}
+
+	login, err := vault.GetLoginByFilter(req.UUID, "", req.LookupName, "")
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "login not found",
+			Code:    messages.ErrorCodeNotFound,
+		})
+	}
+	if login.Login == nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "cipher is not a login",
+		})
+	}
+	if login.OrganizationID != nil && !login.Edit {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "no permission to edit this login",
+		})
+	}
+
+	cipherKey, err := login.GetKeyForCipher(*vault.Keyring)
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "could not get cipher key",
+		})
+	}
+	name := decryptOrEmpty(login.Name, cipherKey)
+
+	// copy the login data so a failed request does not modify the cached cipher
+	loginData := *login.Login
+	login.Login = &loginData
+	if err := applyLoginEdit(&login, req, cipherKey); err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	if !approve(ctx, cfg, cipherPolicyRequest(policy.ActionEditLogin, ctx, vault, login, name), "Approve Credential Modification", fmt.Sprintf("%s on %s>%s>%s is trying to modify entry %s", ctx.UserName, ctx.GrandParentProcessName, ctx.ParentProcessName, ctx.ProcessName, name)) {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "not approved",
+			Code:    messages.ErrorCodeNotApproved,
+		})
+	}
+
+	httpCtx := bitwarden.WithAuthentication(context.TODO(), cfg)
+	updatedCipher, err := bitwarden.PutCipher(httpCtx, login.ID.String(), login, cfg)
+	if err != nil {
+		actionsLog.Warn("Error updating login cipher: " + err.Error())
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "could not update login: " + err.Error(),
+		})
+	}
+	vault.AddOrUpdateLogin(updatedCipher)
+
+	if req.Name != nil {
+		name = *req.Name
+	}
+	return messages.IPCMessageFromPayload(messages.EditLoginResponse{
+		Name: name,
+		UUID: updatedCipher.ID.String(),
+	})
+}
+
+func handleDeleteLogin(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(request).(messages.DeleteLoginRequest)
+
+	if req.UUID == "" && req.Name == "" {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "uuid or name required",
+		})
+	}
+
+	login, err := vault.GetLoginByFilter(req.UUID, "", req.Name, "")
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "login not found",
+			Code:    messages.ErrorCodeNotFound,
+		})
+	}
+	if login.OrganizationID != nil && !login.Edit {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "no permission to delete this login",
+		})
+	}
+
+	name := login.ID.String()
+	if cipherKey, err := login.GetKeyForCipher(*vault.Keyring); err == nil {
+		name = decryptOrEmpty(login.Name, cipherKey)
+	}
+
+	action := "move entry %s to the trash"
+	if req.Permanent {
+		action = "permanently delete entry %s"
+	}
+	if !approve(ctx, cfg, cipherPolicyRequest(policy.ActionDeleteLogin, ctx, vault, login, name), "Approve Credential Deletion", fmt.Sprintf("%s on %s>%s>%s is trying to "+action, ctx.UserName, ctx.GrandParentProcessName, ctx.ParentProcessName, ctx.ProcessName, name)) {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "not approved",
+			Code:    messages.ErrorCodeNotApproved,
+		})
+	}
+
+	httpCtx := bitwarden.WithAuthentication(context.TODO(), cfg)
+	if req.Permanent {
+		err = bitwarden.DeleteCipher(httpCtx, login.ID.String(), cfg)
+	} else {
+		err = bitwarden.SoftDeleteCipher(httpCtx, login.ID.String(), cfg)
+	}
+	if err != nil {
+		actionsLog.Warn("Error deleting login cipher: " + err.Error())
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "could not delete login: " + err.Error(),
+		})
+	}
+	vault.DeleteCipher(login.ID.String())
+
+	return messages.IPCMessageFromPayload(messages.ActionResponse{
+		Success: true,
+	})
+}
+
 func init() {
 	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.GetLoginRequest{}), ensureEverything(systemauth.AccessVault, handleGetLoginCipher))
 	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.ListLoginsRequest{}), ensureEverything(systemauth.AccessVault, handleListLoginsRequest))
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.AddLoginRequest{}), ensureEverything(systemauth.AccessVault, handleAddLogin))
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.EditLoginRequest{}), ensureEverything(systemauth.AccessVault, handleEditLogin))
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.DeleteLoginRequest{}), ensureEverything(systemauth.AccessVault, handleDeleteLogin))
 }
@@ -0,0 +1,69 @@
+package actions
+
+import (
+	"fmt"
+
+	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/sockets"
+	"github.com/quexten/goldwarden/cli/agent/systemauth"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/pinentry"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/policy"
+	"github.com/quexten/goldwarden/cli/agent/vault"
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+)
+
+func handleReloadPolicy(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	policyPath := cfg.PolicyPath()
+	newPolicy, err := policy.Read(policyPath)
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "could not load policy: " + err.Error(),
+		})
+	}
+
+	message := fmt.Sprintf("Do you want to load %d policy rules from %s? Rules can allow access without asking.", len(newPolicy.Rules), policyPath)
+	if approved, err := pinentry.GetApproval("Reload Goldwarden policy", message); err != nil || !approved {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "not approved",
+			Code:    messages.ErrorCodeNotApproved,
+		})
+	}
+
+	policy.Apply(policyPath, newPolicy)
+	// rule indices may have changed
+	systemauth.WipePolicyApprovals()
+
+	return messages.IPCMessageFromPayload(messages.ActionResponse{
+		Success: true,
+		Message: fmt.Sprintf("loaded %d rules from %s", len(newPolicy.Rules), policyPath),
+	})
+}
+
+func handleCheckPolicy(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(request).(messages.CheckPolicyRequest)
+
+	result := policy.Evaluate(policy.Request{
+		Action:         policy.Action(req.Action),
+		ExecutablePath: req.ExecutablePath,
+		Ancestry:       req.Ancestry,
+		Cipher:         req.Cipher,
+		Folder:         req.Folder,
+		Key:            req.Key,
+		Forwarded:      req.Forwarded,
+		RemoteHost:     req.RemoteHost,
+	})
+
+	return messages.IPCMessageFromPayload(messages.CheckPolicyResponse{
+		Decision:  string(result.Decision),
+		RuleIndex: result.RuleIndex,
+		RuleName:  result.RuleName,
+		TTL:       result.TTL.String(),
+	})
+}
+
+func init() {
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.ReloadPolicyRequest{}), ensureBiometricsAuthorized(systemauth.AccessVault, handleReloadPolicy))
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.CheckPolicyRequest{}), handleCheckPolicy)
+}
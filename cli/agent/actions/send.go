@@ -2,7 +2,6 @@ package actions
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/quexten/goldwarden/cli/agent/bitwarden"
 	"github.com/quexten/goldwarden/cli/agent/config"
@@ -12,13 +11,9 @@ import (
 )
 
 func handleCreateSend(msg messages.IPCMessage, cfg *config.Config, vault *vault.Vault, callingContext *sockets.CallingContext) (response messages.IPCMessage, err error) {
-	token, err := cfg.GetToken()
-	if err != nil {
-		return messages.IPCMessage{}, fmt.Errorf("error getting token: %w", err)
-	}
 	parsedMsg := messages.ParsePayload(msg).(messages.CreateSendRequest)
 
-	ctx := context.WithValue(context.TODO(), bitwarden.AuthToken{}, token.AccessToken)
+	ctx := bitwarden.WithAuthentication(context.TODO(), cfg)
 	url, err := bitwarden.CreateSend(ctx, cfg, vault, parsedMsg.Name, parsedMsg.Text)
 	if err != nil {
 		actionsLog.Warn(err.Error())
@@ -2,21 +2,26 @@ package actions
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	"github.com/quexten/goldwarden/cli/agent/bitwarden"
+	"github.com/quexten/goldwarden/cli/agent/bitwarden/models"
 	"github.com/quexten/goldwarden/cli/agent/config"
 	"github.com/quexten/goldwarden/cli/agent/sockets"
 	"github.com/quexten/goldwarden/cli/agent/ssh"
 	"github.com/quexten/goldwarden/cli/agent/systemauth"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/pinentry"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/policy"
 	"github.com/quexten/goldwarden/cli/agent/vault"
 	"github.com/quexten/goldwarden/cli/ipc/messages"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 func handleAddSSH(msg messages.IPCMessage, cfg *config.Config, vault *vault.Vault, callingContext *sockets.CallingContext) (response messages.IPCMessage, err error) {
 	req := messages.ParsePayload(msg).(messages.CreateSSHKeyRequest)
 
-	cipher, publicKey, err := ssh.NewSSHKeyCipher(req.Name, vault.Keyring)
+	cipher, publicKey, err := ssh.NewSSHKeyCipher(req.Name, req.Type, vault.Keyring)
 	if err != nil {
 		response, err = messages.IPCMessageFromPayload(messages.ActionResponse{
 			Success: false,
@@ -36,14 +41,10 @@ func handleAddSSH(msg messages.IPCMessage, cfg *config.Config, vault *vault.Vaul
 		return
 	}
 
-	token, err := cfg.GetToken()
-	if err != nil {
-		actionsLog.Warn(err.Error())
-	}
-	ctx := context.WithValue(context.TODO(), bitwarden.AuthToken{}, token.AccessToken)
+	ctx := bitwarden.WithAuthentication(context.TODO(), cfg)
 	postedCipher, err := bitwarden.PostCipher(ctx, cipher, cfg)
 	if err == nil {
-		vault.AddOrUpdateSecureNote(postedCipher)
+		vault.AddOrUpdateCipher(postedCipher)
 	} else {
 		actionsLog.Warn("Error posting ssh key cipher: " + err.Error())
 	}
@@ -56,10 +57,15 @@ func handleAddSSH(msg messages.IPCMessage, cfg *config.Config, vault *vault.Vaul
 }
 
 func handleListSSH(msg messages.IPCMessage, cfg *config.Config, vault *vault.Vault, callingContext *sockets.CallingContext) (response messages.IPCMessage, err error) {
-	keys := vault.GetSSHKeys()
+	req := messages.ParsePayload(msg).(messages.GetSSHKeysRequest)
+	keys := vault.GetSSHKeysWithFilter(req.Folder, req.Collection)
 	keyStrings := make([]string, 0)
 	for _, key := range keys {
-		keyStrings = append(keyStrings, strings.ReplaceAll(key.PublicKey+" "+key.Name, "\n", ""))
+		restrictions := sshKeyRestrictionsDescription(key)
+		keyStrings = append(keyStrings, strings.ReplaceAll(key.PublicKey+" "+key.Name+restrictions, "\n", ""))
+		if key.Certificate != "" {
+			keyStrings = append(keyStrings, strings.ReplaceAll(key.Certificate+" "+key.Name+restrictions, "\n", ""))
+		}
 	}
 
 	response, err = messages.IPCMessageFromPayload(messages.GetSSHKeysResponse{
@@ -68,10 +74,67 @@ func handleListSSH(msg messages.IPCMessage, cfg *config.Config, vault *vault.Vau
 	return
 }
 
+func handleExportSSH(msg messages.IPCMessage, cfg *config.Config, vault *vault.Vault, callingContext *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(msg).(messages.ExportSSHKeysRequest)
+
+	keys := make([]messages.SSHPublicKey, 0)
+	for _, key := range vault.GetSSHKeysWithFilter(req.Folder, req.Collection) {
+		pub, _, _, _, err := gossh.ParseAuthorizedKey([]byte(key.PublicKey))
+		if err != nil {
+			actionsLog.Warn("Skipping ssh key %s: %s", key.ID, err.Error())
+			continue
+		}
+		keyType, bits := ssh.DescribePublicKey(pub)
+		keys = append(keys, messages.SSHPublicKey{
+			UUID:         key.ID,
+			Name:         key.Name,
+			Type:         keyType,
+			Bits:         bits,
+			PublicKey:    strings.TrimSpace(string(gossh.MarshalAuthorizedKey(pub))),
+			Fingerprint:  gossh.FingerprintSHA256(pub),
+			Certificate:  strings.TrimSpace(key.Certificate),
+			GitEmails:    key.GitEmails,
+			AllowedHosts: key.AllowedHosts,
+		})
+	}
+
+	return messages.IPCMessageFromPayload(messages.ExportSSHKeysResponse{
+		Keys: keys,
+	})
+}
+
+func sshKeyRestrictionsDescription(key vault.SSHKey) string {
+	var restrictions []string
+	if len(key.AllowedHosts) > 0 {
+		restrictions = append(restrictions, "allowed hosts: "+strings.Join(key.AllowedHosts, ", "))
+	}
+	if len(key.AllowedUsers) > 0 {
+		restrictions = append(restrictions, "allowed users: "+strings.Join(key.AllowedUsers, ", "))
+	}
+	if ssh.ForwardingDenied(key) {
+		restrictions = append(restrictions, "never forwarded")
+	}
+	if len(restrictions) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(restrictions, "; ") + ")"
+}
+
 func handleImportSSH(msg messages.IPCMessage, cfg *config.Config, vault *vault.Vault, callingContext *sockets.CallingContext) (response messages.IPCMessage, err error) {
 	req := messages.ParsePayload(msg).(messages.ImportSSHKeyRequest)
 
-	cipher, _, err := ssh.SSHKeyCipherFromKey(req.Name, req.Key, vault.Keyring)
+	privateKey, err := ssh.ImportPrivateKey(req.Key, func() (string, error) {
+		return pinentry.GetPassword("Import SSH Key", "Enter the passphrase of the ssh key "+req.Name+". It is stored without passphrase in your vault.")
+	})
+	if err != nil {
+		response, err = messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	cipher, _, err := ssh.SSHKeyCipherFromKey(req.Name, privateKey, vault.Keyring)
 	if err != nil {
 		response, err = messages.IPCMessageFromPayload(messages.ActionResponse{
 			Success: false,
@@ -91,14 +154,10 @@ func handleImportSSH(msg messages.IPCMessage, cfg *config.Config, vault *vault.V
 		return
 	}
 
-	token, err := cfg.GetToken()
-	if err != nil {
-		actionsLog.Warn(err.Error())
-	}
-	ctx := context.WithValue(context.TODO(), bitwarden.AuthToken{}, token.AccessToken)
+	ctx := bitwarden.WithAuthentication(context.TODO(), cfg)
 	postedCipher, err := bitwarden.PostCipher(ctx, cipher, cfg)
 	if err == nil {
-		vault.AddOrUpdateSecureNote(postedCipher)
+		vault.AddOrUpdateCipher(postedCipher)
 	} else {
 		actionsLog.Warn("Error posting ssh key cipher: " + err.Error())
 	}
@@ -109,8 +168,170 @@ func handleImportSSH(msg messages.IPCMessage, cfg *config.Config, vault *vault.V
 	return
 }
 
+func handleSetSSHCertificate(msg messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(msg).(messages.SetSSHCertificateRequest)
+
+	if req.UUID == "" && req.Name == "" {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "uuid or name required",
+		})
+	}
+
+	cipher, err := vault.GetSSHKeyCipherByFilter(req.UUID, req.Name)
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "ssh key not found",
+			Code:    messages.ErrorCodeNotFound,
+		})
+	}
+	if cipher.OrganizationID != nil && !cipher.Edit {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "no permission to edit this ssh key",
+		})
+	}
+
+	publicKey := ""
+	for _, key := range vault.GetSSHKeys() {
+		if key.ID == cipher.ID.String() {
+			publicKey = key.PublicKey
+		}
+	}
+
+	cipherKey, err := cipher.GetKeyForCipher(*vault.Keyring)
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "could not get cipher key",
+		})
+	}
+	name := decryptOrEmpty(cipher.Name, cipherKey)
+
+	if err := ssh.SetCertificate(&cipher, publicKey, req.Certificate, cipherKey); err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	if !approve(ctx, cfg, cipherPolicyRequest(policy.ActionEditSSHKey, ctx, vault, cipher, name), "Approve SSH Key Modification", fmt.Sprintf("%s on %s>%s>%s is trying to change the certificate of ssh key %s", ctx.UserName, ctx.GrandParentProcessName, ctx.ParentProcessName, ctx.ProcessName, name)) {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "not approved",
+			Code:    messages.ErrorCodeNotApproved,
+		})
+	}
+
+	httpCtx := bitwarden.WithAuthentication(context.TODO(), cfg)
+	updatedCipher, err := bitwarden.PutCipher(httpCtx, cipher.ID.String(), cipher, cfg)
+	if err != nil {
+		actionsLog.Warn("Error updating ssh key cipher: " + err.Error())
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "could not update ssh key: " + err.Error(),
+		})
+	}
+	vault.AddOrUpdateCipher(updatedCipher)
+
+	return messages.IPCMessageFromPayload(messages.ActionResponse{
+		Success: true,
+		Message: "certificate set for " + name,
+	})
+}
+
+func handleMigrateSSHKeys(msg messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(msg).(messages.MigrateSSHKeysRequest)
+
+	type migration struct {
+		result messages.SSHKeyMigrationResult
+		cipher models.Cipher
+	}
+	var migrations []migration
+	results := make([]messages.SSHKeyMigrationResult, 0)
+	for _, key := range vault.GetSSHKeys() {
+		note, err := vault.GetSecureNote(key.ID)
+		if err != nil {
+			// already a native ssh key
+			continue
+		}
+
+		result := messages.SSHKeyMigrationResult{
+			UUID: key.ID,
+			Name: key.Name,
+		}
+		if note.OrganizationID != nil && !note.Edit {
+			result.Status = messages.SSHKeyMigrationSkipped
+			result.Error = "no permission to edit this ssh key"
+			results = append(results, result)
+			continue
+		}
+
+		cipherKey, err := note.GetKeyForCipher(*vault.Keyring)
+		if err != nil {
+			result.Status = messages.SSHKeyMigrationFailed
+			result.Error = "could not get cipher key"
+			results = append(results, result)
+			continue
+		}
+		cipher, fingerprint, err := ssh.NativeSSHKeyCipher(note, key.Key, cipherKey)
+		if err != nil {
+			result.Status = messages.SSHKeyMigrationFailed
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		result.Fingerprint = fingerprint
+		migrations = append(migrations, migration{result: result, cipher: cipher})
+	}
+
+	if req.DryRun || len(migrations) == 0 {
+		for _, migration := range migrations {
+			migration.result.Status = messages.SSHKeyMigrationPending
+			results = append(results, migration.result)
+		}
+		return messages.IPCMessageFromPayload(messages.MigrateSSHKeysResponse{
+			DryRun:  req.DryRun,
+			Results: results,
+		})
+	}
+
+	policyRequest := policy.NewRequest(policy.ActionEditSSHKey, *ctx)
+	if !approve(ctx, cfg, policyRequest, "Approve SSH Key Migration", fmt.Sprintf("%s on %s>%s>%s is trying to convert %d ssh key notes to ssh key items", ctx.UserName, ctx.GrandParentProcessName, ctx.ParentProcessName, ctx.ProcessName, len(migrations))) {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "not approved",
+			Code:    messages.ErrorCodeNotApproved,
+		})
+	}
+
+	httpCtx := bitwarden.WithAuthentication(context.TODO(), cfg)
+	for _, migration := range migrations {
+		updatedCipher, err := bitwarden.PutCipher(httpCtx, migration.result.UUID, migration.cipher, cfg)
+		if err != nil {
+			actionsLog.Warn("Error migrating ssh key %s: %s", migration.result.UUID, err.Error())
+			migration.result.Status = messages.SSHKeyMigrationFailed
+			migration.result.Error = err.Error()
+		} else {
+			vault.DeleteCipher(migration.result.UUID)
+			vault.AddOrUpdateCipher(updatedCipher)
+			migration.result.Status = messages.SSHKeyMigrationMigrated
+		}
+		results = append(results, migration.result)
+	}
+
+	return messages.IPCMessageFromPayload(messages.MigrateSSHKeysResponse{
+		Results: results,
+	})
+}
+
 func init() {
 	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.CreateSSHKeyRequest{}), ensureEverything(systemauth.SSHKey, handleAddSSH))
 	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.GetSSHKeysRequest{}), ensureIsNotLocked(ensureIsLoggedIn(handleListSSH)))
 	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.ImportSSHKeyRequest{}), ensureEverything(systemauth.SSHKey, handleImportSSH))
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.SetSSHCertificateRequest{}), ensureEverything(systemauth.SSHKey, handleSetSSHCertificate))
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.ExportSSHKeysRequest{}), ensureIsNotLocked(ensureIsLoggedIn(handleExportSSH)))
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.MigrateSSHKeysRequest{}), ensureEverything(systemauth.SSHKey, handleMigrateSSHKeys))
 }
@@ -0,0 +1,126 @@
+package actions
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/quexten/goldwarden/cli/agent/accounts"
+	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/sockets"
+	"github.com/quexten/goldwarden/cli/agent/ssh"
+	"github.com/quexten/goldwarden/cli/agent/systemauth"
+	"github.com/quexten/goldwarden/cli/agent/vault"
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+)
+
+// ssh agent profiles are stored in the config of the default account, as they span all accounts
+func defaultAccountConfig() (*config.Config, bool) {
+	defaultAccount, ok := accounts.Get(accounts.DefaultAccount)
+	if !ok {
+		return nil, false
+	}
+	return defaultAccount.Config, true
+}
+
+func handleListSSHAgentProfiles(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	defaultCfg, ok := defaultAccountConfig()
+	if !ok {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "default account not found",
+		})
+	}
+
+	profiles := defaultCfg.SSHAgentProfiles()
+	result := make([]messages.SSHAgentProfile, 0, len(profiles))
+	for name, profile := range profiles {
+		result = append(result, messages.SSHAgentProfile{
+			Name:         name,
+			SocketPath:   profile.SocketPath,
+			Folders:      profile.Folders,
+			NamePatterns: profile.NamePatterns,
+			Fields:       profile.Fields,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return messages.IPCMessageFromPayload(messages.ListSSHAgentProfilesResponse{
+		Profiles: result,
+	})
+}
+
+func handleSetSSHAgentProfile(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(request).(messages.SetSSHAgentProfileRequest).Profile
+	defaultCfg, ok := defaultAccountConfig()
+	if !ok {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "default account not found",
+		})
+	}
+
+	if req.SocketPath == "" && defaultCfg.ConfigFile.RuntimeConfig.SSHAgentSocketPath != "" {
+		// e.g. ~/.goldwarden-ssh-agent-work.sock
+		mainSocketPath := defaultCfg.ConfigFile.RuntimeConfig.SSHAgentSocketPath
+		extension := filepath.Ext(mainSocketPath)
+		req.SocketPath = strings.TrimSuffix(mainSocketPath, extension) + "-" + req.Name + extension
+	}
+	err = defaultCfg.SetSSHAgentProfile(req.Name, config.SSHAgentProfile{
+		SocketPath:   req.SocketPath,
+		Folders:      req.Folders,
+		NamePatterns: req.NamePatterns,
+		Fields:       req.Fields,
+	})
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	ssh.UpdateProfiles(defaultCfg.SSHAgentProfiles())
+
+	return messages.IPCMessageFromPayload(messages.ActionResponse{
+		Success: true,
+		Message: "ssh agent profile " + req.Name + " listening on " + req.SocketPath,
+	})
+}
+
+func handleRemoveSSHAgentProfile(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(request).(messages.RemoveSSHAgentProfileRequest)
+	defaultCfg, ok := defaultAccountConfig()
+	if !ok {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "default account not found",
+		})
+	}
+
+	if _, ok := defaultCfg.SSHAgentProfiles()[req.Name]; !ok {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "ssh agent profile not found",
+			Code:    messages.ErrorCodeNotFound,
+		})
+	}
+	if err := defaultCfg.RemoveSSHAgentProfile(req.Name); err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+	ssh.UpdateProfiles(defaultCfg.SSHAgentProfiles())
+
+	return messages.IPCMessageFromPayload(messages.ActionResponse{
+		Success: true,
+		Message: "ssh agent profile " + req.Name + " removed",
+	})
+}
+
+func init() {
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.ListSSHAgentProfilesRequest{}), handleListSSHAgentProfiles)
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.SetSSHAgentProfileRequest{}), ensureBiometricsAuthorized(systemauth.SSHKey, handleSetSSHAgentProfile))
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.RemoveSSHAgentProfileRequest{}), ensureBiometricsAuthorized(systemauth.SSHKey, handleRemoveSSHAgentProfile))
+}
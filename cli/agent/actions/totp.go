@@ -0,0 +1,85 @@
+package actions
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/quexten/goldwarden/cli/agent/bitwarden/crypto"
+	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/sockets"
+	"github.com/quexten/goldwarden/cli/agent/systemauth"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/policy"
+	"github.com/quexten/goldwarden/cli/agent/totp"
+	"github.com/quexten/goldwarden/cli/agent/vault"
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+)
+
+func handleGetTOTP(request messages.IPCMessage, cfg *config.Config, vault *vault.Vault, ctx *sockets.CallingContext) (response messages.IPCMessage, err error) {
+	req := messages.ParsePayload(request).(messages.GetTOTPRequest)
+	login, err := vault.GetLoginByFilter(req.UUID, req.OrgId, req.Name, req.Username)
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "login not found",
+			Code:    messages.ErrorCodeNotFound,
+		})
+	}
+
+	if login.Login == nil || login.Login.Totp.IsNull() {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "login has no totp secret",
+		})
+	}
+
+	cipherKey, err := login.GetKeyForCipher(*vault.Keyring)
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "could not get cipher key",
+		})
+	}
+
+	name := decryptOrEmpty(login.Name, cipherKey)
+	if !approve(ctx, cfg, cipherPolicyRequest(policy.ActionGetTOTP, ctx, vault, login, name), "Approve Credential Access", fmt.Sprintf("%s on %s>%s>%s is trying to access a totp code for entry %s", ctx.UserName, ctx.GrandParentProcessName, ctx.ParentProcessName, ctx.ProcessName, name)) {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "not approved",
+			Code:    messages.ErrorCodeNotApproved,
+		})
+	}
+
+	seed, err := crypto.DecryptWith(login.Login.Totp, cipherKey)
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: "could not decrypt totp secret",
+		})
+	}
+
+	params, err := totp.ParseSeed(string(seed))
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	code, err := totp.GenerateCode(params, time.Now())
+	if err != nil {
+		return messages.IPCMessageFromPayload(messages.ActionResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+	}
+
+	return messages.IPCMessageFromPayload(messages.GetTOTPResponse{
+		Code:             code.Code,
+		Period:           code.Period,
+		SecondsRemaining: code.SecondsRemaining,
+	})
+}
+
+func init() {
+	AgentActionsRegistry.Register(messages.MessageTypeForEmptyPayload(messages.GetTOTPRequest{}), ensureEverything(systemauth.AccessVault, handleGetTOTP))
+}
@@ -58,15 +58,8 @@ func handleUnlockVault(request messages.IPCMessage, cfg *config.Config, vault *v
 		if err == nil {
 			if token.AccessToken != "" {
 				ctx := context.Background()
-				gotToken := bitwarden.RefreshToken(ctx, cfg)
-				if gotToken {
-					actionsLog.Info("Token refreshed")
-				} else {
-					actionsLog.Warn("Token refresh failed")
-				}
-				token, err := cfg.GetToken()
-				if err != nil {
-					actionsLog.Error("Could not get token: %s", err.Error())
+				if _, err := bitwarden.TokenManagerFor(cfg).GetValidToken(ctx); err != nil {
+					actionsLog.Warn("Token refresh failed: %s", err.Error())
 				}
 				userSymmkey, err := cfg.GetUserSymmetricKey()
 				if err != nil {
@@ -83,7 +76,7 @@ func handleUnlockVault(request messages.IPCMessage, cfg *config.Config, vault *v
 					actionsLog.Error("Could not create safe user symmetric key: %s", err.Error())
 				}
 
-				err = bitwarden.DoFullSync(context.WithValue(ctx, bitwarden.AuthToken{}, token.AccessToken), vault, cfg, &safeUserSymmkey, true)
+				err = bitwarden.DoFullSync(bitwarden.WithAuthentication(ctx, cfg), vault, cfg, &safeUserSymmkey, true)
 				if err != nil {
 					actionsLog.Error("Could not sync: %s", err.Error())
 				}
@@ -255,7 +248,11 @@ func handleVaultStatus(request messages.IPCMessage, cfg *config.Config, vault *v
 	vaultStatus.Locked = cfg.IsLocked()
 	vaultStatus.NumberOfLogins = len(vault.GetLogins())
 	vaultStatus.NumberOfNotes = len(vault.GetNotes())
+	vaultStatus.NumberOfCards = len(vault.GetCards())
+	vaultStatus.NumberOfIdentities = len(vault.GetIdentities())
+	vaultStatus.NumberOfSSHKeys = len(vault.GetSSHKeyCiphers())
 	vaultStatus.LastSynced = vault.GetLastSynced()
+	vaultStatus.LoadedFromCache = vault.IsLoadedFromCache()
 	vaultStatus.WebsocketConnected = vault.IsWebsocketConnected()
 	vaultStatus.PinSet = cfg.HasPin()
 	vaultStatus.LoggedIn = cfg.IsLoggedIn()
@@ -0,0 +1,360 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quexten/goldwarden/cli/agent/sockets"
+	"github.com/quexten/goldwarden/cli/logging"
+)
+
+var log = logging.GetLogger("Goldwarden", "Audit")
+
+const (
+	ActionGetLogin          = "get-login"
+	ActionListLogins        = "list-logins"
+	ActionGetCLICredentials = "get-cli-credentials"
+	ActionBrowserBiometrics = "browser-biometrics"
+	ActionSSHSign           = "ssh-sign"
+	ActionGitSign           = "git-sign"
+	ActionAuthorize         = "authorize"
+	// starts a new chain after the key changed, e.g. after a logout
+	ActionChainReset = "chain-reset"
+
+	DecisionApproved = "approved"
+	DecisionDenied   = "denied"
+
+	genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+	// records logged before the vault is first unlocked are kept in memory until the key is known
+	maxPendingRecords = 1000
+)
+
+type Record struct {
+	Sequence               uint64    `json:"sequence"`
+	Time                   time.Time `json:"time"`
+	Action                 string    `json:"action"`
+	CipherID               string    `json:"cipherId,omitempty"`
+	Detail                 string    `json:"detail,omitempty"`
+	Decision               string    `json:"decision"`
+	Method                 string    `json:"method"`
+	UserName               string    `json:"userName"`
+	ProcessName            string    `json:"processName"`
+	ProcessPath            string    `json:"processPath,omitempty"`
+	ParentProcessName      string    `json:"parentProcessName"`
+	GrandParentProcessName string    `json:"grandParentProcessName"`
+	ProcessPid             int       `json:"processPid"`
+	ParentProcessPid       int       `json:"parentProcessPid"`
+	GrandParentProcessPid  int       `json:"grandParentProcessPid"`
+	PreviousHash           string    `json:"previousHash"`
+	Hash                   string    `json:"hash"`
+}
+
+type auditLog struct {
+	path         string
+	key          []byte
+	lastSequence uint64
+	lastHash     string
+	pending      []Record
+	mu           sync.Mutex
+}
+
+var current = auditLog{}
+
+// computeHash returns the hmac of the record, so that the chain cannot be
+// recomputed after editing the log without the key
+func (record Record) computeHash(key []byte) (string, error) {
+	record.Hash = ""
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// headMAC authenticates the head, so that it cannot be pointed at an earlier record
+// of a truncated log
+func headMAC(key []byte, sequence uint64, hash string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("head " + strconv.FormatUint(sequence, 10) + " " + hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func headPath(logPath string) string {
+	return logPath + ".head"
+}
+
+// Init sets the log file and restores the end of the hash chain from its head file.
+func Init(logPath string) {
+	current.mu.Lock()
+	defer current.mu.Unlock()
+
+	current.path = logPath
+	current.key = nil
+	current.lastSequence = 0
+	current.lastHash = genesisHash
+	current.pending = nil
+
+	sequence, hash, _, err := readHead(logPath)
+	if err == nil {
+		current.lastSequence = sequence
+		current.lastHash = hash
+		return
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		log.Warn("Could not read audit log head: %s", err.Error())
+	}
+
+	// head missing, continue the chain from the log itself
+	records, err := Read(logPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warn("Could not read audit log: %s", err.Error())
+		return
+	}
+	if len(records) > 0 {
+		current.lastSequence = records[len(records)-1].Sequence
+		current.lastHash = records[len(records)-1].Hash
+	}
+}
+
+// SetKey sets the key of the hash chain and writes the records logged before it was known.
+func SetKey(key []byte) {
+	current.mu.Lock()
+	defer current.mu.Unlock()
+
+	if current.key != nil && hmac.Equal(current.key, key) {
+		return
+	}
+	current.key = key
+
+	if current.lastSequence > 0 && !chainMatchesKey(current.path, key) {
+		lastSequence := current.lastSequence
+		current.lastHash = genesisHash
+		err := writeRecord(Record{
+			Time:   time.Now().UTC(),
+			Action: ActionChainReset,
+			Detail: fmt.Sprintf("audit key changed, records up to %d were written with another key", lastSequence),
+		})
+		if err != nil {
+			log.Error("Could not write audit record: %s", err.Error())
+		}
+	}
+
+	pending := current.pending
+	current.pending = nil
+	for _, record := range pending {
+		if err := writeRecord(record); err != nil {
+			log.Error("Could not write audit record: %s", err.Error())
+		}
+	}
+}
+
+// chainMatchesKey reports whether the end of the log was written with the given key.
+func chainMatchesKey(logPath string, key []byte) bool {
+	sequence, hash, mac, err := readHead(logPath)
+	if err == nil {
+		return hmac.Equal([]byte(mac), []byte(headMAC(key, sequence, hash)))
+	}
+
+	records, err := Read(logPath)
+	if err != nil || len(records) == 0 {
+		return err == nil
+	}
+	last := records[len(records)-1]
+	lastHash, err := last.computeHash(key)
+	return err == nil && hmac.Equal([]byte(lastHash), []byte(last.Hash))
+}
+
+func Path() string {
+	current.mu.Lock()
+	defer current.mu.Unlock()
+
+	return current.path
+}
+
+func Log(action string, ctx sockets.CallingContext, cipherID string, detail string, approved bool, method string) {
+	decision := DecisionDenied
+	if approved {
+		decision = DecisionApproved
+	}
+
+	err := appendRecord(Record{
+		Time:                   time.Now().UTC(),
+		Action:                 action,
+		CipherID:               cipherID,
+		Detail:                 detail,
+		Decision:               decision,
+		Method:                 method,
+		UserName:               ctx.UserName,
+		ProcessName:            ctx.ProcessName,
+		ProcessPath:            ctx.ProcessPath,
+		ParentProcessName:      ctx.ParentProcessName,
+		GrandParentProcessName: ctx.GrandParentProcessName,
+		ProcessPid:             ctx.ProcessPid,
+		ParentProcessPid:       ctx.ParentProcessPid,
+		GrandParentProcessPid:  ctx.GrandParentProcessPid,
+	})
+	if err != nil {
+		log.Error("Could not write audit record: %s", err.Error())
+	}
+}
+
+func appendRecord(record Record) error {
+	current.mu.Lock()
+	defer current.mu.Unlock()
+
+	if current.path == "" {
+		return errors.New("audit log not initialized")
+	}
+	if current.key == nil {
+		if len(current.pending) >= maxPendingRecords {
+			return errors.New("audit key not available, vault was not unlocked yet")
+		}
+		current.pending = append(current.pending, record)
+		return nil
+	}
+	return writeRecord(record)
+}
+
+func writeRecord(record Record) error {
+	record.Sequence = current.lastSequence + 1
+	record.PreviousHash = current.lastHash
+	hash, err := record.computeHash(current.key)
+	if err != nil {
+		return err
+	}
+	record.Hash = hash
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(current.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	current.lastSequence = record.Sequence
+	current.lastHash = record.Hash
+	return writeHead(current.path, current.key, record.Sequence, record.Hash)
+}
+
+func writeHead(logPath string, key []byte, sequence uint64, hash string) error {
+	head := strconv.FormatUint(sequence, 10) + " " + hash + " " + headMAC(key, sequence, hash) + "\n"
+	return os.WriteFile(headPath(logPath), []byte(head), 0600)
+}
+
+func readHead(logPath string) (uint64, string, string, error) {
+	data, err := os.ReadFile(headPath(logPath))
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	parts := strings.Fields(string(data))
+	if len(parts) != 3 {
+		return 0, "", "", errors.New("invalid audit log head")
+	}
+	sequence, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", "", errors.New("invalid audit log head")
+	}
+	return sequence, parts[1], parts[2], nil
+}
+
+func Read(logPath string) ([]Record, error) {
+	file, err := os.Open(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := make([]Record, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return records, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// Verify checks the hash chain of the log and compares its end against the head file,
+// which detects edited, removed, reordered and truncated records. Records before the last
+// chain reset were written with an earlier key and are not verified, the number of verified
+// records is returned.
+func Verify(logPath string, key []byte) (int, error) {
+	records, err := Read(logPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return len(records), err
+	}
+
+	previousHash := genesisHash
+	var previousSequence uint64 = 0
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Action == ActionChainReset {
+			previousSequence = records[i].Sequence - 1
+			records = records[i:]
+			break
+		}
+	}
+	for _, record := range records {
+		if record.Sequence != previousSequence+1 {
+			return len(records), fmt.Errorf("record %d: expected sequence %d", record.Sequence, previousSequence+1)
+		}
+		if record.PreviousHash != previousHash {
+			return len(records), fmt.Errorf("record %d: chain broken, previous record was modified or removed", record.Sequence)
+		}
+		hash, err := record.computeHash(key)
+		if err != nil {
+			return len(records), err
+		}
+		if !hmac.Equal([]byte(hash), []byte(record.Hash)) {
+			return len(records), fmt.Errorf("record %d: hash mismatch, record was modified", record.Sequence)
+		}
+		previousHash = record.Hash
+		previousSequence = record.Sequence
+	}
+
+	headSequence, headHash, mac, err := readHead(logPath)
+	if errors.Is(err, os.ErrNotExist) {
+		if len(records) > 0 {
+			return len(records), errors.New("head file is missing")
+		}
+		return 0, nil
+	} else if err != nil {
+		return len(records), err
+	}
+	if !hmac.Equal([]byte(mac), []byte(headMAC(key, headSequence, headHash))) {
+		return len(records), errors.New("head file was modified")
+	}
+	if headSequence != previousSequence || headHash != previousHash {
+		return len(records), fmt.Errorf("log ends at record %d but head points to record %d, log was truncated", previousSequence, headSequence)
+	}
+
+	return len(records), nil
+}
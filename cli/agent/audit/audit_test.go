@@ -0,0 +1,207 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/quexten/goldwarden/cli/agent/sockets"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func newTestLog(t *testing.T, records int) string {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	Init(logPath)
+	SetKey(testKey)
+
+	ctx := sockets.CallingContext{UserName: "alice", ProcessName: "ssh", ProcessPid: 42}
+	for i := 0; i < records; i++ {
+		Log(ActionSSHSign, ctx, "key", "", i%2 == 0, "policy")
+	}
+	if count, err := Verify(logPath, testKey); err != nil || count != records {
+		t.Fatalf("fresh log: got %d records, %v", count, err)
+	}
+	return logPath
+}
+
+func writeRecords(t *testing.T, logPath string, records []Record) {
+	var data bytes.Buffer
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data.Write(append(line, '\n'))
+	}
+	if err := os.WriteFile(logPath, data.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readRecords(t *testing.T, logPath string) []Record {
+	records, err := Read(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func expectInvalid(t *testing.T, logPath string, reason string) {
+	t.Helper()
+	if _, err := Verify(logPath, testKey); err == nil {
+		t.Fatal("expected verification to fail")
+	} else if !strings.Contains(err.Error(), reason) {
+		t.Fatalf("expected %q, got %q", reason, err.Error())
+	}
+}
+
+func TestVerifyWrongKey(t *testing.T) {
+	logPath := newTestLog(t, 3)
+	if _, err := Verify(logPath, []byte("another key")); err == nil {
+		t.Fatal("expected verification with another key to fail")
+	}
+}
+
+func TestVerifyTamperedRecord(t *testing.T) {
+	logPath := newTestLog(t, 3)
+	records := readRecords(t, logPath)
+	records[1].Decision = DecisionApproved
+	writeRecords(t, logPath, records)
+
+	expectInvalid(t, logPath, "record 2: hash mismatch")
+}
+
+func TestVerifyTamperedRecordWithRecomputedChain(t *testing.T) {
+	logPath := newTestLog(t, 3)
+	records := readRecords(t, logPath)
+
+	// without the key, the attacker can only recompute the chain with a key of their own
+	forgedKey := []byte("forged")
+	records[1].ProcessName = "bash"
+	for i := 1; i < len(records); i++ {
+		records[i].PreviousHash = records[i-1].Hash
+		hash, err := records[i].computeHash(forgedKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records[i].Hash = hash
+	}
+	writeRecords(t, logPath, records)
+
+	expectInvalid(t, logPath, "record 2: hash mismatch")
+}
+
+func TestVerifyRemovedRecord(t *testing.T) {
+	logPath := newTestLog(t, 3)
+	records := readRecords(t, logPath)
+	writeRecords(t, logPath, append(records[:1], records[2:]...))
+
+	expectInvalid(t, logPath, "expected sequence 2")
+}
+
+func TestVerifyTruncatedLog(t *testing.T) {
+	logPath := newTestLog(t, 3)
+	records := readRecords(t, logPath)
+	writeRecords(t, logPath, records[:2])
+
+	expectInvalid(t, logPath, "log was truncated")
+}
+
+func TestVerifyTruncatedLogWithRewrittenHead(t *testing.T) {
+	logPath := newTestLog(t, 3)
+	records := readRecords(t, logPath)
+	writeRecords(t, logPath, records[:2])
+
+	last := records[1]
+	head := []byte("2 " + last.Hash + " " + headMAC([]byte("forged"), 2, last.Hash) + "\n")
+	if err := os.WriteFile(headPath(logPath), head, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	expectInvalid(t, logPath, "head file was modified")
+}
+
+func TestVerifyMissingHead(t *testing.T) {
+	logPath := newTestLog(t, 1)
+	if err := os.Remove(headPath(logPath)); err != nil {
+		t.Fatal(err)
+	}
+
+	expectInvalid(t, logPath, "head file is missing")
+}
+
+func TestRecordsBeforeKeyArePending(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	Init(logPath)
+
+	Log(ActionGetLogin, sockets.CallingContext{}, "cipher", "", false, "biometrics")
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Fatal("record was written without a key")
+	}
+
+	SetKey(testKey)
+	if count, err := Verify(logPath, testKey); err != nil || count != 1 {
+		t.Fatalf("got %d records, %v", count, err)
+	}
+}
+
+func TestChainContinuesAfterRestart(t *testing.T) {
+	logPath := newTestLog(t, 2)
+
+	Init(logPath)
+	SetKey(testKey)
+	Log(ActionGitSign, sockets.CallingContext{}, "key", "", true, "policy")
+
+	if count, err := Verify(logPath, testKey); err != nil || count != 3 {
+		t.Fatalf("got %d records, %v", count, err)
+	}
+}
+
+func TestChainResetAfterKeyChange(t *testing.T) {
+	logPath := newTestLog(t, 2)
+	newKey := []byte("fedcba9876543210fedcba9876543210")
+
+	Init(logPath)
+	Log(ActionGetLogin, sockets.CallingContext{}, "cipher", "", true, "biometrics")
+	SetKey(newKey)
+
+	records := readRecords(t, logPath)
+	if len(records) != 4 || records[2].Action != ActionChainReset || records[2].Sequence != 3 {
+		t.Fatalf("expected a chain reset record after the old records, got %+v", records)
+	}
+	if count, err := Verify(logPath, newKey); err != nil || count != 2 {
+		t.Fatalf("got %d verified records, %v", count, err)
+	}
+	if _, err := Verify(logPath, testKey); err == nil {
+		t.Fatal("log verified with the old key after the reset")
+	}
+
+	// the same key again continues the chain
+	SetKey(newKey)
+	Init(logPath)
+	SetKey(newKey)
+	Log(ActionGitSign, sockets.CallingContext{}, "key", "", true, "policy")
+	if count, err := Verify(logPath, newKey); err != nil || count != 3 {
+		t.Fatalf("got %d verified records, %v", count, err)
+	}
+}
+
+func TestForgedChainResetIsRejected(t *testing.T) {
+	logPath := newTestLog(t, 3)
+	records := readRecords(t, logPath)
+
+	// a reset record needs the key like any other record
+	forged := Record{Sequence: 4, Action: ActionChainReset, PreviousHash: genesisHash}
+	hash, err := forged.computeHash([]byte("forged"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged.Hash = hash
+	writeRecords(t, logPath, append(records, forged))
+
+	expectInvalid(t, logPath, "record 4: hash mismatch")
+}
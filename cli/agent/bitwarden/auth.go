@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/url"
@@ -37,6 +38,12 @@ type preLoginResponse struct {
 	KDFParallelism int
 }
 
+// TwoFactorMethod is the context key of the preferred two-factor method
+type TwoFactorMethod struct{}
+
+const maxTwoFactorAttempts = 3
+const maxTwoFactorEmailResends = 3
+
 type LoginResponseToken struct {
 	AccessToken    string `json:"access_token"`
 	ExpiresIn      int    `json:"expires_in"`
@@ -47,6 +54,7 @@ type LoginResponseToken struct {
 	KdfIterations  int    `json:"KdfIterations"`
 	KdfMemory      int    `json:"KdfMemory"`
 	KdfParallelism int    `json:"KdfParallelism"`
+	TwoFactorToken string `json:"TwoFactorToken"`
 }
 
 const (
@@ -344,18 +352,128 @@ func Perform2FA(values url.Values, errsc *errStatusCode, cfg *config.Config, ctx
 	if err := json.Unmarshal(errsc.body, &twoFactor); err != nil {
 		return LoginResponseToken{}, err
 	}
-	provider, token, err := twofactor.PerformSecondFactor(&twoFactor, cfg)
+
+	if loginResponseToken, err := loginWithRememberedTwoFactor(values, cfg, ctx); err == nil {
+		authLog.Info("2FA login successful using remembered device")
+		return loginResponseToken, nil
+	}
+
+	method, _ := ctx.Value(TwoFactorMethod{}).(string)
+	provider, err := twofactor.ChooseProvider(&twoFactor, method)
 	if err != nil {
-		return LoginResponseToken{}, fmt.Errorf("could not obtain two-factor auth token: %v", err)
+		return LoginResponseToken{}, fmt.Errorf("could not choose two-factor method: %v", err)
+	}
+	// the server only sends the email on its own if it is the only provider
+	if provider == twofactor.Email && len(twoFactor.TwoFactorProviders2) > 1 {
+		if err := sendTwoFactorEmail(ctx, values, cfg); err != nil {
+			authLog.Warn("Could not send two-factor email: %s", err.Error())
+		}
+	}
+
+	invalid := false
+	resends := 0
+	for attempt := 1; attempt <= maxTwoFactorAttempts; {
+		token, err := twofactor.GetToken(provider, &twoFactor, cfg, invalid)
+		if errors.Is(err, twofactor.ErrResendEmail) {
+			if resends >= maxTwoFactorEmailResends {
+				return LoginResponseToken{}, errors.New("too many two-factor email resends")
+			}
+			resends++
+			if err := sendTwoFactorEmail(ctx, values, cfg); err != nil {
+				return LoginResponseToken{}, fmt.Errorf("could not send two-factor email: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			return LoginResponseToken{}, fmt.Errorf("could not obtain two-factor auth token: %v", err)
+		}
+
+		values.Set("twoFactorProvider", strconv.Itoa(int(provider)))
+		values.Set("twoFactorToken", string(token))
+		values.Set("twoFactorRemember", "1")
+		loginResponseToken := LoginResponseToken{}
+		err = authenticatedHTTPPost(ctx, cfg.ConfigFile.IdentityUrl+"/connect/token", &loginResponseToken, values)
+		if errsc, ok := err.(*errStatusCode); ok && bytes.Contains(errsc.body, []byte("Two-step token is invalid")) && attempt < maxTwoFactorAttempts {
+			authLog.Warn("Invalid two-factor token, %d attempts left", maxTwoFactorAttempts-attempt)
+			invalid = true
+			attempt++
+			continue
+		}
+		if err != nil {
+			return LoginResponseToken{}, fmt.Errorf("could not login via two-factor: %v", err)
+		}
+
+		if loginResponseToken.TwoFactorToken != "" {
+			if err := cfg.SetTwoFactorToken(loginResponseToken.TwoFactorToken); err != nil {
+				authLog.Warn("Could not store remembered two-factor token: %s", err.Error())
+			}
+		}
+		authLog.Info("2FA login successful")
+		return loginResponseToken, nil
 	}
-	values.Set("twoFactorProvider", strconv.Itoa(int(provider)))
-	values.Set("twoFactorToken", string(token))
-	values.Set("twoFactorRemember", "1")
+	return LoginResponseToken{}, errors.New("too many invalid two-factor attempts")
+}
+
+type sendTwoFactorEmailRequest struct {
+	Email                 string `json:"email"`
+	MasterPasswordHash    string `json:"masterPasswordHash,omitempty"`
+	AuthRequestID         string `json:"authRequestId,omitempty"`
+	AuthRequestAccessCode string `json:"authRequestAccessCode,omitempty"`
+	DeviceIdentifier      string `json:"deviceIdentifier"`
+}
+
+// sendTwoFactorEmail asks the server to email a two-factor code, authenticating
+// with the credentials of the pending login.
+func sendTwoFactorEmail(ctx context.Context, values url.Values, cfg *config.Config) error {
+	request := sendTwoFactorEmailRequest{
+		Email:            values.Get("username"),
+		DeviceIdentifier: cfg.ConfigFile.DeviceUUID,
+	}
+	if authRequestID := values.Get("authRequest"); authRequestID != "" {
+		request.AuthRequestID = authRequestID
+		request.AuthRequestAccessCode = values.Get("password")
+	} else {
+		request.MasterPasswordHash = values.Get("password")
+	}
+
+	var response interface{}
+	if err := authenticatedHTTPPost(ctx, cfg.ConfigFile.ApiUrl+"/two-factor/send-email-login", &response, request); err != nil {
+		return err
+	}
+	authLog.Info("Two-factor email sent")
+	return nil
+}
+
+// loginWithRememberedTwoFactor replays the token the server returned on an earlier
+// two-factor login, clearing it once the server no longer accepts it.
+func loginWithRememberedTwoFactor(values url.Values, cfg *config.Config, ctx context.Context) (LoginResponseToken, error) {
+	rememberedToken, err := cfg.GetTwoFactorToken()
+	if err != nil {
+		return LoginResponseToken{}, err
+	}
+	if rememberedToken == "" {
+		return LoginResponseToken{}, errors.New("no remembered two-factor token")
+	}
+
+	rememberValues := make(url.Values)
+	for key, value := range values {
+		rememberValues[key] = value
+	}
+	rememberValues.Set("twoFactorProvider", strconv.Itoa(int(twofactor.Remember)))
+	rememberValues.Set("twoFactorToken", rememberedToken)
+	rememberValues.Set("twoFactorRemember", "0")
+
 	loginResponseToken := LoginResponseToken{}
-	if err := authenticatedHTTPPost(ctx, cfg.ConfigFile.IdentityUrl+"/connect/token", &loginResponseToken, values); err != nil {
-		return LoginResponseToken{}, fmt.Errorf("could not login via two-factor: %v", err)
+	err = authenticatedHTTPPost(ctx, cfg.ConfigFile.IdentityUrl+"/connect/token", &loginResponseToken, rememberValues)
+	if errsc, ok := err.(*errStatusCode); ok && bytes.Contains(errsc.body, []byte("TwoFactor")) {
+		authLog.Info("Remembered two-factor token is no longer valid")
+		if err := cfg.SetTwoFactorToken(""); err != nil {
+			authLog.Warn("Could not clear remembered two-factor token: %s", err.Error())
+		}
+	}
+	if err != nil {
+		return LoginResponseToken{}, err
 	}
-	authLog.Info("2FA login successful")
 	return loginResponseToken, nil
 }
 
@@ -13,6 +13,21 @@ func PostCipher(ctx context.Context, cipher models.Cipher, cfg *config.Config) (
 	return resultingCipher, err
 }
 
+type cipherCreateRequest struct {
+	Cipher        models.Cipher `json:"cipher"`
+	CollectionIDs []string      `json:"collectionIds"`
+}
+
+// PostCipherToCollections creates an organization owned cipher, which the server only accepts with at least one collection.
+func PostCipherToCollections(ctx context.Context, cipher models.Cipher, collectionIDs []string, cfg *config.Config) (models.Cipher, error) {
+	var resultingCipher models.Cipher
+	err := authenticatedHTTPPost(ctx, cfg.ConfigFile.ApiUrl+"/ciphers/create", &resultingCipher, cipherCreateRequest{
+		Cipher:        cipher,
+		CollectionIDs: collectionIDs,
+	})
+	return resultingCipher, err
+}
+
 func GetCipher(ctx context.Context, uuid string, cfg *config.Config) (models.Cipher, error) {
 	var cipher models.Cipher
 	err := authenticatedHTTPGet(ctx, cfg.ConfigFile.ApiUrl+"/ciphers/"+uuid, &cipher)
@@ -25,8 +40,20 @@ func DeleteCipher(ctx context.Context, uuid string, cfg *config.Config) error {
 	return err
 }
 
+func SoftDeleteCipher(ctx context.Context, uuid string, cfg *config.Config) error {
+	var result interface{}
+	err := authenticatedHTTPPut(ctx, cfg.ConfigFile.ApiUrl+"/ciphers/"+uuid+"/delete", &result, nil)
+	return err
+}
+
 func PutCipher(ctx context.Context, uuid string, cipher models.Cipher, cfg *config.Config) (models.Cipher, error) {
 	var resultingCipher models.Cipher
 	err := authenticatedHTTPPut(ctx, cfg.ConfigFile.ApiUrl+"/ciphers/"+uuid, &resultingCipher, cipher)
 	return resultingCipher, err
 }
+
+func GetFolder(ctx context.Context, uuid string, cfg *config.Config) (models.Folder, error) {
+	var folder models.Folder
+	err := authenticatedHTTPGet(ctx, cfg.ConfigFile.ApiUrl+"/folders/"+uuid, &folder)
+	return folder, err
+}
@@ -92,7 +92,7 @@ func (s *EncString) UnmarshalText(data []byte) error {
 }
 
 func (s EncString) MarshalText() ([]byte, error) {
-	if s.Type == 0 {
+	if s.Type == 0 && s.IsNull() {
 		return nil, nil
 	}
 
@@ -5,17 +5,21 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 )
 
-var httpClient = &http.Client{
-	Timeout: 20 * time.Second,
-}
+const (
+	minRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff = 10 * time.Second
+)
 
 type errStatusCode struct {
 	code int
@@ -26,6 +30,7 @@ func (e *errStatusCode) Error() string {
 	return fmt.Sprintf("%s: %s", http.StatusText(e.code), e.body)
 }
 
+// AuthToken is the context key of the TokenManager authenticating api requests
 type AuthToken struct{}
 
 func authenticatedHTTPPost(ctx context.Context, urlstr string, recv, send interface{}) error {
@@ -94,27 +99,51 @@ func authenticatedHTTPPut(ctx context.Context, urlstr string, recv, send interfa
 }
 
 func makeAuthenticatedHTTPRequest(ctx context.Context, req *http.Request, recv interface{}) error {
-	if token, ok := ctx.Value(AuthToken{}).(string); ok {
+	tokenManager, _ := ctx.Value(AuthToken{}).(*TokenManager)
+	if tokenManager != nil {
+		token, err := tokenManager.GetValidToken(ctx)
+		if err != nil {
+			return err
+		}
 		req.Header.Set("Authorization", "Bearer "+token)
 	}
 	req.Header.Set("Accept", "*/*")
-    req.Header.Set("Accept-Language", "en-US,en;q=0.5")
+	req.Header.Set("Accept-Language", "en-US,en;q=0.5")
 	req.Header.Set("User-Agent", "Goldwarden (github.com/quexten/goldwarden)")
 	req.Header.Set("Device-Type", "10")
 	req.Header.Set("Bitwarden-Client-Name", "goldwarden")
 	req.Header.Set("Bitwarden-Client-Version", "0.0.0")
 
-	res, err := httpClient.Do(req)
+	statusCode, body, err := doHTTPRequest(ctx, req)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return err
+	if statusCode == http.StatusUnauthorized && tokenManager != nil {
+		// the token may have been revoked or expired early, refresh it once and retry
+		log.Info("Request was unauthorized, refreshing token and retrying")
+		if err := tokenManager.Refresh(ctx); err != nil {
+			return &errStatusCode{statusCode, body}
+		}
+		token, err := tokenManager.GetValidToken(ctx)
+		if err != nil {
+			return err
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return err
+			}
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		if statusCode, body, err = doHTTPRequest(ctx, req); err != nil {
+			return err
+		}
 	}
-	if res.StatusCode != 200 {
-		return &errStatusCode{res.StatusCode, body}
+	if statusCode != 200 {
+		return &errStatusCode{statusCode, body}
+	}
+	if len(body) == 0 {
+		// e.g. deletions do not return a body
+		return nil
 	}
 	if err := json.Unmarshal(body, recv); err != nil {
 		fmt.Println(string(body))
@@ -122,3 +151,71 @@ func makeAuthenticatedHTTPRequest(ctx context.Context, req *http.Request, recv i
 	}
 	return nil
 }
+
+// doHTTPRequest sends the request, retrying with jittered backoff on network and
+// server errors. Requests that are not idempotent are only retried if they
+// cannot have reached the server.
+func doHTTPRequest(ctx context.Context, req *http.Request) (int, []byte, error) {
+	client, maxRetries := currentHTTPClient()
+	idempotent := req.Method != http.MethodPost
+
+	for attempt := 0; ; attempt++ {
+		statusCode, body, err := sendHTTPRequest(client, req)
+		retryable := false
+		if err != nil {
+			var opErr *net.OpError
+			retryable = idempotent || (errors.As(err, &opErr) && opErr.Op == "dial")
+		} else if statusCode >= 500 {
+			retryable = idempotent || statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable || statusCode == http.StatusGatewayTimeout
+		}
+		if !retryable || attempt >= maxRetries {
+			return statusCode, body, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return statusCode, body, err
+		}
+
+		backoff := retryBackoff(attempt)
+		if err != nil {
+			log.Warn("Request to %s failed: %s, retrying in %s", req.URL.Host, err.Error(), backoff)
+		} else {
+			log.Warn("Request to %s failed with status %d, retrying in %s", req.URL.Host, statusCode, backoff)
+		}
+		select {
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+}
+
+func retryBackoff(attempt int) time.Duration {
+	return jitteredBackoff(attempt, minRetryBackoff, maxRetryBackoff)
+}
+
+// jitteredBackoff doubles with every attempt, jittered to avoid retrying in lockstep
+func jitteredBackoff(attempt int, minBackoff time.Duration, maxBackoff time.Duration) time.Duration {
+	backoff := maxBackoff
+	if attempt < 32 {
+		backoff = min(minBackoff<<attempt, maxBackoff)
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+func sendHTTPRequest(client *http.Client, req *http.Request) (int, []byte, error) {
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return res.StatusCode, body, nil
+}
@@ -0,0 +1,105 @@
+package bitwarden
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/quexten/goldwarden/cli/agent/config"
+)
+
+const httpTimeout = 20 * time.Second
+
+var httpClientMu sync.RWMutex
+var httpClient = &http.Client{
+	Timeout: httpTimeout,
+}
+var httpMaxRetries = config.DefaultHTTPRetries
+var websocketDialer = websocket.DefaultDialer
+
+// ConfigureHTTPClient applies the tls, proxy and retry settings to all api and
+// websocket connections made afterwards.
+func ConfigureHTTPClient(settings config.HTTPSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	tlsConfig, err := newTLSConfig(settings)
+	if err != nil {
+		return err
+	}
+	proxy := http.ProxyFromEnvironment
+	if settings.Proxy != "" {
+		proxyURL, err := url.Parse(settings.Proxy)
+		if err != nil {
+			return err
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = proxy
+
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = tlsConfig
+	dialer.Proxy = proxy
+
+	httpClientMu.Lock()
+	defer httpClientMu.Unlock()
+	httpClient = &http.Client{
+		Timeout:   httpTimeout,
+		Transport: transport,
+	}
+	httpMaxRetries = settings.MaxRetries()
+	websocketDialer = &dialer
+	return nil
+}
+
+func newTLSConfig(settings config.HTTPSettings) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if settings.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		bundle, err := os.ReadFile(settings.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, errors.New("no certificates found in " + settings.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if settings.ClientCertificate != "" {
+		certificate, err := tls.LoadX509KeyPair(settings.ClientCertificate, settings.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+func currentHTTPClient() (*http.Client, int) {
+	httpClientMu.RLock()
+	defer httpClientMu.RUnlock()
+	return httpClient, httpMaxRetries
+}
+
+func currentWebsocketDialer() *websocket.Dialer {
+	httpClientMu.RLock()
+	defer httpClientMu.RUnlock()
+	return websocketDialer
+}
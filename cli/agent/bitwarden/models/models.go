@@ -8,9 +8,10 @@ import (
 )
 
 type SyncData struct {
-	Profile Profile  `json:"profile"`
-	Folders []Folder `json:"folders"`
-	Ciphers []Cipher `json:"ciphers"`
+	Profile     Profile      `json:"profile"`
+	Folders     []Folder     `json:"folders"`
+	Collections []Collection `json:"collections"`
+	Ciphers     []Cipher     `json:"ciphers"`
 }
 
 type Organization struct {
@@ -50,9 +51,18 @@ type Profile struct {
 }
 
 type Folder struct {
-	ID           uuid.UUID `json:"id"`
-	Name         string    `json:"name"`
-	RevisionDate time.Time `json:"revisionDate"`
+	ID           uuid.UUID        `json:"id"`
+	Name         crypto.EncString `json:"name"`
+	RevisionDate time.Time        `json:"revisionDate"`
+}
+
+type Collection struct {
+	ID             uuid.UUID        `json:"id"`
+	OrganizationID uuid.UUID        `json:"organizationId"`
+	Name           crypto.EncString `json:"name"`
+	ExternalID     string           `json:"externalId"`
+	ReadOnly       bool             `json:"readOnly"`
+	HidePasswords  bool             `json:"hidePasswords"`
 }
 
 type Cipher struct {
@@ -76,9 +86,9 @@ type Cipher struct {
 	Login      *LoginCipher      `json:"login,omitempty"`
 	Notes      *crypto.EncString `json:"notes,omitempty"`
 	SecureNote *SecureNoteCipher `json:"secureNote,omitempty"`
-	SSHKey *SSHKeyCipher `json:"sshKey,omitempty"`
+	SSHKey     *SSHKeyCipher     `json:"sshKey,omitempty"`
 
-  Key *crypto.EncString `json:"key,omitempty"`
+	Key *crypto.EncString `json:"key,omitempty"`
 }
 
 type CipherType int
@@ -89,13 +99,15 @@ const (
 	CipherCard                = 3
 	CipherIdentity            = 4
 	CipherNote                = 2
-	CipherSSHKey			  = 5
+	CipherSSHKey              = 5
 )
 
 type SSHKeyCipher struct {
-	PrivateKey crypto.EncString `json:"privateKey"`
-	PublicKey  crypto.EncString `json:"publicKey"`
+	PrivateKey     crypto.EncString `json:"privateKey"`
+	PublicKey      crypto.EncString `json:"publicKey"`
 	KeyFingerprint crypto.EncString `json:"keyFingerprint"`
+	// OpenSSH certificate for the key, in authorized_keys format
+	Certificate *crypto.EncString `json:"certificate,omitempty"`
 }
 
 type Card struct {
@@ -131,6 +143,14 @@ type Identity struct {
 }
 
 type FieldType int
+
+const (
+	FieldTypeText    FieldType = 0
+	FieldTypeHidden  FieldType = 1
+	FieldTypeBoolean FieldType = 2
+	FieldTypeLinked  FieldType = 3
+)
+
 type Field struct {
 	Type  FieldType        `json:"type,omitempty"`
 	Name  crypto.EncString `json:"name,omitempty"`
@@ -147,8 +167,8 @@ type LoginCipher struct {
 
 type URIMatch int
 type URI struct {
-	URI   string   `json:"uri,omitempty"`
-	Match URIMatch `json:"match,omitempty"`
+	URI   crypto.EncString `json:"uri,omitempty"`
+	Match URIMatch         `json:"match,omitempty"`
 }
 
 type SecureNoteType int
@@ -0,0 +1,23 @@
+package bitwarden
+
+import (
+	"context"
+)
+
+type ServerConfig struct {
+	Version     string `json:"version"`
+	GitHash     string `json:"gitHash"`
+	Environment struct {
+		Vault         string `json:"vault"`
+		Api           string `json:"api"`
+		Identity      string `json:"identity"`
+		Notifications string `json:"notifications"`
+	}
+}
+
+// GetServerConfig reads the urls and version of the server at baseURL
+func GetServerConfig(ctx context.Context, baseURL string) (ServerConfig, error) {
+	var serverConfig ServerConfig
+	err := authenticatedHTTPGet(ctx, baseURL+"/api/config", &serverConfig)
+	return serverConfig, err
+}
@@ -4,12 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
+	"strconv"
 	"time"
 
 	"github.com/quexten/goldwarden/cli/agent/bitwarden/crypto"
 	"github.com/quexten/goldwarden/cli/agent/bitwarden/models"
 	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/events"
 	"github.com/quexten/goldwarden/cli/agent/vault"
 	"github.com/quexten/goldwarden/cli/logging"
 )
@@ -25,16 +26,90 @@ func Sync(ctx context.Context, config *config.Config) (models.SyncData, error) {
 	return sync, nil
 }
 
+// GetRevisionDate returns when the account's vault last changed on the server
+func GetRevisionDate(ctx context.Context, config *config.Config) (time.Time, error) {
+	var revisionDate int64
+	if err := authenticatedHTTPGet(ctx, config.ConfigFile.ApiUrl+"/accounts/revision-date", &revisionDate); err != nil {
+		return time.Time{}, fmt.Errorf("could not get revision date: %v", err)
+	}
+	return time.UnixMilli(revisionDate), nil
+}
+
+// SyncIfChanged performs a full sync only if the vault changed on the server since the last full sync
+func SyncIfChanged(ctx context.Context, vault *vault.Vault, config *config.Config) error {
+	revisionDate, err := GetRevisionDate(ctx, config)
+	if err != nil {
+		return err
+	}
+	if syncedRevision := vault.GetRevisionDate(); !syncedRevision.IsZero() && !revisionDate.After(syncedRevision) {
+		log.Info("Vault is up to date")
+		return nil
+	}
+	return DoFullSync(ctx, vault, config, nil, false)
+}
+
 func DoFullSync(ctx context.Context, vault *vault.Vault, config *config.Config, userSymmetricKey *crypto.SymmetricEncryptionKey, allowCache bool) error {
+	fromCache, err := doFullSync(ctx, vault, config, userSymmetricKey, allowCache)
+	if err != nil {
+		events.Publish(events.TypeSyncFailed, map[string]string{"error": err.Error()})
+		return err
+	}
+
+	events.Publish(events.TypeSynced, map[string]string{"fromCache": strconv.FormatBool(fromCache)})
+	return nil
+}
+
+func doFullSync(ctx context.Context, vault *vault.Vault, config *config.Config, userSymmetricKey *crypto.SymmetricEncryptionKey, allowCache bool) (bool, error) {
 	log.Info("Performing full sync...")
+	// the revision date is read before the sync, so changes made during the sync are picked up by the next check
+	revisionDate, err := GetRevisionDate(ctx, config)
+	if err != nil {
+		log.Warn("Could not get revision date: %v", err)
+	}
 	sync, err := Sync(ctx, config)
 	if err != nil {
 		log.Error("Could not sync: %v", err)
-		return err
+		if !allowCache {
+			return false, err
+		}
+
+		log.Info("Falling back to offline vault cache...")
+		cachedSync, cacheErr := ReadVault(config)
+		if cacheErr != nil {
+			log.Warn("Could not read vault cache: %v", cacheErr)
+			return false, err
+		}
+
+		err = loadSyncData(cachedSync, vault, userSymmetricKey)
+		if err != nil {
+			return false, err
+		}
+		if modTime, err := config.GetVaultCacheModTime(); err == nil {
+			vault.SetLastSynced(modTime.Unix())
+		}
+		vault.SetLoadedFromCache(true)
+		log.Warn("Vault loaded from offline cache, it will be reconciled once the server is reachable")
+		return true, nil
 	} else {
 		log.Info("Sync successful, initializing keyring and vault...")
 	}
 
+	err = loadSyncData(sync, vault, userSymmetricKey)
+	if err != nil {
+		return false, err
+	}
+	vault.SetLastSynced(time.Now().Unix())
+	vault.SetRevisionDate(revisionDate)
+
+	err = WriteVault(sync, config)
+	if err != nil {
+		log.Warn("Could not write vault cache: %v", err)
+	}
+
+	return false, nil
+}
+
+func loadSyncData(sync models.SyncData, vault *vault.Vault, userSymmetricKey *crypto.SymmetricEncryptionKey) error {
 	var orgKeys map[string]string = make(map[string]string)
 	log.Info("Reading  %d org keys...", len(sync.Profile.Organizations))
 	for _, org := range sync.Profile.Organizations {
@@ -43,7 +118,7 @@ func DoFullSync(ctx context.Context, vault *vault.Vault, config *config.Config,
 	}
 	if userSymmetricKey != nil {
 		log.Info("Initializing keyring from user symmetric key...")
-		err = crypto.InitKeyringFromUserSymmetricKey(vault.Keyring, *userSymmetricKey, sync.Profile.PrivateKey, orgKeys)
+		err := crypto.InitKeyringFromUserSymmetricKey(vault.Keyring, *userSymmetricKey, sync.Profile.PrivateKey, orgKeys)
 		if err != nil {
 			return err
 		}
@@ -51,54 +126,38 @@ func DoFullSync(ctx context.Context, vault *vault.Vault, config *config.Config,
 
 	log.Info("Clearing vault...")
 	vault.Clear()
-	vault.SetLastSynced(time.Now().Unix())
+	log.Info("Adding %d folders and %d collections to vault...", len(sync.Folders), len(sync.Collections))
+	for _, folder := range sync.Folders {
+		vault.AddOrUpdateFolder(folder)
+	}
+	for _, collection := range sync.Collections {
+		vault.AddOrUpdateCollection(collection)
+	}
 	log.Info("Adding %d ciphers to vault...", len(sync.Ciphers))
 	for _, cipher := range sync.Ciphers {
-		switch cipher.Type {
-		case models.CipherLogin:
-			vault.AddOrUpdateLogin(cipher)
-		case models.CipherNote:
-			vault.AddOrUpdateSecureNote(cipher)
-		case models.CipherSSHKey:
-			vault.AddOrUpdateSSHKey(cipher)
-		}
+		vault.AddOrUpdateCipher(cipher)
 	}
 
 	return nil
 }
 
-func WriteVault(data models.SyncData, path string) error {
+func WriteVault(data models.SyncData, config *config.Config) error {
 	dataJson, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
-	// write to disk
-	os.Remove(path)
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
-	if err != nil {
-		return err
-	}
-
-	defer file.Close()
-
-	_, err = file.Write(dataJson)
-	if err != nil {
-		return err
-	}
-	return nil
+	return config.WriteVaultCache(dataJson)
 }
 
-func ReadVault(path string) (models.SyncData, error) {
-	file, err := os.Open(path)
+func ReadVault(config *config.Config) (models.SyncData, error) {
+	dataJson, err := config.ReadVaultCache()
 	if err != nil {
 		return models.SyncData{}, err
 	}
-	defer file.Close()
 
-	decoder := json.NewDecoder(file)
 	data := models.SyncData{}
-	err = decoder.Decode(&data)
+	err = json.Unmarshal(dataJson, &data)
 	if err != nil {
 		return models.SyncData{}, err
 	}
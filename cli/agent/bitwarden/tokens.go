@@ -0,0 +1,157 @@
+package bitwarden
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/quexten/goldwarden/cli/agent/config"
+)
+
+const (
+	// tokens are refreshed once they expire within this window
+	tokenRefreshAhead    = 5 * time.Minute
+	tokenCheckInterval   = 30 * time.Second
+	minTokenRetryBackoff = 5 * time.Second
+	maxTokenRetryBackoff = 2 * time.Minute
+)
+
+var errTokenRefreshFailed = errors.New("could not refresh token")
+
+// TokenManager keeps the access token of an account valid. Concurrent
+// refreshes are deduplicated and failed refreshes are retried with backoff.
+type TokenManager struct {
+	cfg *config.Config
+
+	mu          sync.Mutex
+	refreshing  chan struct{}
+	refreshErr  error
+	failures    int
+	nextAttempt time.Time
+}
+
+var tokenManagers = map[*config.Config]*TokenManager{}
+var tokenManagersMu sync.Mutex
+
+func TokenManagerFor(cfg *config.Config) *TokenManager {
+	tokenManagersMu.Lock()
+	defer tokenManagersMu.Unlock()
+
+	manager, ok := tokenManagers[cfg]
+	if !ok {
+		manager = &TokenManager{cfg: cfg}
+		tokenManagers[cfg] = manager
+	}
+	return manager
+}
+
+// ForgetTokenManager drops the token manager of a removed account.
+func ForgetTokenManager(cfg *config.Config) {
+	tokenManagersMu.Lock()
+	defer tokenManagersMu.Unlock()
+
+	delete(tokenManagers, cfg)
+}
+
+// WithAuthentication returns a context whose api requests are authenticated
+// with the access token of the account.
+func WithAuthentication(ctx context.Context, cfg *config.Config) context.Context {
+	return context.WithValue(ctx, AuthToken{}, TokenManagerFor(cfg))
+}
+
+// GetValidToken returns the access token, refreshing it first if it expires soon.
+// If the refresh fails, the old token is returned for as long as it is valid.
+func (m *TokenManager) GetValidToken(ctx context.Context) (string, error) {
+	token, err := m.cfg.GetToken()
+	if err != nil {
+		return "", err
+	}
+	if token.AccessToken != "" && time.Until(token.ExpiresAt) > tokenRefreshAhead {
+		return token.AccessToken, nil
+	}
+
+	if err := m.refresh(ctx, false); err != nil {
+		if token.AccessToken != "" && time.Now().Before(token.ExpiresAt) {
+			return token.AccessToken, nil
+		}
+		return "", err
+	}
+
+	token, err = m.cfg.GetToken()
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// Refresh refreshes the token regardless of its expiry and backoff, e.g. after
+// the server rejected it.
+func (m *TokenManager) Refresh(ctx context.Context) error {
+	return m.refresh(ctx, true)
+}
+
+func (m *TokenManager) refresh(ctx context.Context, force bool) error {
+	m.mu.Lock()
+	if refreshing := m.refreshing; refreshing != nil {
+		m.mu.Unlock()
+		select {
+		case <-refreshing:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.refreshErr
+	}
+	if !force && time.Now().Before(m.nextAttempt) {
+		defer m.mu.Unlock()
+		return m.refreshErr
+	}
+	refreshing := make(chan struct{})
+	m.refreshing = refreshing
+	m.mu.Unlock()
+
+	// the refresh itself must not try to authenticate with the token being refreshed
+	refreshed := RefreshToken(context.WithValue(ctx, AuthToken{}, nil), m.cfg)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if refreshed {
+		m.failures = 0
+		m.nextAttempt = time.Time{}
+		m.refreshErr = nil
+	} else {
+		m.failures++
+		backoff := minTokenRetryBackoff << min(m.failures-1, 5)
+		m.nextAttempt = time.Now().Add(min(backoff, maxTokenRetryBackoff))
+		m.refreshErr = errTokenRefreshFailed
+	}
+	m.refreshing = nil
+	close(refreshing)
+	return m.refreshErr
+}
+
+// Run refreshes the token ahead of its expiry until the context ends.
+func (m *TokenManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(tokenCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if m.cfg.IsLocked() {
+			continue
+		}
+		if token, err := m.cfg.GetToken(); err != nil || token.AccessToken == "" {
+			continue
+		}
+		if _, err := m.GetValidToken(ctx); err != nil {
+			authLog.Warn("Could not refresh token: %s", err.Error())
+		}
+	}
+}
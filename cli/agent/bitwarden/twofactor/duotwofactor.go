@@ -0,0 +1,80 @@
+package twofactor
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/quexten/goldwarden/cli/agent/notify"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/pinentry"
+)
+
+const duoTimeout = 5 * time.Minute
+
+// DuoTwoFactor shows the duo universal prompt url and polls for the code the
+// vault's duo redirect page displays once the user has approved the login.
+func DuoTwoFactor(provider map[string]interface{}) (string, error) {
+	authURL := providerString(provider, "AuthUrl")
+	if authURL == "" {
+		if providerString(provider, "Signature") != "" {
+			return "", errors.New("the legacy duo prompt is not supported, enable the duo universal prompt for your account")
+		}
+		return "", errors.New("no duo auth url provided")
+	}
+
+	twofactorLog.Info("Open %s in your browser to authenticate with Duo", authURL)
+	notify.Notify("Goldwarden", "Open the following URL in your browser to authenticate with Duo: "+authURL, "", 0, func() {})
+
+	deadline := time.Now().Add(duoTimeout)
+	for time.Now().Before(deadline) {
+		input, err := pinentry.GetPassword("Duo Second Factor", "Open "+authURL+" in your browser. Once approved, enter the code or the URL of the page Duo redirected you to")
+		if err != nil {
+			return "", err
+		}
+		token, err := parseDuoCode(input)
+		if err != nil {
+			twofactorLog.Warn("Invalid duo code: %s", err.Error())
+			continue
+		}
+		return token, nil
+	}
+	return "", errors.New("timed out waiting for duo authentication")
+}
+
+// parseDuoCode accepts either the "code|state" pair or the redirect url containing both
+func parseDuoCode(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", errors.New("no code entered")
+	}
+
+	if strings.Contains(input, "://") {
+		redirectURL, err := url.Parse(input)
+		if err != nil {
+			return "", err
+		}
+		code := redirectURL.Query().Get("code")
+		state := redirectURL.Query().Get("state")
+		if code == "" || state == "" {
+			return "", errors.New("redirect url does not contain a code and state")
+		}
+		return code + "|" + state, nil
+	}
+
+	if !strings.Contains(input, "|") {
+		return "", errors.New("expected code and state separated by |")
+	}
+	return input, nil
+}
+
+func providerString(provider map[string]interface{}, key string) string {
+	for k, v := range provider {
+		if strings.EqualFold(k, key) {
+			if s, ok := v.(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
@@ -3,7 +3,9 @@ package twofactor
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/quexten/goldwarden/cli/agent/config"
 	"github.com/quexten/goldwarden/cli/agent/systemauth/pinentry"
@@ -12,44 +14,165 @@ import (
 
 var twofactorLog = logging.GetLogger("Goldwarden", "TwoFactor")
 
-func PerformSecondFactor(resp *TwoFactorResponse, cfg *config.Config) (TwoFactorProvider, []byte, error) {
-	if provider, isInMap := resp.TwoFactorProviders2[WebAuthn]; isInMap {
-		if isFido2Enabled {
-			chall := provider["challenge"].(string)
-
-			var creds []string
-			for _, credential := range provider["allowCredentials"].([]interface{}) {
-				publicKey := credential.(map[string]interface{})["id"].(string)
-				creds = append(creds, publicKey)
-			}
-
-			result, err := Fido2TwoFactor(chall, creds, cfg)
-			if err != nil {
-				twofactorLog.Error("Error during FIDO2 two-factor authentication: %s", err)
-				//return WebAuthn, nil, err
-			} else {
-				return WebAuthn, []byte(result), err
-			}
-		} else {
+// ErrResendEmail is returned when the user asks for the email with the code to be sent again
+var ErrResendEmail = errors.New("email with two-factor code requested")
+
+const maxChoiceAttempts = 3
+
+// providerOrder is the order providers are offered in
+var providerOrder = []TwoFactorProvider{WebAuthn, Authenticator, YubiKey, Duo, OrganizationDuo, Email}
+
+var providerNames = map[TwoFactorProvider]string{
+	Authenticator:   "authenticator",
+	Email:           "email",
+	Duo:             "duo",
+	YubiKey:         "yubikey",
+	OrganizationDuo: "organization-duo",
+	WebAuthn:        "webauthn",
+}
+
+func (t TwoFactorProvider) String() string {
+	if name, ok := providerNames[t]; ok {
+		return name
+	}
+	return strconv.Itoa(int(t))
+}
+
+func ParseProvider(name string) (TwoFactorProvider, error) {
+	for provider, providerName := range providerNames {
+		if strings.EqualFold(name, providerName) {
+			return provider, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown two-factor method %q, expected one of %s", name, strings.Join(ProviderNames(providerOrder), ", "))
+}
+
+func ProviderNames(providers []TwoFactorProvider) []string {
+	names := make([]string, len(providers))
+	for i, provider := range providers {
+		names[i] = provider.String()
+	}
+	return names
+}
+
+// AvailableProviders returns the providers the server offers that goldwarden supports
+func AvailableProviders(resp *TwoFactorResponse) []TwoFactorProvider {
+	var providers []TwoFactorProvider
+	for _, provider := range providerOrder {
+		if _, isInMap := resp.TwoFactorProviders2[provider]; !isInMap {
+			continue
+		}
+		if provider == WebAuthn && !isFido2Enabled {
 			twofactorLog.Warn("WebAuthn is enabled for the account but goldwarden is not compiled with FIDO2 support")
+			continue
 		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// ChooseProvider picks the preferred provider, or asks the user if the server offers several
+func ChooseProvider(resp *TwoFactorResponse, preferred string) (TwoFactorProvider, error) {
+	available := AvailableProviders(resp)
+	if len(available) == 0 {
+		return Authenticator, errors.New("no supported second factor available")
 	}
-	if _, isInMap := resp.TwoFactorProviders2[Authenticator]; isInMap {
-		token, err := pinentry.GetPassword("Authenticator Second Factor", "Enter your two-factor auth code")
+
+	if preferred != "" {
+		provider, err := ParseProvider(preferred)
 		if err != nil {
-			twofactorLog.Error("Error during authenticator two-factor authentication: %s", err)
-		} else {
-			return Authenticator, []byte(token), err
+			return Authenticator, err
+		}
+		if !slices.Contains(available, provider) {
+			return Authenticator, fmt.Errorf("two-factor method %s is not enabled for the account, available: %s", provider, strings.Join(ProviderNames(available), ", "))
 		}
+		return provider, nil
 	}
-	if _, isInMap := resp.TwoFactorProviders2[Email]; isInMap {
-		token, err := pinentry.GetPassword("Email Second Factor", "Enter your two-factor auth code")
-		if err == nil {
-			return Email, []byte(token), err
+
+	if len(available) == 1 {
+		return available[0], nil
+	}
+
+	description := "Choose your second factor:"
+	for i, provider := range available {
+		description += fmt.Sprintf(" %d) %s", i+1, provider)
+	}
+	for attempt := 0; attempt < maxChoiceAttempts; attempt++ {
+		choice, err := pinentry.GetPassword("Second Factor", description)
+		if err != nil {
+			return Authenticator, err
+		}
+		choice = strings.TrimSpace(choice)
+		if index, err := strconv.Atoi(choice); err == nil && index >= 1 && index <= len(available) {
+			return available[index-1], nil
 		}
+		if provider, err := ParseProvider(choice); err == nil && slices.Contains(available, provider) {
+			return provider, nil
+		}
+		twofactorLog.Warn("Invalid second factor choice: %q", choice)
+	}
+	return Authenticator, errors.New("no second factor chosen")
+}
+
+// GetToken asks the user for the token of the provider. invalid is set when
+// the previously entered token was rejected by the server.
+func GetToken(provider TwoFactorProvider, resp *TwoFactorResponse, cfg *config.Config, invalid bool) ([]byte, error) {
+	providerData := resp.TwoFactorProviders2[provider]
+	retryHint := ""
+	if invalid {
+		retryHint = "The code was invalid. "
 	}
 
-	return Authenticator, []byte{}, errors.New("no second factor available")
+	switch provider {
+	case WebAuthn:
+		chall := providerData["challenge"].(string)
+
+		var creds []string
+		for _, credential := range providerData["allowCredentials"].([]interface{}) {
+			publicKey := credential.(map[string]interface{})["id"].(string)
+			creds = append(creds, publicKey)
+		}
+
+		result, err := Fido2TwoFactor(chall, creds, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(result), nil
+	case Authenticator:
+		token, err := pinentry.GetPassword("Authenticator Second Factor", retryHint+"Enter your two-factor auth code")
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strings.TrimSpace(token)), nil
+	case YubiKey:
+		token, err := pinentry.GetPassword("YubiKey Second Factor", retryHint+"Insert your YubiKey and touch its button")
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strings.TrimSpace(token)), nil
+	case Duo, OrganizationDuo:
+		token, err := DuoTwoFactor(providerData)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(token), nil
+	case Email:
+		recipient := "your email address"
+		if email := providerString(providerData, "Email"); email != "" {
+			recipient = email
+		}
+		token, err := pinentry.GetPassword("Email Second Factor", retryHint+"Enter the two-factor auth code sent to "+recipient+", or leave empty to send a new one")
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(token)
+		if token == "" {
+			return nil, ErrResendEmail
+		}
+		return []byte(token), nil
+	default:
+		return nil, fmt.Errorf("two-factor method %s is not supported", provider)
+	}
 }
 
 type TwoFactorProvider int
@@ -57,11 +180,11 @@ type TwoFactorProvider int
 const (
 	Authenticator         TwoFactorProvider = 0
 	Email                 TwoFactorProvider = 1
-	Duo                   TwoFactorProvider = 2 //Not supported
-	YubiKey               TwoFactorProvider = 3 //Not supported
+	Duo                   TwoFactorProvider = 2
+	YubiKey               TwoFactorProvider = 3
 	U2f                   TwoFactorProvider = 4 //Not supported
-	Remember              TwoFactorProvider = 5 //Not supported
-	OrganizationDuo       TwoFactorProvider = 6 //Not supported
+	Remember              TwoFactorProvider = 5
+	OrganizationDuo       TwoFactorProvider = 6
 	WebAuthn              TwoFactorProvider = 7
 	_TwoFactorProviderMax                   = 8 //Not supported
 )
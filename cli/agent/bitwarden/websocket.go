@@ -4,13 +4,12 @@ import (
 	"bytes"
 	"context"
 	"net/url"
-	"os"
+	"strings"
 	"time"
 
-	"github.com/awnumar/memguard"
 	"github.com/gorilla/websocket"
-	"github.com/quexten/goldwarden/cli/agent/bitwarden/models"
 	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/events"
 	"github.com/quexten/goldwarden/cli/agent/notify"
 	"github.com/quexten/goldwarden/cli/agent/systemauth/biometrics"
 	"github.com/quexten/goldwarden/cli/agent/systemauth/pinentry"
@@ -48,61 +47,149 @@ const (
 )
 
 const (
-	WEBSOCKET_SLEEP_DURATION_SECONDS = 60
+	minWebsocketBackoff = 1 * time.Second
+	maxWebsocketBackoff = 5 * time.Minute
+	// connections lasting this long reset the backoff
+	websocketStableDuration = 1 * time.Minute
+	// the signalr defaults, the server pings every 15 seconds as well
+	websocketPingInterval  = 15 * time.Second
+	websocketServerTimeout = 30 * time.Second
 )
 
+// signalr message types, see https://github.com/dotnet/aspnetcore/blob/main/src/SignalR/docs/specs/HubProtocol.md
+const (
+	signalRInvocation = 1
+	signalRPing       = 6
+	signalRClose      = 7
+)
+
+// a length prefixed messagepack encoded [6]
+var signalRPingMessage = []byte{0x02, 0x91, signalRPing}
+
+// RunWebsocketDaemon keeps the websocket connection of an account open until ctx is done,
+// reconnecting with backoff and catching up on changes missed while disconnected.
 func RunWebsocketDaemon(ctx context.Context, vault *vault.Vault, cfg *config.Config) {
-	for {
-		if cfg.IsLocked() {
-			time.Sleep(5 * time.Second)
+	failures := 0
+	catchUp := false
+	for ctx.Err() == nil {
+		if token, err := cfg.GetToken(); cfg.IsLocked() || err != nil || token.AccessToken == "" {
+			// after unlocking, the vault is synced anyways
+			catchUp = false
+			failures = 0
+			if !sleepContext(ctx, 5*time.Second) {
+				return
+			}
 			continue
 		}
 
-		if token, err := cfg.GetToken(); err == nil && token.AccessToken != "" {
-			err := connectToWebsocket(ctx, vault, cfg)
-			if err != nil {
-				websocketLog.Error("Websocket error %s", err)
-			}
+		connectedAt := time.Now()
+		connected, err := connectToWebsocket(ctx, vault, cfg, catchUp)
+		if err != nil {
+			websocketLog.Error("Websocket error %s", err)
+		}
+		if connected {
+			catchUp = true
 		}
+		if connected && time.Since(connectedAt) >= websocketStableDuration {
+			failures = 0
+		}
+
+		backoff := jitteredBackoff(failures, minWebsocketBackoff, maxWebsocketBackoff)
+		failures++
+		websocketLog.Info("Reconnecting to websocket in %s", backoff)
+		if !sleepContext(ctx, backoff) {
+			return
+		}
+	}
+}
 
-		time.Sleep(WEBSOCKET_SLEEP_DURATION_SECONDS * time.Second)
+func sleepContext(ctx context.Context, duration time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(duration):
+		return true
 	}
 }
 
-func connectToWebsocket(ctx context.Context, vault *vault.Vault, cfg *config.Config) error {
-	url, err := url.Parse(cfg.ConfigFile.NotificationsUrl)
+// websocketURL returns the url of the notifications hub, using ws:// for http servers
+func websocketURL(notificationsURL string, token string) (string, error) {
+	hubURL, err := url.Parse(notificationsURL)
 	if err != nil {
-		return err
+		return "", err
+	}
+	switch hubURL.Scheme {
+	case "http", "ws":
+		hubURL.Scheme = "ws"
+	default:
+		hubURL.Scheme = "wss"
 	}
+	hubURL.Path = strings.TrimSuffix(hubURL.Path, "/") + "/hub"
+	hubURL.RawQuery = url.Values{"access_token": {token}}.Encode()
+	return hubURL.String(), nil
+}
 
-	token, err := cfg.GetToken()
+// connectToWebsocket handles notifications until the connection ends. catchUp syncs
+// changes that happened while disconnected once connected.
+func connectToWebsocket(ctx context.Context, vault *vault.Vault, cfg *config.Config, catchUp bool) (bool, error) {
+	token, err := TokenManagerFor(cfg).GetValidToken(ctx)
 	if err != nil {
-		return err
+		return false, err
 	}
+	apiCtx := WithAuthentication(ctx, cfg)
 
-	var websocketURL = "wss://" + url.Host + url.Path + "/hub?access_token=" + token.AccessToken
-	c, _, err := websocket.DefaultDialer.Dial(websocketURL, nil)
+	hubURL, err := websocketURL(cfg.ConfigFile.NotificationsUrl, token)
 	if err != nil {
-		return err
+		return false, err
+	}
+	c, _, err := currentWebsocketDialer().Dial(hubURL, nil)
+	if err != nil {
+		return false, err
 	}
 	defer c.Close()
 
+	//handshake required for official bitwarden implementation
+	err = c.WriteMessage(websocket.TextMessage, []byte(`{"protocol":"messagepack","version":1}`+"\x1e"))
+	if err != nil {
+		return false, err
+	}
+
 	websocketLog.Info("Connected to websocket server...")
 	vault.SetWebsocketConnected(true)
+	events.Publish(events.TypeWebsocketConnected, nil)
 
-	done := make(chan struct{})
-	//handshake required for official bitwarden implementation
-	err = c.WriteMessage(1, []byte(`{"protocol":"messagepack","version":1}`))
-	if err != nil {
-		return err
+	if catchUp {
+		go func() {
+			if err := SyncIfChanged(apiCtx, vault, cfg); err != nil {
+				websocketLog.Warn("Could not sync changes missed while disconnected: %s", err.Error())
+			}
+		}()
 	}
 
+	done := make(chan struct{})
 	go func() {
+		pingTicker := time.NewTicker(websocketPingInterval)
+		defer pingTicker.Stop()
+		lockTicker := time.NewTicker(5 * time.Second)
+		defer lockTicker.Stop()
 		for {
-			time.Sleep(5 * time.Second)
-			if vault.Keyring.IsLocked() || cfg.IsLocked() || !cfg.IsLoggedIn() {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
 				c.Close()
 				return
+			case <-lockTicker.C:
+				if vault.Keyring.IsLocked() || cfg.IsLocked() || !cfg.IsLoggedIn() {
+					c.Close()
+					return
+				}
+			case <-pingTicker.C:
+				if err := c.WriteMessage(websocket.BinaryMessage, signalRPingMessage); err != nil {
+					websocketLog.Warn("Could not send ping: %s", err.Error())
+					c.Close()
+					return
+				}
 			}
 		}
 	}()
@@ -110,11 +197,21 @@ func connectToWebsocket(ctx context.Context, vault *vault.Vault, cfg *config.Con
 	go func() {
 		defer close(done)
 		for {
+			// the server pings regularly, silence means the connection is gone
+			_ = c.SetReadDeadline(time.Now().Add(websocketServerTimeout))
 			_, message, err := c.ReadMessage()
 			if err != nil {
 				websocketLog.Error("Error reading websocket message %s", err)
 				return
 			}
+
+			switch signalRMessageType(message) {
+			case signalRPing:
+				continue
+			case signalRClose:
+				websocketLog.Info("Websocket closed by server")
+				return
+			}
 			if len(message) < 5 {
 				//ignore empty messages
 				continue
@@ -125,12 +222,7 @@ func connectToWebsocket(ctx context.Context, vault *vault.Vault, cfg *config.Con
 				switch mt1 {
 				case SyncCiphers, SyncVault:
 					websocketLog.Warn("SyncCiphers requested")
-					token, err := cfg.GetToken()
-					if err != nil {
-						websocketLog.Error("Error getting token %s", err)
-						break
-					}
-					err = DoFullSync(context.WithValue(ctx, AuthToken{}, token.AccessToken), vault, cfg, nil, false)
+					err := DoFullSync(apiCtx, vault, cfg, nil, false)
 					if err != nil {
 						log.Error("could not perform full sync: %s", err.Error())
 						return
@@ -140,13 +232,7 @@ func connectToWebsocket(ctx context.Context, vault *vault.Vault, cfg *config.Con
 					vault.DeleteCipher(cipherid)
 				case SyncCipherUpdate:
 					websocketLog.Warn("Update requested for cipher " + cipherid)
-					token, err := cfg.GetToken()
-					if err != nil {
-						websocketLog.Error("Error getting token %s", err)
-						break
-					}
-
-					cipher, err := GetCipher(context.WithValue(ctx, AuthToken{}, token.AccessToken), cipherid, cfg)
+					cipher, err := GetCipher(apiCtx, cipherid, cfg)
 					if err != nil {
 						websocketLog.Error("Error getting cipher %s", err)
 						break
@@ -157,70 +243,85 @@ func connectToWebsocket(ctx context.Context, vault *vault.Vault, cfg *config.Con
 						break
 					}
 
-					if cipher.Type == models.CipherNote {
-						vault.AddOrUpdateSecureNote(cipher)
-					} else {
-						vault.AddOrUpdateLogin(cipher)
-					}
+					vault.AddOrUpdateCipher(cipher)
 					vault.SetLastSynced(time.Now().Unix())
 				case SyncCipherCreate:
 					websocketLog.Warn("Create requested for cipher " + cipherid)
-					token, err := cfg.GetToken()
-					if err != nil {
-						websocketLog.Error("Error getting token %s", err)
-						break
-					}
-
-					cipher, err := GetCipher(context.WithValue(ctx, AuthToken{}, token.AccessToken), cipherid, cfg)
+					cipher, err := GetCipher(apiCtx, cipherid, cfg)
 					if err != nil {
 						websocketLog.Error("Error getting cipher %s", err)
 						break
 					}
 
-					if cipher.Type == models.CipherNote {
-						vault.AddOrUpdateSecureNote(cipher)
-					} else {
-						vault.AddOrUpdateLogin(cipher)
-					}
+					vault.AddOrUpdateCipher(cipher)
 					vault.SetLastSynced(time.Now().Unix())
 				case SyncSendCreate, SyncSendUpdate, SyncSendDelete:
 					websocketLog.Warn("SyncSend requested: sends are not supported")
 				case LogOut:
-					websocketLog.Info("LogOut received. Wiping vault and exiting...")
-					if vault.Keyring.IsMemguard {
-						memguard.SafeExit(0)
-					} else {
-						os.Exit(0)
+					// other accounts keep running, so only this account is logged out
+					websocketLog.Info("LogOut received. Wiping vault and logging out...")
+					cfg.Lock()
+					cfg.Purge()
+					if err := cfg.WriteConfig(); err != nil {
+						websocketLog.Error("Could not write config after logout %s", err)
 					}
+					vault.Clear()
+					vault.Keyring.Lock()
+					return
 				case AuthRequest:
 					websocketLog.Info("AuthRequest received" + string(cipherid))
-					authRequest, err := GetAuthRequest(context.WithValue(ctx, AuthToken{}, token.AccessToken), cipherid, cfg)
+					authRequest, err := GetAuthRequest(apiCtx, cipherid, cfg)
 					if err != nil {
 						websocketLog.Error("Error getting auth request %s", err)
 						break
 					}
 					websocketLog.Info("AuthRequest details " + authRequest.RequestIpAddress + " " + authRequest.RequestDeviceType)
+					publishAuthRequest := func(status string) {
+						events.Publish(events.TypeAuthRequest, map[string]string{
+							"id":         authRequest.ID,
+							"ipAddress":  authRequest.RequestIpAddress,
+							"deviceType": authRequest.RequestDeviceType,
+							"status":     status,
+						})
+					}
+					publishAuthRequest("received")
 
 					notify.Notify("Passwordless Login Request", authRequest.RequestIpAddress+" - "+authRequest.RequestDeviceType, "", 0, func() {
 						var message = "Do you want to allow " + authRequest.RequestIpAddress + " (" + authRequest.RequestDeviceType + ") to login to your account?"
 						if approved, err := pinentry.GetApproval("Paswordless Login Request", message); err != nil || !approved {
 							websocketLog.Info("AuthRequest denied")
+							publishAuthRequest("denied")
 							return
 						}
 						if !biometrics.CheckBiometrics(biometrics.AccessVault) {
 							websocketLog.Info("AuthRequest denied - biometrics required")
+							publishAuthRequest("denied")
 							return
 						}
 
-						_, err = CreateAuthResponse(context.WithValue(ctx, AuthToken{}, token.AccessToken), authRequest, vault.Keyring, cfg)
+						_, err = CreateAuthResponse(apiCtx, authRequest, vault.Keyring, cfg)
 						if err != nil {
 							websocketLog.Error("Error creating auth response %s", err)
+							publishAuthRequest("failed")
+							return
 						}
+						publishAuthRequest("approved")
 					})
 				case AuthRequestResponse:
 					websocketLog.Info("AuthRequestResponse received")
-				case SyncFolderDelete, SyncFolderCreate, SyncFolderUpdate:
-					websocketLog.Warn("SyncFolder requested: folders are not supported")
+				case SyncFolderDelete:
+					websocketLog.Info("Delete requested for folder " + cipherid)
+					vault.DeleteFolder(cipherid)
+				case SyncFolderCreate, SyncFolderUpdate:
+					websocketLog.Info("Create or update requested for folder " + cipherid)
+					folder, err := GetFolder(apiCtx, cipherid, cfg)
+					if err != nil {
+						websocketLog.Error("Error getting folder %s", err)
+						break
+					}
+
+					vault.AddOrUpdateFolder(folder)
+					vault.SetLastSynced(time.Now().Unix())
 				case SyncOrgKeys, SyncSettings:
 					websocketLog.Warn("SyncOrgKeys requested: orgs / settings are not supported")
 				default:
@@ -232,7 +333,28 @@ func connectToWebsocket(ctx context.Context, vault *vault.Vault, cfg *config.Con
 
 	<-done
 	vault.SetWebsocketConnected(false)
-	return nil
+	events.Publish(events.TypeWebsocketDisconnected, nil)
+	return true, nil
+}
+
+// signalRMessageType returns the type of a length prefixed messagepack hub message, or -1
+func signalRMessageType(message []byte) int {
+	lenBufferLen := 0
+	for i := 0; i < len(message); i++ {
+		if (message[i] & 0x80) == 0 {
+			lenBufferLen = i + 1
+			break
+		}
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(message[lenBufferLen:]))
+	if length, err := dec.DecodeArrayLen(); err != nil || length < 1 {
+		return -1
+	}
+	messageType, err := dec.DecodeInt()
+	if err != nil {
+		return -1
+	}
+	return messageType
 }
 
 func websocketMessageType(message []byte) (int8, string, bool) {
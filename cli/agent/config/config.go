@@ -2,6 +2,7 @@ package config
 
 import (
 	"bytes"
+	"crypto/rand"
 	cryptoSubtle "crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
@@ -9,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime/debug"
 	"strings"
 	"sync"
@@ -16,6 +18,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/quexten/goldwarden/cli/agent/bitwarden/crypto"
+	"github.com/quexten/goldwarden/cli/agent/events"
 	"github.com/quexten/goldwarden/cli/agent/notify"
 	"github.com/quexten/goldwarden/cli/agent/pincache"
 	"github.com/quexten/goldwarden/cli/agent/systemauth/pinentry"
@@ -31,6 +34,9 @@ const (
 	KDFMemory         = 2 * 1024 * 1024
 	KDFThreads        = 8
 	DefaultConfigPath = "~/.config/goldwarden/goldwarden.json"
+	VaultCacheFile    = "vaultcache"
+	PolicyFile        = "policy.json"
+	AuditLogFile      = "audit.log"
 )
 
 type RuntimeConfig struct {
@@ -47,6 +53,7 @@ type RuntimeConfig struct {
 	SSHAgentSocketPath   string
 	GoldwardenSocketPath string
 	DaemonAuthToken      string
+	Account              string
 }
 
 type ConfigFile struct {
@@ -62,7 +69,17 @@ type ConfigFile struct {
 	EncryptedUserSymmetricKey   string
 	EncryptedMasterPasswordHash string
 	EncryptedMasterKey          string
-	RuntimeConfig               RuntimeConfig `json:"-"`
+	// remembered-device token, kept across purges so re-logins can skip the second factor
+	EncryptedTwoFactorToken string `json:",omitempty"`
+	// key of the audit log hash chain
+	EncryptedAuditKey string `json:",omitempty"`
+	// additional accounts, each stored like a config file of its own
+	Profiles map[string]ConfigFile `json:",omitempty"`
+	// additional ssh agent sockets, each serving a subset of the keys
+	SSHAgents map[string]SSHAgentProfile `json:",omitempty"`
+	// tls, proxy and retry settings of the http client, shared by all accounts
+	HTTP          *HTTPSettings `json:",omitempty"`
+	RuntimeConfig RuntimeConfig `json:"-"`
 }
 
 type LoginToken struct {
@@ -71,6 +88,8 @@ type LoginToken struct {
 	TokenType    string `json:"token_type"`
 	RefreshToken string `json:"refresh_token"`
 	Key          string `json:"key"`
+	// set from ExpiresIn when the token is stored
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
 }
 
 type Config struct {
@@ -78,10 +97,16 @@ type Config struct {
 	key         *LockedBuffer
 	ConfigFile  ConfigFile
 	mu          sync.Mutex
+	// set for profiles, which are persisted as part of their parent's config file
+	profile string
+	parent  *Config
 }
 
 var log = logging.GetLogger("Goldwarden", "Config")
 
+// serializes the creation of the audit key
+var auditKeyMu sync.Mutex
+
 func DefaultConfig(useMemguard bool) Config {
 	deviceUUID, _ := uuid.NewUUID()
 	keyBuffer := NewBuffer(32, useMemguard)
@@ -104,6 +129,8 @@ func DefaultConfig(useMemguard bool) Config {
 			RuntimeConfig:               RuntimeConfig{},
 		},
 		sync.Mutex{},
+		"",
+		nil,
 	}
 }
 
@@ -135,6 +162,7 @@ func (c *Config) Unlock(password string) bool {
 	keyBuffer := NewBufferFromBytes(key, c.useMemguard)
 	c.key = &keyBuffer
 	notify.Notify("Goldwarden", "Vault Unlocked", "", 60*time.Second, func() {})
+	events.Publish(events.TypeUnlocked, c.eventData())
 	pincache.SetPin(c.useMemguard, []byte(password))
 	return true
 }
@@ -160,6 +188,7 @@ func (c *Config) Lock() {
 	}
 	(*c.key).Wipe()
 	notify.Notify("Goldwarden", "Vault Locked", "", 60*time.Second, func() {})
+	events.Publish(events.TypeLocked, c.eventData())
 }
 
 func (c *Config) Purge() {
@@ -173,8 +202,11 @@ func (c *Config) Purge() {
 	c.ConfigFile.EncryptedClientSecret = ""
 	c.ConfigFile.ConfigKeyHash = ""
 	c.ConfigFile.EncryptedMasterKey = ""
+	// encrypted with the old config key, the audit log starts a new chain with a new key
+	c.ConfigFile.EncryptedAuditKey = ""
 	key := NewBuffer(32, c.useMemguard)
 	c.key = &key
+	c.DeleteVaultCache()
 }
 
 func (c *Config) HasPin() bool {
@@ -197,6 +229,9 @@ func (c *Config) UpdatePin(password string, write bool) {
 	plaintextMasterKey, err4 := c.decryptString(c.ConfigFile.EncryptedMasterKey)
 	plaintextClientID, err5 := c.decryptString(c.ConfigFile.EncryptedClientID)
 	plaintextClientSecret, err6 := c.decryptString(c.ConfigFile.EncryptedClientSecret)
+	plaintextVaultCache, err7 := c.readVaultCache()
+	plaintextTwoFactorToken, err8 := c.decryptString(c.ConfigFile.EncryptedTwoFactorToken)
+	plaintextAuditKey, err9 := c.decryptString(c.ConfigFile.EncryptedAuditKey)
 
 	key := NewBufferFromBytes(newKey, c.useMemguard)
 	c.key = &key
@@ -243,6 +278,26 @@ func (c *Config) UpdatePin(password string, write bool) {
 			return
 		}
 	}
+	if err7 == nil {
+		err7 = c.writeVaultCache(plaintextVaultCache)
+		if err7 != nil {
+			log.Error("could not re-encrypt vault cache: %s", err7.Error())
+		}
+	}
+	if err8 == nil {
+		c.ConfigFile.EncryptedTwoFactorToken, err8 = c.encryptString(plaintextTwoFactorToken)
+		if err8 != nil {
+			log.Error("could not encrypt two-factor token: %s", err8.Error())
+			return
+		}
+	}
+	if err9 == nil {
+		c.ConfigFile.EncryptedAuditKey, err9 = c.encryptString(plaintextAuditKey)
+		if err9 != nil {
+			log.Error("could not encrypt audit key: %s", err9.Error())
+			return
+		}
+	}
 	c.mu.Unlock()
 
 	if write {
@@ -278,6 +333,9 @@ func (c *Config) SetToken(token LoginToken) error {
 		return errors.New("config is locked")
 	}
 
+	if token.ExpiresAt.IsZero() && token.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
 	tokenJson, err := json.Marshal(token)
 	if err != nil {
 		return fmt.Errorf("could not marshall json: %s", err.Error())
@@ -292,6 +350,42 @@ func (c *Config) SetToken(token LoginToken) error {
 	return c.WriteConfig()
 }
 
+// GetTwoFactorToken returns the remembered-device token, or an empty string if
+// there is none or it was encrypted with a different pin.
+func (c *Config) GetTwoFactorToken() (string, error) {
+	if c.IsLocked() {
+		return "", errors.New("config is locked")
+	}
+
+	if c.ConfigFile.EncryptedTwoFactorToken == "" {
+		return "", nil
+	}
+
+	decrypted, err := c.decryptString(c.ConfigFile.EncryptedTwoFactorToken)
+	if err != nil {
+		return "", nil
+	}
+	return decrypted, nil
+}
+
+func (c *Config) SetTwoFactorToken(token string) error {
+	if c.IsLocked() {
+		return errors.New("config is locked")
+	}
+
+	if token == "" {
+		c.ConfigFile.EncryptedTwoFactorToken = ""
+		return c.WriteConfig()
+	}
+
+	encryptedToken, err := c.encryptString(token)
+	if err != nil {
+		return err
+	}
+	c.ConfigFile.EncryptedTwoFactorToken = encryptedToken
+	return c.WriteConfig()
+}
+
 func (c *Config) GetClientID() (string, error) {
 	if c.IsLocked() {
 		return "", errors.New("config is locked")
@@ -442,6 +536,122 @@ func (c *Config) SetMasterKey(key []byte) error {
 	return c.WriteConfig()
 }
 
+func (c *Config) PolicyPath() string {
+	return filepath.Join(filepath.Dir(c.ConfigFile.RuntimeConfig.ConfigDirectory), PolicyFile)
+}
+
+func (c *Config) AuditLogPath() string {
+	return filepath.Join(filepath.Dir(c.ConfigFile.RuntimeConfig.ConfigDirectory), AuditLogFile)
+}
+
+// AuditKey returns the key of the audit log hash chain, which is shared by all
+// accounts and created on first use.
+func (c *Config) AuditKey() ([]byte, error) {
+	if c.parent != nil {
+		return c.parent.AuditKey()
+	}
+	auditKeyMu.Lock()
+	defer auditKeyMu.Unlock()
+
+	if c.IsLocked() {
+		return []byte{}, errors.New("config is locked")
+	}
+	if c.ConfigFile.EncryptedAuditKey != "" {
+		decrypted, err := c.decryptString(c.ConfigFile.EncryptedAuditKey)
+		if err != nil {
+			return []byte{}, err
+		}
+		return []byte(decrypted), nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return []byte{}, err
+	}
+	encryptedKey, err := c.encryptString(string(key))
+	if err != nil {
+		return []byte{}, err
+	}
+	c.ConfigFile.EncryptedAuditKey = encryptedKey
+	return key, c.WriteConfig()
+}
+
+func (c *Config) vaultCachePath() string {
+	if c.profile != "" {
+		return filepath.Join(filepath.Dir(c.ConfigFile.RuntimeConfig.ConfigDirectory), VaultCacheFile+"-"+c.profile)
+	}
+	return filepath.Join(filepath.Dir(c.ConfigFile.RuntimeConfig.ConfigDirectory), VaultCacheFile)
+}
+
+// WriteVaultCache stores the serialized vault next to the config file, encrypted with the config key.
+func (c *Config) WriteVaultCache(data []byte) error {
+	if c.IsLocked() {
+		return errors.New("config is locked")
+	}
+	if c.ConfigFile.RuntimeConfig.DoNotPersistConfig {
+		return nil
+	}
+
+	return c.writeVaultCache(data)
+}
+
+func (c *Config) writeVaultCache(data []byte) error {
+	encryptedData, err := c.encryptString(string(data))
+	if err != nil {
+		return err
+	}
+
+	path := c.vaultCachePath()
+	os.Remove(path)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write([]byte(encryptedData))
+	return err
+}
+
+func (c *Config) ReadVaultCache() ([]byte, error) {
+	if c.IsLocked() {
+		return nil, errors.New("config is locked")
+	}
+
+	return c.readVaultCache()
+}
+
+func (c *Config) readVaultCache() ([]byte, error) {
+	encryptedData, err := os.ReadFile(c.vaultCachePath())
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.decryptString(string(encryptedData))
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt vault cache: %s", err.Error())
+	}
+	return []byte(data), nil
+}
+
+func (c *Config) GetVaultCacheModTime() (time.Time, error) {
+	info, err := os.Stat(c.vaultCachePath())
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+func (c *Config) DeleteVaultCache() {
+	if c.ConfigFile.RuntimeConfig.ConfigDirectory == "" {
+		return
+	}
+	err := os.Remove(c.vaultCachePath())
+	if err != nil && !os.IsNotExist(err) {
+		log.Warn("could not delete vault cache: %s", err.Error())
+	}
+}
+
 func (c *Config) encryptString(data string) (string, error) {
 	if c.IsLocked() {
 		return "", errors.New("config is locked")
@@ -480,6 +690,13 @@ func (c *Config) decryptString(data string) (string, error) {
 }
 
 func (config *Config) WriteConfig() error {
+	if config.parent != nil {
+		config.mu.Lock()
+		configFile := config.ConfigFile
+		config.mu.Unlock()
+		return config.parent.writeProfile(config.profile, configFile)
+	}
+
 	if config.ConfigFile.RuntimeConfig.DoNotPersistConfig {
 		return nil
 	}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"errors"
+	"net/url"
+)
+
+const DefaultHTTPRetries = 3
+
+// HTTPSettings configure how the agent connects to the server, e.g. a self-hosted
+// instance behind an internal CA or a proxy. They apply to all accounts.
+type HTTPSettings struct {
+	// PEM file with certificates trusted in addition to the system ones
+	CABundle string `json:",omitempty"`
+	// PEM files for mutual TLS
+	ClientCertificate string `json:",omitempty"`
+	ClientKey         string `json:",omitempty"`
+	// proxy url, the HTTPS_PROXY / HTTP_PROXY environment variables are used if empty
+	Proxy string `json:",omitempty"`
+	// retries on network errors and server errors, 0 uses DefaultHTTPRetries and -1 disables them
+	Retries int `json:",omitempty"`
+}
+
+func (settings HTTPSettings) Validate() error {
+	if (settings.ClientCertificate == "") != (settings.ClientKey == "") {
+		return errors.New("client certificate and client key must be set together")
+	}
+	if settings.Proxy != "" {
+		proxyURL, err := url.Parse(settings.Proxy)
+		if err != nil {
+			return errors.New("invalid proxy url: " + err.Error())
+		}
+		if proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return errors.New("invalid proxy url, use e.g. http://proxy.example.com:3128")
+		}
+	}
+	if settings.Retries < -1 {
+		return errors.New("retries must be -1 or more")
+	}
+	return nil
+}
+
+// MaxRetries is the number of times a failed request is retried
+func (settings HTTPSettings) MaxRetries() int {
+	switch {
+	case settings.Retries < 0:
+		return 0
+	case settings.Retries == 0:
+		return DefaultHTTPRetries
+	default:
+		return settings.Retries
+	}
+}
+
+func (c *Config) HTTPSettings() HTTPSettings {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ConfigFile.HTTP == nil {
+		return HTTPSettings{}
+	}
+	return *c.ConfigFile.HTTP
+}
+
+func (c *Config) SetHTTPSettings(settings HTTPSettings) error {
+	if c.parent != nil {
+		return errors.New("http settings can only be configured on the default account")
+	}
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	previous := c.ConfigFile.HTTP
+	if settings == (HTTPSettings{}) {
+		c.ConfigFile.HTTP = nil
+	} else {
+		c.ConfigFile.HTTP = &settings
+	}
+	c.mu.Unlock()
+
+	if err := c.WriteConfig(); err != nil {
+		c.mu.Lock()
+		c.ConfigFile.HTTP = previous
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
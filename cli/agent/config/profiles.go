@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/quexten/goldwarden/cli/agent/pincache"
+)
+
+var profileNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// Profile returns the name of the account this config belongs to, empty for the default account.
+func (c *Config) Profile() string {
+	return c.profile
+}
+
+func (c *Config) eventData() map[string]string {
+	if c.profile == "" {
+		return nil
+	}
+	return map[string]string{"account": c.profile}
+}
+
+func (c *Config) ProfileNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.ConfigFile.Profiles))
+	for name := range c.ConfigFile.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenProfile returns the config of a profile stored in this config file.
+func (c *Config) OpenProfile(name string) (*Config, error) {
+	c.mu.Lock()
+	configFile, ok := c.ConfigFile.Profiles[name]
+	runtimeConfig := c.ConfigFile.RuntimeConfig
+	c.mu.Unlock()
+	if !ok {
+		return nil, errors.New("profile not found")
+	}
+
+	key := NewBuffer(32, c.useMemguard)
+	configFile.RuntimeConfig = runtimeConfig
+	return &Config{
+		useMemguard: c.useMemguard,
+		key:         &key,
+		ConfigFile:  configFile,
+		profile:     name,
+		parent:      c,
+	}, nil
+}
+
+// CreateProfile adds a profile with default server urls and its own device id. The pin of the
+// current session is reused when available, so that one pin unlocks all accounts.
+func (c *Config) CreateProfile(name string) (*Config, error) {
+	if c.parent != nil {
+		return nil, errors.New("profiles can only be created on the default account")
+	}
+	if !profileNamePattern.MatchString(name) {
+		return nil, errors.New("invalid profile name, use letters, digits, '.', '_' and '-'")
+	}
+
+	c.mu.Lock()
+	if _, ok := c.ConfigFile.Profiles[name]; ok {
+		c.mu.Unlock()
+		return nil, errors.New("profile already exists")
+	}
+	c.mu.Unlock()
+
+	defaultConfig := DefaultConfig(c.useMemguard)
+	deviceUUID, err := uuid.NewUUID()
+	if err != nil {
+		return nil, err
+	}
+	defaultConfig.ConfigFile.DeviceUUID = deviceUUID.String()
+	if err := c.writeProfile(name, defaultConfig.ConfigFile); err != nil {
+		return nil, err
+	}
+
+	profile, err := c.OpenProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	if pincache.HasPin() {
+		pin, err := pincache.GetPin()
+		if err == nil {
+			profile.UpdatePin(string(pin), true)
+		}
+	}
+	return profile, nil
+}
+
+func (c *Config) RemoveProfile(name string) error {
+	c.mu.Lock()
+	if _, ok := c.ConfigFile.Profiles[name]; !ok {
+		c.mu.Unlock()
+		return errors.New("profile not found")
+	}
+	delete(c.ConfigFile.Profiles, name)
+	c.mu.Unlock()
+
+	profile := Config{ConfigFile: ConfigFile{RuntimeConfig: c.ConfigFile.RuntimeConfig}, profile: name}
+	if err := os.Remove(profile.vaultCachePath()); err != nil && !os.IsNotExist(err) {
+		log.Warn("could not delete vault cache: %s", err.Error())
+	}
+	return c.WriteConfig()
+}
+
+func (c *Config) writeProfile(name string, configFile ConfigFile) error {
+	configFile.Profiles = nil
+	configFile.SSHAgents = nil
+	configFile.HTTP = nil
+
+	c.mu.Lock()
+	if c.ConfigFile.Profiles == nil {
+		c.ConfigFile.Profiles = make(map[string]ConfigFile)
+	}
+	c.ConfigFile.Profiles[name] = configFile
+	c.mu.Unlock()
+
+	return c.WriteConfig()
+}
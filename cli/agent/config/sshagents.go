@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"maps"
+	"strings"
+)
+
+// SSHAgentProfile is an additional ssh agent socket serving only the vault keys it selects.
+// A key is selected if it matches at least one entry of every non-empty list.
+type SSHAgentProfile struct {
+	SocketPath string
+	// folder names
+	Folders []string `json:",omitempty"`
+	// patterns like work-*, matched against the key name
+	NamePatterns []string `json:",omitempty"`
+	// custom fields as name=value, the value may be a pattern
+	Fields []string `json:",omitempty"`
+}
+
+func (profile SSHAgentProfile) Validate() error {
+	if profile.SocketPath == "" {
+		return errors.New("socket path is required")
+	}
+	if len(profile.Folders) == 0 && len(profile.NamePatterns) == 0 && len(profile.Fields) == 0 {
+		return errors.New("select keys by folder, name pattern or field")
+	}
+	for _, field := range profile.Fields {
+		if name, _, found := strings.Cut(field, "="); !found || name == "" {
+			return errors.New("invalid field " + field + ", use name=value")
+		}
+	}
+	return nil
+}
+
+func (c *Config) SSHAgentProfiles() map[string]SSHAgentProfile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.ConfigFile.SSHAgents)
+}
+
+func (c *Config) SetSSHAgentProfile(name string, profile SSHAgentProfile) error {
+	if c.parent != nil {
+		return errors.New("ssh agent profiles can only be configured on the default account")
+	}
+	if !profileNamePattern.MatchString(name) {
+		return errors.New("invalid profile name, use letters, digits, '.', '_' and '-'")
+	}
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	for otherName, other := range c.ConfigFile.SSHAgents {
+		if otherName != name && other.SocketPath == profile.SocketPath {
+			c.mu.Unlock()
+			return errors.New("socket path is already used by ssh agent profile " + otherName)
+		}
+	}
+	if profile.SocketPath == c.ConfigFile.RuntimeConfig.SSHAgentSocketPath {
+		c.mu.Unlock()
+		return errors.New("socket path is used by the main ssh agent")
+	}
+	if c.ConfigFile.SSHAgents == nil {
+		c.ConfigFile.SSHAgents = make(map[string]SSHAgentProfile)
+	}
+	c.ConfigFile.SSHAgents[name] = profile
+	c.mu.Unlock()
+
+	return c.WriteConfig()
+}
+
+func (c *Config) RemoveSSHAgentProfile(name string) error {
+	c.mu.Lock()
+	if _, ok := c.ConfigFile.SSHAgents[name]; !ok {
+		c.mu.Unlock()
+		return errors.New("ssh agent profile not found")
+	}
+	delete(c.ConfigFile.SSHAgents, name)
+	c.mu.Unlock()
+
+	return c.WriteConfig()
+}
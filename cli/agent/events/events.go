@@ -0,0 +1,88 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/quexten/goldwarden/cli/logging"
+)
+
+var log = logging.GetLogger("Goldwarden", "Events")
+
+type Type string
+
+const (
+	TypeLocked                Type = "locked"
+	TypeUnlocked              Type = "unlocked"
+	TypeSynced                Type = "synced"
+	TypeSyncFailed            Type = "sync-failed"
+	TypeWebsocketConnected    Type = "websocket-connected"
+	TypeWebsocketDisconnected Type = "websocket-disconnected"
+	TypeSSHSign               Type = "ssh-sign"
+	TypeAuthRequest           Type = "auth-request"
+)
+
+type Event struct {
+	Type Type
+	Time time.Time
+	Data map[string]string
+}
+
+// events are dropped for subscribers that do not keep up
+const subscriberBufferSize = 64
+
+type subscriber struct {
+	types  map[Type]bool
+	events chan Event
+}
+
+var subscribers = map[*subscriber]bool{}
+var mu sync.Mutex
+
+// Subscribe returns a channel receiving all events of the given types, or of all types if none
+// are given. The returned function ends the subscription and closes the channel.
+func Subscribe(types []Type) (<-chan Event, func()) {
+	sub := &subscriber{
+		types:  make(map[Type]bool),
+		events: make(chan Event, subscriberBufferSize),
+	}
+	for _, eventType := range types {
+		sub.types[eventType] = true
+	}
+
+	mu.Lock()
+	subscribers[sub] = true
+	mu.Unlock()
+
+	var once sync.Once
+	return sub.events, func() {
+		once.Do(func() {
+			mu.Lock()
+			delete(subscribers, sub)
+			mu.Unlock()
+			close(sub.events)
+		})
+	}
+}
+
+func Publish(eventType Type, data map[string]string) {
+	event := Event{
+		Type: eventType,
+		Time: time.Now().UTC(),
+		Data: data,
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for sub := range subscribers {
+		if len(sub.types) > 0 && !sub.types[eventType] {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			log.Warn("Dropping %s event for slow subscriber", eventType)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/quexten/goldwarden/cli/agent/accounts"
+	"github.com/quexten/goldwarden/cli/agent/actions"
+	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/events"
+	"github.com/quexten/goldwarden/cli/agent/sockets"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/pinentry"
+	"github.com/quexten/goldwarden/cli/ipc"
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+)
+
+type framedSession struct {
+	conn net.Conn
+	// config of the default account
+	cfg            *config.Config
+	callingContext sockets.CallingContext
+
+	writeMu sync.Mutex
+	// pinentry prompts are shown one at a time
+	promptMu sync.Mutex
+
+	mu                 sync.Mutex
+	nextID             uint64
+	pending            map[uint64]chan ipc.Frame
+	closed             bool
+	registeredPinentry *pinentry.Pinentry
+	unsubscribers      []func()
+}
+
+func serveFramedAgentSession(c net.Conn, reader io.Reader, cfg *config.Config) {
+	session := &framedSession{
+		conn:    c,
+		cfg:     cfg,
+		pending: make(map[uint64]chan ipc.Frame),
+	}
+	defer session.close()
+
+	frame, err := ipc.ReadFrame(reader)
+	if err != nil {
+		log.Warn("Could not read handshake: %s", err.Error())
+		return
+	}
+	if !session.handshake(frame) {
+		return
+	}
+	session.callingContext = sockets.GetCallingContext(c)
+
+	for {
+		frame, err := ipc.ReadFrame(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Warn("Could not read frame: %s", err.Error())
+			}
+			return
+		}
+
+		if frame.Reply {
+			session.deliverReply(frame)
+			continue
+		}
+		if frame.Message == nil {
+			session.write(ipc.ErrorFrame(frame.ID, messages.ErrorCodeInvalidMessage, "frame has no message"))
+			continue
+		}
+
+		switch frame.Message.Type {
+		case messages.MessageTypeForEmptyPayload(messages.SessionAuthRequest{}):
+			if cfg.ConfigFile.RuntimeConfig.DaemonAuthToken == "" {
+				return
+			}
+			if !session.validatePayload(frame) {
+				continue
+			}
+			req := messages.ParsePayload(*frame.Message).(messages.SessionAuthRequest)
+			session.reply(frame.ID, authenticateSession(req, session.callingContext, cfg))
+		case messages.MessageTypeForEmptyPayload(messages.PinentryRegistrationRequest{}):
+			if cfg.ConfigFile.RuntimeConfig.DaemonAuthToken == "" {
+				return
+			}
+			session.registerPinentry(frame.ID)
+		case messages.MessageTypeForEmptyPayload(messages.SubscribeEventsRequest{}):
+			if !session.validatePayload(frame) {
+				continue
+			}
+			req := messages.ParsePayload(*frame.Message).(messages.SubscribeEventsRequest)
+			session.subscribeEvents(frame.ID, req)
+		default:
+			go session.handleRequest(frame)
+		}
+	}
+}
+
+func (session *framedSession) handshake(frame ipc.Frame) bool {
+	if frame.Message == nil || frame.Message.Type != messages.MessageTypeForEmptyPayload(messages.ProtocolHandshakeRequest{}) {
+		session.write(ipc.ErrorFrame(frame.ID, messages.ErrorCodeInvalidMessage, "expected protocol handshake"))
+		return false
+	}
+	if !session.validatePayload(frame) {
+		return false
+	}
+
+	req := messages.ParsePayload(*frame.Message).(messages.ProtocolHandshakeRequest)
+	if req.Version < ipc.ProtocolVersion {
+		session.write(ipc.ErrorFrame(frame.ID, messages.ErrorCodeUnsupportedVersion, fmt.Sprintf("unsupported protocol version %d", req.Version)))
+		return false
+	}
+
+	// newer clients talk the highest version both sides support
+	return session.reply(frame.ID, messages.ProtocolHandshakeResponse{Version: ipc.ProtocolVersion}) == nil
+}
+
+// validatePayload replies with an error if the payload of the frame can not be parsed
+func (session *framedSession) validatePayload(frame ipc.Frame) bool {
+	if err := messages.ValidatePayload(*frame.Message); err != nil {
+		session.write(ipc.ErrorFrame(frame.ID, messages.ErrorCodeInvalidMessage, err.Error()))
+		return false
+	}
+	return true
+}
+
+func (session *framedSession) handleRequest(frame ipc.Frame) {
+	// a failing action must not take down the agent
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("Action panicked: %v", r)
+			session.write(ipc.ErrorFrame(frame.ID, messages.ErrorCodeInternal, fmt.Sprintf("action failed: %v", r)))
+		}
+	}()
+
+	action, found := actions.AgentActionsRegistry.Get(frame.Message.Type)
+	if !found {
+		session.write(ipc.ErrorFrame(frame.ID, messages.ErrorCodeUnknownAction, "Action not found"))
+		return
+	}
+	if !session.validatePayload(frame) {
+		return
+	}
+
+	account, found := accounts.Get(frame.Account)
+	if !found {
+		session.write(ipc.ErrorFrame(frame.ID, messages.ErrorCodeNotFound, "account not found"))
+		return
+	}
+
+	callingContext := session.callingContext
+	callingContext.ApprovedPolicyRules = map[int]bool{}
+	response, err := action(*frame.Message, account.Config, account.Vault, &callingContext)
+	if err != nil {
+		session.write(ipc.ErrorFrame(frame.ID, messages.ErrorCodeInternal, err.Error()))
+		return
+	}
+	session.write(ipc.ReplyFrame(frame.ID, response))
+}
+
+func (session *framedSession) reply(id uint64, payload interface{}) error {
+	message, err := messages.IPCMessageFromPayload(payload)
+	if err != nil {
+		session.write(ipc.ErrorFrame(id, messages.ErrorCodeInternal, err.Error()))
+		return err
+	}
+	return session.write(ipc.ReplyFrame(id, message))
+}
+
+func (session *framedSession) write(frame ipc.Frame) error {
+	session.writeMu.Lock()
+	defer session.writeMu.Unlock()
+
+	err := ipc.WriteFrame(session.conn, frame)
+	if err != nil {
+		log.Error("Failed writing to socket " + err.Error())
+	}
+	return err
+}
+
+// send sends a request to the client. If replyChan is set, the reply is delivered to it.
+func (session *framedSession) send(payload interface{}, replyChan chan ipc.Frame) error {
+	session.mu.Lock()
+	if session.closed {
+		session.mu.Unlock()
+		return errors.New("session closed")
+	}
+	session.nextID++
+	id := session.nextID
+	if replyChan != nil {
+		session.pending[id] = replyChan
+	}
+	session.mu.Unlock()
+
+	frame, err := ipc.RequestFrame(id, payload)
+	if err == nil {
+		err = session.write(frame)
+	}
+	if err != nil {
+		session.mu.Lock()
+		delete(session.pending, id)
+		session.mu.Unlock()
+	}
+	return err
+}
+
+// request sends a request to the client and waits for its reply, used for pinentry prompts.
+func (session *framedSession) request(payload interface{}) (interface{}, error) {
+	replyChan := make(chan ipc.Frame, 1)
+	if err := session.send(payload, replyChan); err != nil {
+		return nil, err
+	}
+
+	reply, ok := <-replyChan
+	if !ok {
+		return nil, errors.New("session closed")
+	}
+	if reply.Message != nil {
+		if err := messages.ValidatePayload(*reply.Message); err != nil {
+			return nil, err
+		}
+	}
+	return reply.Payload()
+}
+
+func (session *framedSession) deliverReply(frame ipc.Frame) {
+	session.mu.Lock()
+	replyChan, ok := session.pending[frame.ID]
+	delete(session.pending, frame.ID)
+	session.mu.Unlock()
+
+	if !ok {
+		log.Warn("Received reply for unknown request %d", frame.ID)
+		return
+	}
+	replyChan <- frame
+}
+
+func (session *framedSession) registerPinentry(id uint64) {
+	log.Info("Received pinentry registration request")
+
+	sessionPinentry := &pinentry.Pinentry{
+		GetPassword: func(title string, description string) (string, error) {
+			session.promptMu.Lock()
+			defer session.promptMu.Unlock()
+
+			response, err := session.request(messages.PinentryPinRequest{Message: description})
+			if err != nil {
+				return "", err
+			}
+			pinResponse, ok := response.(messages.PinentryPinResponse)
+			if !ok {
+				return "", errors.New("invalid pinentry response")
+			}
+			return pinResponse.Pin, nil
+		},
+		GetApproval: func(title string, description string) (bool, error) {
+			session.promptMu.Lock()
+			defer session.promptMu.Unlock()
+
+			response, err := session.request(messages.PinentryApprovalRequest{Message: description})
+			if err != nil {
+				return false, err
+			}
+			approvalResponse, ok := response.(messages.PinentryApprovalResponse)
+			if !ok {
+				return false, errors.New("invalid pinentry response")
+			}
+			return approvalResponse.Approved, nil
+		},
+	}
+	err := pinentry.SetExternalPinentry(sessionPinentry)
+	log.Info("Pinentry registration success: %t", err == nil)
+
+	if err == nil {
+		session.mu.Lock()
+		session.registeredPinentry = sessionPinentry
+		session.mu.Unlock()
+	}
+	session.reply(id, messages.PinentryRegistrationResponse{Success: err == nil})
+}
+
+// subscribeEvents streams events to the client until the connection is closed.
+func (session *framedSession) subscribeEvents(id uint64, req messages.SubscribeEventsRequest) {
+	types := make([]events.Type, 0, len(req.Types))
+	for _, eventType := range req.Types {
+		types = append(types, events.Type(eventType))
+	}
+
+	eventChan, unsubscribe := events.Subscribe(types)
+	session.mu.Lock()
+	if session.closed {
+		session.mu.Unlock()
+		unsubscribe()
+		return
+	}
+	session.unsubscribers = append(session.unsubscribers, unsubscribe)
+	session.mu.Unlock()
+
+	if err := session.reply(id, messages.SubscribeEventsResponse{Success: true}); err != nil {
+		return
+	}
+
+	go func() {
+		for event := range eventChan {
+			err := session.send(messages.AgentEvent{
+				Type: string(event.Type),
+				Time: event.Time,
+				Data: event.Data,
+			}, nil)
+			if err != nil {
+				unsubscribe()
+				return
+			}
+		}
+	}()
+}
+
+func (session *framedSession) close() {
+	session.mu.Lock()
+	session.closed = true
+	for id, replyChan := range session.pending {
+		close(replyChan)
+		delete(session.pending, id)
+	}
+	registeredPinentry := session.registeredPinentry
+	unsubscribers := session.unsubscribers
+	session.unsubscribers = nil
+	session.mu.Unlock()
+
+	for _, unsubscribe := range unsubscribers {
+		unsubscribe()
+	}
+
+	if registeredPinentry != nil {
+		pinentry.ClearExternalPinentry(registeredPinentry)
+	}
+	session.conn.Close()
+}
@@ -2,7 +2,9 @@ package sockets
 
 import (
 	"net"
+	"os"
 	"os/user"
+	"strconv"
 
 	gops "github.com/mitchellh/go-ps"
 	"github.com/tailscale/peercred"
@@ -11,6 +13,7 @@ import (
 type CallingContext struct {
 	UserName               string
 	ProcessName            string
+	ProcessPath            string
 	ParentProcessName      string
 	GrandParentProcessName string
 	ProcessPid             int
@@ -18,6 +21,8 @@ type CallingContext struct {
 	GrandParentProcessPid  int
 	Error                  bool
 	Authenticated          bool
+	// policy rules approved while handling the current request, shared by the copies of the context
+	ApprovedPolicyRules map[int]bool
 }
 
 func GetCallingContext(connection net.Conn) CallingContext {
@@ -83,6 +88,7 @@ func GetCallingContext(connection net.Conn) CallingContext {
 	return CallingContext{
 		UserName:               username.Username,
 		ProcessName:            process.Executable(),
+		ProcessPath:            processPath(pid),
 		ParentProcessName:      parentProcess.Executable(),
 		GrandParentProcessName: parentParentProcess.Executable(),
 		ProcessPid:             pid,
@@ -91,3 +97,12 @@ func GetCallingContext(connection net.Conn) CallingContext {
 		Error:                  false,
 	}
 }
+
+// only available on systems with procfs
+func processPath(pid int) string {
+	path, err := os.Readlink("/proc/" + strconv.Itoa(pid) + "/exe")
+	if err != nil {
+		return ""
+	}
+	return path
+}
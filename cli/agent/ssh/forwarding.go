@@ -0,0 +1,110 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/quexten/goldwarden/cli/agent/vault"
+	"golang.org/x/crypto/ssh"
+)
+
+// a key with this custom field set to "never" is not usable through a forwarded agent
+const fieldAgentForwarding = "agent-forwarding"
+
+// remoteOrigin is where a request comes from if it was not made on this machine.
+type remoteOrigin struct {
+	// the ssh client bound the connection to a host it forwards the agent to
+	forwarded bool
+	// name or fingerprint of the host, or the address of the ssh client for remote sessions
+	host        string
+	fingerprint string
+}
+
+func (origin remoteOrigin) String() string {
+	if origin.forwarded && origin.host != origin.fingerprint {
+		return "remote host " + origin.host + " " + origin.fingerprint + " (forwarded agent)"
+	}
+	if origin.forwarded {
+		return "remote host " + origin.host + " (forwarded agent)"
+	}
+	return "remote ssh session from " + origin.host
+}
+
+// remoteOrigin detects forwarded requests: either the ssh client bound the connection for
+// forwarding with session-bind@openssh.com, or the calling process runs in an ssh login session.
+func (vaultAgent vaultAgent) remoteOrigin() (remoteOrigin, bool) {
+	bindings := vaultAgent.connection.getBindings()
+	for i := len(bindings) - 1; i >= 0; i-- {
+		if bindings[i].forwarding {
+			return remoteOrigin{
+				forwarded:   true,
+				host:        hostName(bindings[i].hostKey),
+				fingerprint: ssh.FingerprintSHA256(bindings[i].hostKey),
+			}, true
+		}
+	}
+
+	ctx := vaultAgent.context
+	if ctx.Error {
+		return remoteOrigin{}, false
+	}
+	ancestry := []string{ctx.ProcessName, ctx.ParentProcessName, ctx.GrandParentProcessName}
+	if client, ok := sshClientAddress(ctx.ProcessPid); ok {
+		return remoteOrigin{host: client}, true
+	}
+	if slices.Contains(ancestry, "sshd") || slices.Contains(ancestry, "sshd-session") {
+		return remoteOrigin{host: "unknown client"}, true
+	}
+	return remoteOrigin{}, false
+}
+
+// sshClientAddress reads SSH_CONNECTION from the environment of a process of an ssh login session.
+func sshClientAddress(pid int) (string, bool) {
+	if pid == 0 {
+		return "", false
+	}
+	environ, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/environ")
+	if err != nil {
+		return "", false
+	}
+	for _, variable := range bytes.Split(environ, []byte{0}) {
+		if value, found := strings.CutPrefix(string(variable), "SSH_CONNECTION="); found {
+			if fields := strings.Fields(value); len(fields) > 0 {
+				return fields[0], true
+			}
+		}
+	}
+	return "", false
+}
+
+// hostName returns the first plain host name of a host key in the known_hosts files, or its fingerprint.
+func hostName(hostKey ssh.PublicKey) string {
+	for _, file := range knownHostsFiles() {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			_, hosts, key, _, _, err := ssh.ParseKnownHosts(scanner.Bytes())
+			if err != nil || !Eq(key, hostKey) {
+				continue
+			}
+			for _, host := range hosts {
+				if !strings.HasPrefix(host, "|") {
+					return host
+				}
+			}
+		}
+	}
+	return ssh.FingerprintSHA256(hostKey)
+}
+
+// ForwardingDenied reports whether a key may not be used through a forwarded agent or from a remote ssh session.
+func ForwardingDenied(sshKey vault.SSHKey) bool {
+	return strings.EqualFold(strings.TrimSpace(sshKey.Fields[fieldAgentForwarding]), "never")
+}
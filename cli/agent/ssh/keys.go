@@ -1,10 +1,16 @@
 package ssh
 
 import (
+	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/pem"
-	"io"
+	"errors"
+	"slices"
+	"strings"
 
 	"github.com/mikesmitty/edkey"
 	"github.com/quexten/goldwarden/cli/agent/bitwarden/crypto"
@@ -12,112 +18,318 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-// todo refactor to share code
+const (
+	KeyTypeED25519   = "ed25519"
+	KeyTypeECDSAP256 = "ecdsa-p256"
+	KeyTypeECDSAP384 = "ecdsa-p384"
+	KeyTypeRSA3072   = "rsa-3072"
+	KeyTypeRSA4096   = "rsa-4096"
+)
+
+var KeyTypes = []string{KeyTypeED25519, KeyTypeECDSAP256, KeyTypeECDSAP384, KeyTypeRSA3072, KeyTypeRSA4096, KeyTypeED25519SK, KeyTypeECDSASK}
+
+var errPassphraseRequired = errors.New("passphrase required")
+
+// maximum number of passphrase prompts when importing an encrypted key
+const maxPassphraseAttempts = 3
+
+// SSHKeyCipherFromKey creates a native ssh key cipher for an unencrypted OpenSSH private key.
 func SSHKeyCipherFromKey(name string, privateKey string, keyring *crypto.Keyring) (models.Cipher, string, error) {
-	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	sshKey, pubKey, err := sshKeyCipherData(privateKey, keyring.GetAccountKey())
+	if err != nil {
+		return models.Cipher{}, "", err
+	}
+	encryptedName, err := crypto.EncryptWith([]byte(name), crypto.AesCbc256_HmacSha256_B64, keyring.GetAccountKey())
 	if err != nil {
 		return models.Cipher{}, "", err
 	}
-
-	pubKey := signer.PublicKey()
-	encryptedName, _ := crypto.EncryptWith([]byte(name), crypto.AesCbc256_HmacSha256_B64, keyring.GetAccountKey())
-	encryptedPublicKeyKey, _ := crypto.EncryptWith([]byte("public-key"), crypto.AesCbc256_HmacSha256_B64, keyring.GetAccountKey())
-	encryptedPublicKeyValue, _ := crypto.EncryptWith([]byte(string(ssh.MarshalAuthorizedKey(pubKey))), crypto.AesCbc256_HmacSha256_B64, keyring.GetAccountKey())
-	encryptedCustomTypeKey, _ := crypto.EncryptWith([]byte("custom-type"), crypto.AesCbc256_HmacSha256_B64, keyring.GetAccountKey())
-	encryptedCustomTypeValue, _ := crypto.EncryptWith([]byte("ssh-key"), crypto.AesCbc256_HmacSha256_B64, keyring.GetAccountKey())
-	encryptedPrivateKeyKey, _ := crypto.EncryptWith([]byte("private-key"), crypto.AesCbc256_HmacSha256_B64, keyring.GetAccountKey())
-	encryptedPrivateKeyValue, _ := crypto.EncryptWith([]byte(privateKey), crypto.AesCbc256_HmacSha256_B64, keyring.GetAccountKey())
 
 	cipher := models.Cipher{
-		Type:           models.CipherNote,
+		Type:           models.CipherSSHKey,
 		Name:           encryptedName,
-		Notes:          &encryptedPublicKeyValue,
 		ID:             nil,
 		Favorite:       false,
 		OrganizationID: nil,
-		SecureNote: &models.SecureNoteCipher{
-			Type: 0,
-		},
-		Fields: []models.Field{
-			{
-				Type:  0,
-				Name:  encryptedCustomTypeKey,
-				Value: encryptedCustomTypeValue,
-			},
-			{
-				Type:  0,
-				Name:  encryptedPublicKeyKey,
-				Value: encryptedPublicKeyValue,
-			},
-			{
-				Type:  1,
-				Name:  encryptedPrivateKeyKey,
-				Value: encryptedPrivateKeyValue,
-			},
-		},
+		SSHKey:         sshKey,
 	}
 
 	return cipher, string(ssh.MarshalAuthorizedKey(pubKey)), nil
 }
 
-func NewSSHKeyCipher(name string, keyring *crypto.Keyring) (models.Cipher, string, error) {
-	var reader io.Reader = rand.Reader
-	pub, priv, err := ed25519.GenerateKey(reader)
+func sshKeyCipherData(privateKey string, key crypto.SymmetricEncryptionKey) (*models.SSHKeyCipher, ssh.PublicKey, error) {
+	signer, err := parsePrivateKeySigner(privateKey, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	pubKey := signer.PublicKey()
 
+	encryptedPrivateKey, err := crypto.EncryptWith([]byte(privateKey), crypto.AesCbc256_HmacSha256_B64, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptedPublicKey, err := crypto.EncryptWith([]byte(strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pubKey)))), crypto.AesCbc256_HmacSha256_B64, key)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
 	}
-	privBlock := pem.Block{
-		Type:  "OPENSSH PRIVATE KEY",
-		Bytes: edkey.MarshalED25519PrivateKey(priv),
+	encryptedFingerprint, err := crypto.EncryptWith([]byte(ssh.FingerprintSHA256(pubKey)), crypto.AesCbc256_HmacSha256_B64, key)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	privatePEM := pem.EncodeToMemory(&privBlock)
-	publicKey, err := ssh.NewPublicKey(pub)
+	return &models.SSHKeyCipher{
+		PrivateKey:     encryptedPrivateKey,
+		PublicKey:      encryptedPublicKey,
+		KeyFingerprint: encryptedFingerprint,
+	}, pubKey, nil
+}
+
+// legacy ssh key note fields that are replaced by the native ssh key data
+var legacySSHKeyFields = []string{"custom-type", "public-key", "private-key", "certificate"}
+
+// NativeSSHKeyCipher converts a legacy ssh key note to a native ssh key cipher with the same id.
+// privateKey is the decrypted private key of the note and key the key of the cipher. Custom fields
+// like allowed-hosts are kept.
+func NativeSSHKeyCipher(note models.Cipher, privateKey string, key crypto.SymmetricEncryptionKey) (models.Cipher, string, error) {
+	sshKey, pubKey, err := sshKeyCipherData(privateKey, key)
 	if err != nil {
-		log.Error("Generation of public key failed: %s", err)
+		return models.Cipher{}, "", err
+	}
+
+	fields := make([]models.Field, 0, len(note.Fields))
+	for _, field := range note.Fields {
+		fieldName, err := crypto.DecryptWith(field.Name, key)
+		if err != nil {
+			return models.Cipher{}, "", err
+		}
+		if string(fieldName) == "certificate" {
+			certificate := field.Value
+			sshKey.Certificate = &certificate
+		}
+		if !slices.Contains(legacySSHKeyFields, string(fieldName)) {
+			fields = append(fields, field)
+		}
+	}
+
+	cipher := note
+	cipher.Type = models.CipherSSHKey
+	cipher.SecureNote = nil
+	cipher.SSHKey = sshKey
+	cipher.Fields = fields
+	// legacy notes repeat the public key in the notes
+	if note.Notes != nil {
+		notes, err := crypto.DecryptWith(*note.Notes, key)
+		if err == nil && strings.TrimSpace(string(notes)) == strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pubKey))) {
+			cipher.Notes = nil
+		}
+	}
+
+	return cipher, ssh.FingerprintSHA256(pubKey), nil
+}
+
+// GeneratePrivateKey creates a new key of the given type in OpenSSH format.
+func GeneratePrivateKey(keyType string) (string, error) {
+	var privateKey interface{}
+	var err error
+	switch keyType {
+	case KeyTypeED25519, "":
+		var priv ed25519.PrivateKey
+		if _, priv, err = ed25519.GenerateKey(rand.Reader); err != nil {
+			return "", err
+		}
+		return string(pem.EncodeToMemory(&pem.Block{
+			Type:  "OPENSSH PRIVATE KEY",
+			Bytes: edkey.MarshalED25519PrivateKey(priv),
+		})), nil
+	case KeyTypeECDSAP256:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeECDSAP384:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyTypeRSA3072:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 3072)
+	case KeyTypeRSA4096:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 4096)
+	case KeyTypeED25519SK, KeyTypeECDSASK:
+		return generateSKPrivateKey(keyType)
+	default:
+		return "", errors.New("unsupported key type " + keyType + ", use one of " + strings.Join(KeyTypes, ", "))
 	}
-	_, err = ssh.ParsePrivateKey([]byte(string(privatePEM)))
 	if err != nil {
-		log.Error("Verification of generated private key failed: %s", err)
+		return "", err
 	}
 
-	encryptedName, _ := crypto.EncryptWith([]byte(name), crypto.AesCbc256_HmacSha256_B64, keyring.GetAccountKey())
-	encryptedPublicKeyKey, _ := crypto.EncryptWith([]byte("public-key"), crypto.AesCbc256_HmacSha256_B64, keyring.GetAccountKey())
-	encryptedPublicKeyValue, _ := crypto.EncryptWith([]byte(string(ssh.MarshalAuthorizedKey(publicKey))), crypto.AesCbc256_HmacSha256_B64, keyring.GetAccountKey())
-	encryptedCustomTypeKey, _ := crypto.EncryptWith([]byte("custom-type"), crypto.AesCbc256_HmacSha256_B64, keyring.GetAccountKey())
-	encryptedCustomTypeValue, _ := crypto.EncryptWith([]byte("ssh-key"), crypto.AesCbc256_HmacSha256_B64, keyring.GetAccountKey())
-	encryptedPrivateKeyKey, _ := crypto.EncryptWith([]byte("private-key"), crypto.AesCbc256_HmacSha256_B64, keyring.GetAccountKey())
-	encryptedPrivateKeyValue, _ := crypto.EncryptWith(privatePEM, crypto.AesCbc256_HmacSha256_B64, keyring.GetAccountKey())
+	block, err := ssh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(block)), nil
+}
 
-	cipher := models.Cipher{
-		Type:           models.CipherNote,
-		Name:           encryptedName,
-		Notes:          &encryptedPublicKeyValue,
-		ID:             nil,
-		Favorite:       false,
-		OrganizationID: nil,
-		SecureNote: &models.SecureNoteCipher{
-			Type: 0,
-		},
-		Fields: []models.Field{
-			{
-				Type:  0,
-				Name:  encryptedCustomTypeKey,
-				Value: encryptedCustomTypeValue,
-			},
-			{
-				Type:  0,
-				Name:  encryptedPublicKeyKey,
-				Value: encryptedPublicKeyValue,
-			},
-			{
-				Type:  1,
-				Name:  encryptedPrivateKeyKey,
-				Value: encryptedPrivateKeyValue,
-			},
-		},
-	}
-
-	return cipher, string(ssh.MarshalAuthorizedKey(publicKey)), nil
+func NewSSHKeyCipher(name string, keyType string, keyring *crypto.Keyring) (models.Cipher, string, error) {
+	privateKey, err := GeneratePrivateKey(keyType)
+	if err != nil {
+		return models.Cipher{}, "", err
+	}
+	return SSHKeyCipherFromKey(name, privateKey, keyring)
+}
+
+// ImportPrivateKey converts an OpenSSH, PEM, PKCS#8 or PuTTY key to an unencrypted OpenSSH key.
+// getPassphrase is called when the key is encrypted.
+func ImportPrivateKey(data string, getPassphrase func() (string, error)) (string, error) {
+	// only the key handle is stored, the private key stays on the security key
+	if isSKPrivateKey([]byte(data)) {
+		key, err := parseSKPrivateKey([]byte(data))
+		if err != nil {
+			return "", err
+		}
+		return key.marshal()
+	}
+
+	rawKey, err := parseRawPrivateKey([]byte(data), nil)
+	for attempt := 0; errors.Is(err, errPassphraseRequired) || (attempt > 0 && errors.Is(err, x509.IncorrectPasswordError)); attempt++ {
+		if attempt == maxPassphraseAttempts {
+			return "", errors.New("incorrect passphrase")
+		}
+		passphrase, promptErr := getPassphrase()
+		if promptErr != nil {
+			return "", errPassphraseRequired
+		}
+		rawKey, err = parseRawPrivateKey([]byte(data), []byte(passphrase))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if key, ok := rawKey.(*ed25519.PrivateKey); ok {
+		rawKey = *key
+	}
+	block, err := ssh.MarshalPrivateKey(rawKey, "")
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(block)), nil
+}
+
+// parseRawPrivateKey returns errPassphraseRequired if the key is encrypted and passphrase is nil.
+func parseRawPrivateKey(data []byte, passphrase []byte) (interface{}, error) {
+	if isPPK(data) {
+		return parsePPK(data, passphrase)
+	}
+
+	if block, _ := pem.Decode(data); block != nil && block.Type == "ENCRYPTED PRIVATE KEY" {
+		if passphrase == nil {
+			return nil, errPassphraseRequired
+		}
+		der, err := decryptPKCS8(block.Bytes, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		key, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			// padding can look valid by chance with a wrong passphrase
+			return nil, x509.IncorrectPasswordError
+		}
+		return key, nil
+	}
+
+	if passphrase == nil {
+		key, err := ssh.ParseRawPrivateKey(data)
+		var passphraseMissing *ssh.PassphraseMissingError
+		if errors.As(err, &passphraseMissing) {
+			return nil, errPassphraseRequired
+		}
+		return key, err
+	}
+	return ssh.ParseRawPrivateKeyWithPassphrase(data, passphrase)
+}
+
+// ParseCertificate parses an OpenSSH certificate in authorized_keys format.
+func ParseCertificate(certificate string) (*ssh.Certificate, error) {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(certificate))
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.New("not an ssh certificate")
+	}
+	return cert, nil
+}
+
+// SetCertificate attaches a certificate to an ssh key cipher, replacing the previous one. The
+// certificate has to be issued for publicKey.
+func SetCertificate(cipher *models.Cipher, publicKey string, certificate string, key crypto.SymmetricEncryptionKey) error {
+	cert, err := ParseCertificate(certificate)
+	if err != nil {
+		return err
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return err
+	}
+	if !Eq(cert.Key, pub) {
+		return errors.New("certificate does not belong to this key")
+	}
+
+	certificate = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(cert)))
+	encryptedCertificate, err := crypto.EncryptWith([]byte(certificate), crypto.AesCbc256_HmacSha256_B64, key)
+	if err != nil {
+		return err
+	}
+
+	if cipher.SSHKey != nil {
+		sshKey := *cipher.SSHKey
+		sshKey.Certificate = &encryptedCertificate
+		cipher.SSHKey = &sshKey
+		return nil
+	}
+
+	// copy the fields so a failed request does not modify the cached cipher
+	fields := make([]models.Field, len(cipher.Fields))
+	copy(fields, cipher.Fields)
+	for i, field := range fields {
+		fieldName, err := crypto.DecryptWith(field.Name, key)
+		if err == nil && string(fieldName) == "certificate" {
+			fields[i].Value = encryptedCertificate
+			cipher.Fields = fields
+			return nil
+		}
+	}
+
+	encryptedCertificateKey, err := crypto.EncryptWith([]byte("certificate"), crypto.AesCbc256_HmacSha256_B64, key)
+	if err != nil {
+		return err
+	}
+	cipher.Fields = append(fields, models.Field{
+		Type:  0,
+		Name:  encryptedCertificateKey,
+		Value: encryptedCertificate,
+	})
+	return nil
+}
+
+// DescribePublicKey returns the key type and size as shown by ssh-keygen -l, e.g. ED25519 and 256.
+func DescribePublicKey(pub ssh.PublicKey) (string, int) {
+	if cert, ok := pub.(*ssh.Certificate); ok {
+		keyType, bits := DescribePublicKey(cert.Key)
+		return keyType + "-CERT", bits
+	}
+
+	cryptoPub, ok := pub.(ssh.CryptoPublicKey)
+	if !ok {
+		return strings.ToUpper(pub.Type()), 0
+	}
+	suffix := ""
+	if isSecurityKey(pub) {
+		suffix = "-SK"
+	}
+	switch key := cryptoPub.CryptoPublicKey().(type) {
+	case *rsa.PublicKey:
+		return "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ECDSA" + suffix, key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "ED25519" + suffix, 256
+	default:
+		return strings.ToUpper(pub.Type()), 0
+	}
 }
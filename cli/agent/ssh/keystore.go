@@ -0,0 +1,222 @@
+package ssh
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// sessionKey is a key added with ssh-add. It only lives in memory until the daemon exits.
+type sessionKey struct {
+	signer  ssh.Signer
+	comment string
+	// zero if the key has no lifetime
+	expires time.Time
+	confirm bool
+	// set with ssh-add -h
+	destinations []destinationConstraint
+}
+
+// sessionKeystore holds keys added with ssh-add, vault keys removed with ssh-add -d/-D and the
+// agent lock set with ssh-add -x.
+type sessionKeystore struct {
+	mu   sync.Mutex
+	keys []*sessionKey
+	// marshalled public keys of hidden vault keys
+	hiddenVaultKeys map[string]bool
+	hideAllVault    bool
+
+	locked         bool
+	passphraseSalt []byte
+	passphraseHash []byte
+}
+
+var keystore = &sessionKeystore{
+	hiddenVaultKeys: make(map[string]bool),
+}
+
+var errAgentLocked = errors.New("agent is locked")
+
+func (store *sessionKeystore) add(key agent.AddedKey) error {
+	var destinations []destinationConstraint
+	for _, constraint := range key.ConstraintExtensions {
+		if constraint.ExtensionName != constraintRestrictDestination || destinations != nil {
+			return errors.New("unsupported key constraint")
+		}
+		var err error
+		if destinations, err = parseDestinationConstraints(constraint.ExtensionDetails); err != nil {
+			return err
+		}
+	}
+
+	signer, err := ssh.NewSignerFromKey(key.PrivateKey)
+	if err != nil {
+		return err
+	}
+	if key.Certificate != nil {
+		signer, err = ssh.NewCertSigner(key.Certificate, signer)
+		if err != nil {
+			return err
+		}
+	}
+
+	newKey := &sessionKey{
+		signer:       signer,
+		comment:      key.Comment,
+		confirm:      key.ConfirmBeforeUse,
+		destinations: destinations,
+	}
+	if key.LifetimeSecs > 0 {
+		newKey.expires = time.Now().Add(time.Duration(key.LifetimeSecs) * time.Second)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.locked {
+		return errAgentLocked
+	}
+
+	// adding a key again replaces it, like in ssh-agent
+	blob := signer.PublicKey().Marshal()
+	store.removeLocked(blob)
+	store.keys = append(store.keys, newKey)
+	delete(store.hiddenVaultKeys, string(blob))
+	return nil
+}
+
+// list returns the keys that have not expired.
+func (store *sessionKeystore) list() []*sessionKey {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.locked {
+		return nil
+	}
+
+	now := time.Now()
+	valid := store.keys[:0]
+	for _, key := range store.keys {
+		if key.expires.IsZero() || now.Before(key.expires) {
+			valid = append(valid, key)
+		}
+	}
+	store.keys = valid
+
+	result := make([]*sessionKey, len(valid))
+	copy(result, valid)
+	return result
+}
+
+func (store *sessionKeystore) find(key ssh.PublicKey) *sessionKey {
+	for _, sessionKey := range store.list() {
+		if Eq(sessionKey.signer.PublicKey(), key) {
+			return sessionKey
+		}
+	}
+	return nil
+}
+
+func (store *sessionKeystore) removeLocked(blob []byte) bool {
+	for i, key := range store.keys {
+		if string(key.signer.PublicKey().Marshal()) == string(blob) {
+			store.keys = append(store.keys[:i], store.keys[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// remove deletes a session key, or hides the vault key if isVaultKey is set.
+func (store *sessionKeystore) remove(key ssh.PublicKey, isVaultKey bool) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.locked {
+		return errAgentLocked
+	}
+
+	blob := key.Marshal()
+	removed := store.removeLocked(blob)
+	if isVaultKey {
+		store.hiddenVaultKeys[string(blob)] = true
+		removed = true
+	}
+	if !removed {
+		return errors.New("key not found")
+	}
+	return nil
+}
+
+func (store *sessionKeystore) removeAll() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.locked {
+		return errAgentLocked
+	}
+
+	store.keys = nil
+	store.hideAllVault = true
+	return nil
+}
+
+func (store *sessionKeystore) isVaultKeyHidden(key ssh.PublicKey) bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.hideAllVault || store.hiddenVaultKeys[string(key.Marshal())]
+}
+
+func (store *sessionKeystore) isLocked() bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.locked
+}
+
+func hashPassphrase(salt []byte, passphrase []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{}, salt...), passphrase...))
+	return hash[:]
+}
+
+func (store *sessionKeystore) lock(passphrase []byte) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.locked {
+		return errAgentLocked
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	store.passphraseSalt = salt
+	store.passphraseHash = hashPassphrase(salt, passphrase)
+	store.locked = true
+	return nil
+}
+
+func (store *sessionKeystore) unlock(passphrase []byte) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if !store.locked {
+		return errors.New("agent is not locked")
+	}
+	if subtle.ConstantTimeCompare(hashPassphrase(store.passphraseSalt, passphrase), store.passphraseHash) != 1 {
+		return errors.New("incorrect passphrase")
+	}
+
+	store.locked = false
+	store.passphraseSalt = nil
+	store.passphraseHash = nil
+	return nil
+}
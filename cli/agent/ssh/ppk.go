@@ -0,0 +1,303 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh"
+)
+
+const ppkHeaderPrefix = "PuTTY-User-Key-File-"
+
+// bounds of the argon2 parameters of imported files, puttygen uses 8 MiB, 1 thread and a few passes
+const (
+	maxArgon2Memory      = 1024 * 1024 // KiB
+	maxArgon2Passes      = 256
+	maxArgon2Parallelism = 16
+)
+
+// ppkFile is a parsed PuTTY private key file.
+type ppkFile struct {
+	version     int
+	algorithm   string
+	encryption  string
+	comment     string
+	headers     map[string]string
+	publicBlob  []byte
+	privateBlob []byte
+	privateMAC  []byte
+}
+
+func isPPK(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte(ppkHeaderPrefix))
+}
+
+func readPPK(data []byte) (*ppkFile, error) {
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	file := &ppkFile{headers: make(map[string]string)}
+
+	readBlob := func(i int, count string) ([]byte, int, error) {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 || i+n >= len(lines) {
+			return nil, i, errors.New("invalid ppk line count")
+		}
+		blob, err := base64.StdEncoding.DecodeString(strings.Join(lines[i+1:i+1+n], ""))
+		return blob, i + n, err
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		key, value, found := strings.Cut(line, ": ")
+		if !found {
+			return nil, errors.New("invalid ppk line: " + line)
+		}
+
+		var err error
+		switch {
+		case strings.HasPrefix(key, ppkHeaderPrefix):
+			if file.version, err = strconv.Atoi(strings.TrimPrefix(key, ppkHeaderPrefix)); err != nil {
+				return nil, err
+			}
+			file.algorithm = value
+		case key == "Encryption":
+			file.encryption = value
+		case key == "Comment":
+			file.comment = value
+		case key == "Public-Lines":
+			file.publicBlob, i, err = readBlob(i, value)
+		case key == "Private-Lines":
+			file.privateBlob, i, err = readBlob(i, value)
+		case key == "Private-MAC":
+			file.privateMAC, err = hex.DecodeString(value)
+		default:
+			file.headers[key] = value
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if file.version != 2 && file.version != 3 {
+		return nil, errors.New("unsupported ppk version")
+	}
+	if file.publicBlob == nil || file.privateBlob == nil || file.privateMAC == nil {
+		return nil, errors.New("incomplete ppk file")
+	}
+	return file, nil
+}
+
+// parsePPK returns the private key of a PuTTY key file. Encrypted files need a passphrase.
+func parsePPK(data []byte, passphrase []byte) (interface{}, error) {
+	file, err := readPPK(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var macKey []byte
+	var newMAC func() hash.Hash
+	privateBlob := file.privateBlob
+	switch file.encryption {
+	case "none":
+		macKey, newMAC = file.macKey(nil, nil)
+	case "aes256-cbc":
+		if passphrase == nil {
+			return nil, errPassphraseRequired
+		}
+		cipherKey, iv, err := file.cipherKey(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		macKey, newMAC = file.macKey(passphrase, cipherKey)
+
+		block, err := aes.NewCipher(cipherKey[:32])
+		if err != nil {
+			return nil, err
+		}
+		if len(privateBlob)%block.BlockSize() != 0 {
+			return nil, errors.New("invalid ppk private key length")
+		}
+		privateBlob = make([]byte, len(file.privateBlob))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(privateBlob, file.privateBlob)
+	default:
+		return nil, errors.New("unsupported ppk encryption " + file.encryption)
+	}
+
+	mac := hmac.New(newMAC, macKey)
+	mac.Write(ssh.Marshal(struct {
+		Algorithm   string
+		Encryption  string
+		Comment     string
+		PublicBlob  []byte
+		PrivateBlob []byte
+	}{file.algorithm, file.encryption, file.comment, file.publicBlob, privateBlob}))
+	if !hmac.Equal(mac.Sum(nil), file.privateMAC) {
+		if file.encryption == "none" {
+			return nil, errors.New("ppk file is corrupted")
+		}
+		return nil, x509.IncorrectPasswordError
+	}
+
+	return ppkPrivateKey(file.algorithm, file.publicBlob, privateBlob)
+}
+
+// cipherKey derives the aes key and iv of an encrypted ppk file. For version 3 files the returned
+// key also holds the mac key after the first 32 bytes.
+func (file *ppkFile) cipherKey(passphrase []byte) ([]byte, []byte, error) {
+	if file.version == 2 {
+		var key []byte
+		for i := byte(0); i < 2; i++ {
+			digest := sha1.Sum(append([]byte{0, 0, 0, i}, passphrase...))
+			key = append(key, digest[:]...)
+		}
+		return key[:32], make([]byte, aes.BlockSize), nil
+	}
+
+	salt, err := hex.DecodeString(file.headers["Argon2-Salt"])
+	if err != nil {
+		return nil, nil, err
+	}
+	memory, err1 := strconv.ParseUint(file.headers["Argon2-Memory"], 10, 32)
+	passes, err2 := strconv.ParseUint(file.headers["Argon2-Passes"], 10, 32)
+	parallelism, err3 := strconv.ParseUint(file.headers["Argon2-Parallelism"], 10, 8)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return nil, nil, err
+	}
+	if memory > maxArgon2Memory || passes < 1 || passes > maxArgon2Passes || parallelism < 1 || parallelism > maxArgon2Parallelism {
+		return nil, nil, errors.New("unsupported ppk argon2 parameters")
+	}
+
+	var derived []byte
+	switch file.headers["Key-Derivation"] {
+	case "Argon2id":
+		derived = argon2.IDKey(passphrase, salt, uint32(passes), uint32(memory), uint8(parallelism), 80)
+	case "Argon2i":
+		derived = argon2.Key(passphrase, salt, uint32(passes), uint32(memory), uint8(parallelism), 80)
+	default:
+		return nil, nil, errors.New("unsupported ppk key derivation " + file.headers["Key-Derivation"])
+	}
+	key := append(append([]byte{}, derived[:32]...), derived[48:]...)
+	return key, derived[32:48], nil
+}
+
+func (file *ppkFile) macKey(passphrase []byte, cipherKey []byte) ([]byte, func() hash.Hash) {
+	if file.version == 2 {
+		digest := sha1.Sum(append([]byte("putty-private-key-file-mac-key"), passphrase...))
+		return digest[:], sha1.New
+	}
+	if cipherKey == nil {
+		return []byte{}, sha256.New
+	}
+	return cipherKey[32:], sha256.New
+}
+
+func ppkPrivateKey(algorithm string, publicBlob []byte, privateBlob []byte) (interface{}, error) {
+	switch algorithm {
+	case ssh.KeyAlgoRSA:
+		var pub struct {
+			Type string
+			E    *big.Int
+			N    *big.Int
+		}
+		var priv struct {
+			D    *big.Int
+			P    *big.Int
+			Q    *big.Int
+			Iqmp *big.Int
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(publicBlob, &pub); err != nil {
+			return nil, err
+		}
+		if err := ssh.Unmarshal(privateBlob, &priv); err != nil {
+			return nil, err
+		}
+		if !pub.E.IsInt64() {
+			return nil, errors.New("invalid rsa exponent")
+		}
+
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: pub.N, E: int(pub.E.Int64())},
+			D:         priv.D,
+			Primes:    []*big.Int{priv.P, priv.Q},
+		}
+		if err := key.Validate(); err != nil {
+			return nil, err
+		}
+		key.Precompute()
+		return key, nil
+	case ssh.KeyAlgoED25519:
+		var priv struct {
+			Seed []byte
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(privateBlob, &priv); err != nil {
+			return nil, err
+		}
+		if len(priv.Seed) != ed25519.SeedSize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+		return ed25519.NewKeyFromSeed(priv.Seed), nil
+	case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521:
+		var pub struct {
+			Type  string
+			Curve string
+			Point []byte
+		}
+		var priv struct {
+			D    *big.Int
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(publicBlob, &pub); err != nil {
+			return nil, err
+		}
+		if err := ssh.Unmarshal(privateBlob, &priv); err != nil {
+			return nil, err
+		}
+
+		var curve elliptic.Curve
+		switch algorithm {
+		case ssh.KeyAlgoECDSA256:
+			curve = elliptic.P256()
+		case ssh.KeyAlgoECDSA384:
+			curve = elliptic.P384()
+		default:
+			curve = elliptic.P521()
+		}
+		x, y := elliptic.Unmarshal(curve, pub.Point)
+		if x == nil {
+			return nil, errors.New("invalid ecdsa public key")
+		}
+		if priv.D.Sign() <= 0 || priv.D.Cmp(curve.Params().N) >= 0 {
+			return nil, errors.New("invalid ecdsa private key")
+		}
+		if dx, dy := curve.ScalarBaseMult(priv.D.Bytes()); dx.Cmp(x) != 0 || dy.Cmp(y) != 0 {
+			return nil, errors.New("ecdsa private key does not match the public key")
+		}
+		return &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y},
+			D:         priv.D,
+		}, nil
+	default:
+		return nil, errors.New("unsupported ppk key type " + algorithm)
+	}
+}
@@ -0,0 +1,50 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestPPKRejectsArgon2Parameters(t *testing.T) {
+	invalid := []map[string]string{
+		{"Argon2-Memory": "8192", "Argon2-Passes": "8", "Argon2-Parallelism": "0"},
+		{"Argon2-Memory": "4294967295", "Argon2-Passes": "8", "Argon2-Parallelism": "1"},
+		{"Argon2-Memory": "8192", "Argon2-Passes": "4294967295", "Argon2-Parallelism": "1"},
+		{"Argon2-Memory": "8192", "Argon2-Passes": "0", "Argon2-Parallelism": "1"},
+	}
+	for _, headers := range invalid {
+		headers["Key-Derivation"] = "Argon2id"
+		headers["Argon2-Salt"] = "00112233445566778899aabbccddeeff"
+		file := &ppkFile{version: 3, headers: headers}
+		if _, _, err := file.cipherKey([]byte("passphrase")); err == nil {
+			t.Errorf("argon2 parameters %v were accepted", headers)
+		}
+	}
+}
+
+func TestPPKRejectsMismatchedECDSAKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicBlob := ssh.Marshal(struct {
+		Type  string
+		Curve string
+		Point []byte
+	}{ssh.KeyAlgoECDSA256, "nistp256", elliptic.Marshal(elliptic.P256(), key.X, key.Y)})
+	privateBlob := func(d *big.Int) []byte {
+		return ssh.Marshal(struct{ D *big.Int }{d})
+	}
+
+	if _, err := ppkPrivateKey(ssh.KeyAlgoECDSA256, publicBlob, privateBlob(key.D)); err != nil {
+		t.Fatalf("matching key rejected: %v", err)
+	}
+	if _, err := ppkPrivateKey(ssh.KeyAlgoECDSA256, publicBlob, privateBlob(new(big.Int).Add(key.D, big.NewInt(1)))); err == nil {
+		t.Fatal("private key of another public key was accepted")
+	}
+}
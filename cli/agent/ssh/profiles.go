@@ -0,0 +1,110 @@
+package ssh
+
+import (
+	"errors"
+	"net"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/vault"
+)
+
+var errProfileSocket = errors.New("not supported on ssh agent profile sockets")
+
+// profileAgents are the running sockets of the ssh agent profiles.
+var profileAgents = struct {
+	sync.Mutex
+	server    *SSHAgentServer
+	profiles  map[string]config.SSHAgentProfile
+	listeners map[string]net.Listener
+}{
+	profiles:  make(map[string]config.SSHAgentProfile),
+	listeners: make(map[string]net.Listener),
+}
+
+// selectsKey reports whether a vault key is served on the socket of the profile.
+func selectsKey(profile *config.SSHAgentProfile, vaultSSHKey vault.SSHKey) bool {
+	if profile == nil {
+		return true
+	}
+
+	if len(profile.Folders) > 0 && !matchesAny(profile.Folders, func(folder string) bool {
+		return folder == vaultSSHKey.Folder
+	}) {
+		return false
+	}
+	if len(profile.NamePatterns) > 0 && !matchesAny(profile.NamePatterns, func(pattern string) bool {
+		matched, _ := path.Match(pattern, vaultSSHKey.Name)
+		return matched
+	}) {
+		return false
+	}
+	if len(profile.Fields) > 0 && !matchesAny(profile.Fields, func(field string) bool {
+		name, pattern, _ := strings.Cut(field, "=")
+		value, ok := vaultSSHKey.Fields[name]
+		if !ok {
+			return false
+		}
+		matched, _ := path.Match(pattern, value)
+		return matched
+	}) {
+		return false
+	}
+	return true
+}
+
+func matchesAny(entries []string, matches func(string) bool) bool {
+	for _, entry := range entries {
+		if matches(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeProfiles starts the sockets of the ssh agent profiles. Later changes are applied with UpdateProfiles.
+func (v SSHAgentServer) ServeProfiles(profiles map[string]config.SSHAgentProfile) {
+	profileAgents.Lock()
+	profileAgents.server = &v
+	profileAgents.Unlock()
+	UpdateProfiles(profiles)
+}
+
+// UpdateProfiles starts, restarts and stops the profile sockets to match the given profiles.
+func UpdateProfiles(profiles map[string]config.SSHAgentProfile) {
+	profileAgents.Lock()
+	defer profileAgents.Unlock()
+	if profileAgents.server == nil {
+		return
+	}
+
+	for name, listener := range profileAgents.listeners {
+		if profile, ok := profiles[name]; ok && reflect.DeepEqual(profile, profileAgents.profiles[name]) {
+			continue
+		}
+		log.Info("Stopping ssh agent profile %s", name)
+		listener.Close()
+		delete(profileAgents.listeners, name)
+		delete(profileAgents.profiles, name)
+	}
+
+	for name, profile := range profiles {
+		if _, ok := profileAgents.listeners[name]; ok {
+			continue
+		}
+		listener, err := listen(profile.SocketPath)
+		if err != nil {
+			log.Error("Could not start ssh agent profile %s: %s", name, err.Error())
+			continue
+		}
+		log.Info("SSH Agent profile %s listening on %s", name, profile.SocketPath)
+		profileAgents.listeners[name] = listener
+		profileAgents.profiles[name] = profile
+
+		profile := profile
+		go profileAgents.server.serve(listener, name, &profile)
+	}
+}
@@ -0,0 +1,437 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/quexten/goldwarden/cli/agent/vault"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	extensionSessionBind          = "session-bind@openssh.com"
+	constraintRestrictDestination = "restrict-destination-v00@openssh.com"
+
+	// same limit as openssh
+	maxSessionBindings = 16
+
+	msgUserAuthRequest = 50
+)
+
+// sessionBinding is a hop the ssh client bound this agent connection to with session-bind@openssh.com.
+type sessionBinding struct {
+	hostKey    ssh.PublicKey
+	sessionID  []byte
+	forwarding bool
+}
+
+// connectionState holds the session bindings of one agent connection.
+type connectionState struct {
+	mu       sync.Mutex
+	bindings []sessionBinding
+}
+
+func newConnectionState() *connectionState {
+	return &connectionState{}
+}
+
+// bind verifies that the host signed the session identifier and records the binding.
+func (conn *connectionState) bind(contents []byte) error {
+	var msg struct {
+		HostKey    []byte
+		SessionID  []byte
+		Signature  []byte
+		Forwarding bool
+	}
+	if err := ssh.Unmarshal(contents, &msg); err != nil {
+		return err
+	}
+
+	hostKey, err := ssh.ParsePublicKey(msg.HostKey)
+	if err != nil {
+		return err
+	}
+	signature := new(ssh.Signature)
+	if err := ssh.Unmarshal(msg.Signature, signature); err != nil {
+		return err
+	}
+	if err := hostKey.Verify(msg.SessionID, signature); err != nil {
+		return errors.New("invalid session-bind signature")
+	}
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	for _, binding := range conn.bindings {
+		if bytes.Equal(binding.sessionID, msg.SessionID) {
+			if Eq(binding.hostKey, hostKey) && binding.forwarding == msg.Forwarding {
+				return nil
+			}
+			return errors.New("session id already bound")
+		}
+	}
+	if len(conn.bindings) > 0 && !conn.bindings[len(conn.bindings)-1].forwarding {
+		return errors.New("connection was already bound for authentication")
+	}
+	if len(conn.bindings) >= maxSessionBindings {
+		return errors.New("too many session bindings")
+	}
+
+	conn.bindings = append(conn.bindings, sessionBinding{
+		hostKey:    hostKey,
+		sessionID:  msg.SessionID,
+		forwarding: msg.Forwarding,
+	})
+	log.Info("Connection bound to host key %s (forwarding: %t)", ssh.FingerprintSHA256(hostKey), msg.Forwarding)
+	return nil
+}
+
+func (conn *connectionState) getBindings() []sessionBinding {
+	if conn == nil {
+		return nil
+	}
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	return slices.Clone(conn.bindings)
+}
+
+type userauthRequest struct {
+	sessionID []byte
+	user      string
+	// only set for publickey-hostbound-v00@openssh.com requests
+	hostKey ssh.PublicKey
+}
+
+// parseUserauthRequest parses sign data that is an ssh publickey authentication request.
+func parseUserauthRequest(data []byte) (*userauthRequest, bool) {
+	var msg struct {
+		SessionID []byte
+		Type      uint8
+		User      string
+		Service   string
+		Method    string
+		HasSig    bool
+		Algo      string
+		PubKey    []byte
+		Rest      []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(data, &msg); err != nil {
+		return nil, false
+	}
+	if msg.Type != msgUserAuthRequest || !msg.HasSig {
+		return nil, false
+	}
+
+	request := &userauthRequest{
+		sessionID: msg.SessionID,
+		user:      msg.User,
+	}
+	switch msg.Method {
+	case "publickey":
+		if len(msg.Rest) != 0 {
+			return nil, false
+		}
+	case "publickey-hostbound-v00@openssh.com":
+		var hostbound struct {
+			HostKey []byte
+		}
+		if err := ssh.Unmarshal(msg.Rest, &hostbound); err != nil {
+			return nil, false
+		}
+		hostKey, err := ssh.ParsePublicKey(hostbound.HostKey)
+		if err != nil {
+			return nil, false
+		}
+		request.hostKey = hostKey
+	default:
+		return nil, false
+	}
+	return request, true
+}
+
+// boundUserauthRequest returns the authentication request in data if it belongs to the session the
+// connection was last bound to.
+func (conn *connectionState) boundUserauthRequest(data []byte) (*userauthRequest, []sessionBinding, error) {
+	bindings := conn.getBindings()
+	if len(bindings) == 0 {
+		return nil, nil, errors.New("restricted key used on a connection without session binding")
+	}
+	request, ok := parseUserauthRequest(data)
+	if !ok {
+		return nil, nil, errors.New("restricted key used to sign something other than an ssh authentication request")
+	}
+
+	last := bindings[len(bindings)-1]
+	if !bytes.Equal(request.sessionID, last.sessionID) {
+		return nil, nil, errors.New("authentication request does not belong to the bound session")
+	}
+	if request.hostKey != nil && !Eq(request.hostKey, last.hostKey) {
+		return nil, nil, errors.New("authentication request is for a different host than the bound session")
+	}
+	return request, bindings, nil
+}
+
+func hasRestrictions(sshKey vault.SSHKey) bool {
+	return len(sshKey.AllowedHosts) > 0 || len(sshKey.AllowedUsers) > 0
+}
+
+// checkVaultKey refuses signatures of a vault key for hosts and users outside its allow-lists.
+func (conn *connectionState) checkVaultKey(sshKey vault.SSHKey, data []byte) error {
+	if !hasRestrictions(sshKey) {
+		return nil
+	}
+
+	request, bindings, err := conn.boundUserauthRequest(data)
+	if err != nil {
+		return err
+	}
+	if len(sshKey.AllowedUsers) > 0 && !slices.Contains(sshKey.AllowedUsers, request.user) {
+		return errors.New("user " + request.user + " is not allowed for this key")
+	}
+	hostKey := bindings[len(bindings)-1].hostKey
+	if len(sshKey.AllowedHosts) > 0 && !hostAllowed(sshKey.AllowedHosts, hostKey) {
+		return errors.New("host " + ssh.FingerprintSHA256(hostKey) + " is not allowed for this key")
+	}
+	return nil
+}
+
+// listVaultKey reports whether a vault key is offered on this connection. Keys are hidden on
+// connections that are already bound to a host outside their allow-list.
+func (conn *connectionState) listVaultKey(sshKey vault.SSHKey) bool {
+	if len(sshKey.AllowedHosts) == 0 {
+		return true
+	}
+	bindings := conn.getBindings()
+	if len(bindings) == 0 {
+		return true
+	}
+	return hostAllowed(sshKey.AllowedHosts, bindings[len(bindings)-1].hostKey)
+}
+
+// hostAllowed matches a host key against allowed hosts given as SHA256 fingerprints or as host
+// names looked up in the known_hosts files.
+func hostAllowed(allowedHosts []string, hostKey ssh.PublicKey) bool {
+	fingerprint := ssh.FingerprintSHA256(hostKey)
+	var names []string
+	for _, host := range allowedHosts {
+		if host == fingerprint {
+			return true
+		}
+		if !strings.HasPrefix(host, "SHA256:") {
+			names = append(names, host)
+		}
+	}
+	if len(names) == 0 {
+		return false
+	}
+
+	callback, err := knownHostsCallback()
+	if err != nil {
+		log.Warn("Could not read known_hosts: %s", err.Error())
+		return false
+	}
+	for _, name := range names {
+		address := name
+		if _, _, err := net.SplitHostPort(name); err != nil {
+			address = net.JoinHostPort(name, "22")
+		}
+		if callback(address, &net.TCPAddr{IP: net.IPv4zero}, hostKey) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func knownHostsFiles() []string {
+	files := []string{"/etc/ssh/ssh_known_hosts"}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".ssh", "known_hosts"))
+	}
+
+	var existing []string
+	for _, file := range files {
+		if _, err := os.Stat(file); err == nil {
+			existing = append(existing, file)
+		}
+	}
+	return existing
+}
+
+func knownHostsCallback() (ssh.HostKeyCallback, error) {
+	files := knownHostsFiles()
+	if len(files) == 0 {
+		return nil, errors.New("no known_hosts file found")
+	}
+	return knownhosts.New(files...)
+}
+
+// destinationHop is one side of an ssh-add -h constraint. An empty hostname stands for this machine.
+type destinationHop struct {
+	user     string
+	hostname string
+	keys     []ssh.PublicKey
+	isCA     []bool
+}
+
+type destinationConstraint struct {
+	from destinationHop
+	to   destinationHop
+}
+
+// parseDestinationConstraints parses the restrict-destination-v00@openssh.com key constraint.
+func parseDestinationConstraints(details []byte) ([]destinationConstraint, error) {
+	var constraints []destinationConstraint
+	for len(details) > 0 {
+		var msg struct {
+			Constraint []byte
+			Rest       []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(details, &msg); err != nil {
+			return nil, err
+		}
+		details = msg.Rest
+
+		var constraintMsg struct {
+			From     []byte
+			To       []byte
+			Reserved []byte
+		}
+		if err := ssh.Unmarshal(msg.Constraint, &constraintMsg); err != nil {
+			return nil, err
+		}
+		from, err := parseDestinationHop(constraintMsg.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := parseDestinationHop(constraintMsg.To)
+		if err != nil {
+			return nil, err
+		}
+		if to.hostname == "" || len(to.keys) == 0 {
+			return nil, errors.New("destination constraint without destination host")
+		}
+		constraints = append(constraints, destinationConstraint{from: from, to: to})
+	}
+	if len(constraints) == 0 {
+		return nil, errors.New("empty destination constraint")
+	}
+	return constraints, nil
+}
+
+func parseDestinationHop(data []byte) (destinationHop, error) {
+	var msg struct {
+		User     string
+		Hostname string
+		Reserved []byte
+		Rest     []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(data, &msg); err != nil {
+		return destinationHop{}, err
+	}
+
+	hop := destinationHop{user: msg.User, hostname: msg.Hostname}
+	rest := msg.Rest
+	for len(rest) > 0 {
+		var keyMsg struct {
+			Key  []byte
+			IsCA bool
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(rest, &keyMsg); err != nil {
+			return destinationHop{}, err
+		}
+		key, err := ssh.ParsePublicKey(keyMsg.Key)
+		if err != nil {
+			return destinationHop{}, err
+		}
+		hop.keys = append(hop.keys, key)
+		hop.isCA = append(hop.isCA, keyMsg.IsCA)
+		rest = keyMsg.Rest
+	}
+	return hop, nil
+}
+
+func (hop destinationHop) matchesKey(hostKey ssh.PublicKey) bool {
+	cert, isCert := hostKey.(*ssh.Certificate)
+	for i, key := range hop.keys {
+		if hop.isCA[i] {
+			if isCert && cert.CertType == ssh.HostCert && Eq(cert.SignatureKey, key) {
+				return true
+			}
+		} else if !isCert && Eq(key, hostKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// permitsPath reports whether every hop from this machine to the destination is allowed by one of
+// the constraints. user is only checked for the last hop.
+func permitsPath(constraints []destinationConstraint, bindings []sessionBinding, user string) bool {
+	for i, binding := range bindings {
+		var fromKey ssh.PublicKey
+		if i > 0 {
+			fromKey = bindings[i-1].hostKey
+		}
+		last := i == len(bindings)-1
+
+		permitted := false
+		for _, constraint := range constraints {
+			if fromKey == nil {
+				if constraint.from.hostname != "" || len(constraint.from.keys) != 0 {
+					continue
+				}
+			} else if !constraint.from.matchesKey(fromKey) {
+				continue
+			}
+			if !constraint.to.matchesKey(binding.hostKey) {
+				continue
+			}
+			if last && user != "" && constraint.to.user != "" && constraint.to.user != user {
+				continue
+			}
+			permitted = true
+			break
+		}
+		if !permitted {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSessionKey refuses signatures of a key added with ssh-add -h for destinations outside its constraints.
+func (conn *connectionState) checkSessionKey(sessionKey *sessionKey, data []byte) error {
+	if len(sessionKey.destinations) == 0 {
+		return nil
+	}
+
+	// without bindings the key is used locally, e.g. by ssh-keygen -Y sign
+	if len(conn.getBindings()) == 0 {
+		return nil
+	}
+	request, bindings, err := conn.boundUserauthRequest(data)
+	if err != nil {
+		return err
+	}
+	if !permitsPath(sessionKey.destinations, bindings, request.user) {
+		return errors.New("destination not permitted by key constraints")
+	}
+	return nil
+}
+
+func (conn *connectionState) listSessionKey(sessionKey *sessionKey) bool {
+	if len(sessionKey.destinations) == 0 {
+		return true
+	}
+	return permitsPath(sessionKey.destinations, conn.getBindings(), "")
+}
@@ -0,0 +1,379 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/quexten/goldwarden/cli/agent/notify"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	KeyTypeED25519SK = "ed25519-sk"
+	KeyTypeECDSASK   = "ecdsa-sk"
+
+	// the application openssh uses by default
+	skApplication = "ssh:"
+
+	skUserPresenceRequired     = 0x01
+	skUserVerificationRequired = 0x04
+
+	openSSHKeyMagic = "openssh-key-v1\x00"
+)
+
+// SecurityKey is a FIDO authenticator holding the private keys of sk-ssh keys. Algorithms are
+// ssh.KeyAlgoSKED25519 and ssh.KeyAlgoSKECDSA256.
+type SecurityKey interface {
+	// MakeCredential creates a credential and returns its public key, as raw ed25519 key or
+	// uncompressed P-256 point, and its key handle.
+	MakeCredential(algorithm string, application string, flags byte) (publicKey []byte, keyHandle []byte, err error)
+	// GetAssertion signs the message hash and returns the raw authenticator data and the signature,
+	// as raw ed25519 signature or ASN.1 ecdsa signature.
+	GetAssertion(algorithm string, application string, keyHandle []byte, messageHash []byte, flags byte) (authData []byte, signature []byte, err error)
+}
+
+var securityKey SecurityKey = fido2SecurityKey{}
+
+// skPrivateKey is an sk-ssh key: the private key stays on the authenticator, the key handle lets
+// the authenticator recover it.
+type skPrivateKey struct {
+	algorithm   string
+	publicKey   []byte
+	application string
+	flags       byte
+	keyHandle   []byte
+	comment     string
+}
+
+func (key *skPrivateKey) sshPublicKey() (ssh.PublicKey, error) {
+	var blob []byte
+	switch key.algorithm {
+	case ssh.KeyAlgoSKED25519:
+		blob = ssh.Marshal(struct {
+			Type        string
+			PublicKey   []byte
+			Application string
+		}{key.algorithm, key.publicKey, key.application})
+	case ssh.KeyAlgoSKECDSA256:
+		blob = ssh.Marshal(struct {
+			Type        string
+			Curve       string
+			PublicKey   []byte
+			Application string
+		}{key.algorithm, "nistp256", key.publicKey, key.application})
+	default:
+		return nil, errors.New("unsupported security key algorithm " + key.algorithm)
+	}
+	return ssh.ParsePublicKey(blob)
+}
+
+// privateFields are the key specific fields of the private section of an OpenSSH key.
+func (key *skPrivateKey) privateFields() []byte {
+	fields := struct {
+		Application string
+		Flags       byte
+		KeyHandle   []byte
+		Reserved    []byte
+	}{key.application, key.flags, key.keyHandle, nil}
+	if key.algorithm == ssh.KeyAlgoSKECDSA256 {
+		return ssh.Marshal(struct {
+			Curve     string
+			PublicKey []byte
+			Rest      []byte `ssh:"rest"`
+		}{"nistp256", key.publicKey, ssh.Marshal(fields)})
+	}
+	return ssh.Marshal(struct {
+		PublicKey []byte
+		Rest      []byte `ssh:"rest"`
+	}{key.publicKey, ssh.Marshal(fields)})
+}
+
+// marshal encodes the key as unencrypted OpenSSH private key, like ssh-keygen -t ed25519-sk.
+func (key *skPrivateKey) marshal() (string, error) {
+	pub, err := key.sshPublicKey()
+	if err != nil {
+		return "", err
+	}
+
+	check := make([]byte, 4)
+	if _, err := rand.Read(check); err != nil {
+		return "", err
+	}
+	privateSection := append(append(check, check...), ssh.Marshal(struct {
+		Algorithm string
+		Rest      []byte `ssh:"rest"`
+	}{key.algorithm, key.privateFields()})...)
+	privateSection = append(privateSection, ssh.Marshal(struct{ Comment string }{key.comment})...)
+	for i := byte(1); len(privateSection)%8 != 0; i++ {
+		privateSection = append(privateSection, i)
+	}
+
+	data := append([]byte(openSSHKeyMagic), ssh.Marshal(struct {
+		CipherName     string
+		KdfName        string
+		KdfOptions     string
+		NumKeys        uint32
+		PublicKey      []byte
+		PrivateSection []byte
+	}{"none", "none", "", 1, pub.Marshal(), privateSection})...)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: data})), nil
+}
+
+// isSKPrivateKey reports whether data is an OpenSSH private key of a security key.
+func isSKPrivateKey(data []byte) bool {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "OPENSSH PRIVATE KEY" || !bytes.HasPrefix(block.Bytes, []byte(openSSHKeyMagic)) {
+		return false
+	}
+	var msg struct {
+		CipherName string
+		KdfName    string
+		KdfOptions string
+		NumKeys    uint32
+		PublicKey  []byte
+		Rest       []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(block.Bytes[len(openSSHKeyMagic):], &msg); err != nil {
+		return false
+	}
+	var pub struct {
+		Type string
+		Rest []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(msg.PublicKey, &pub); err != nil {
+		return false
+	}
+	return pub.Type == ssh.KeyAlgoSKED25519 || pub.Type == ssh.KeyAlgoSKECDSA256
+}
+
+func parseSKPrivateKey(data []byte) (*skPrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || !bytes.HasPrefix(block.Bytes, []byte(openSSHKeyMagic)) {
+		return nil, errors.New("not an openssh private key")
+	}
+	var msg struct {
+		CipherName     string
+		KdfName        string
+		KdfOptions     string
+		NumKeys        uint32
+		PublicKey      []byte
+		PrivateSection []byte
+		Rest           []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(block.Bytes[len(openSSHKeyMagic):], &msg); err != nil {
+		return nil, err
+	}
+	if msg.CipherName != "none" || msg.KdfName != "none" {
+		return nil, errors.New("encrypted security key files are not supported, remove the passphrase with ssh-keygen -p first")
+	}
+	if msg.NumKeys != 1 {
+		return nil, errors.New("multi-key files are not supported")
+	}
+
+	var section struct {
+		Check1    uint32
+		Check2    uint32
+		Algorithm string
+		Rest      []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(msg.PrivateSection, &section); err != nil {
+		return nil, err
+	}
+	if section.Check1 != section.Check2 {
+		return nil, errors.New("invalid openssh private key")
+	}
+
+	key := &skPrivateKey{algorithm: section.Algorithm}
+	rest := section.Rest
+	switch section.Algorithm {
+	case ssh.KeyAlgoSKED25519:
+		var fields struct {
+			PublicKey []byte
+			Rest      []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(rest, &fields); err != nil {
+			return nil, err
+		}
+		key.publicKey, rest = fields.PublicKey, fields.Rest
+	case ssh.KeyAlgoSKECDSA256:
+		var fields struct {
+			Curve     string
+			PublicKey []byte
+			Rest      []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(rest, &fields); err != nil {
+			return nil, err
+		}
+		if fields.Curve != "nistp256" {
+			return nil, errors.New("unsupported security key curve " + fields.Curve)
+		}
+		key.publicKey, rest = fields.PublicKey, fields.Rest
+	default:
+		return nil, errors.New("not a security key: " + section.Algorithm)
+	}
+
+	var fields struct {
+		Application string
+		Flags       byte
+		KeyHandle   []byte
+		Reserved    []byte
+		Comment     string
+		Padding     []byte `ssh:"rest"`
+	}
+	if err := ssh.Unmarshal(rest, &fields); err != nil {
+		return nil, err
+	}
+	key.application = fields.Application
+	key.flags = fields.Flags
+	key.keyHandle = fields.KeyHandle
+	key.comment = fields.Comment
+
+	pub, err := key.sshPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pub.Marshal(), msg.PublicKey) {
+		return nil, errors.New("public key does not match the private key")
+	}
+	return key, nil
+}
+
+// generateSKPrivateKey enrolls a new credential on the security key.
+func generateSKPrivateKey(keyType string) (string, error) {
+	key := &skPrivateKey{
+		application: skApplication,
+		flags:       skUserPresenceRequired,
+	}
+	switch keyType {
+	case KeyTypeED25519SK:
+		key.algorithm = ssh.KeyAlgoSKED25519
+	case KeyTypeECDSASK:
+		key.algorithm = ssh.KeyAlgoSKECDSA256
+	default:
+		return "", errors.New("unsupported security key type " + keyType)
+	}
+
+	notify.Notify("Goldwarden", "Touch your security key to create the SSH key", "", 10*time.Second, func() {})
+	publicKey, keyHandle, err := securityKey.MakeCredential(key.algorithm, key.application, key.flags)
+	if err != nil {
+		return "", err
+	}
+	key.publicKey = publicKey
+	if _, err := key.sshPublicKey(); err != nil {
+		return "", err
+	}
+	key.keyHandle = keyHandle
+	return key.marshal()
+}
+
+// skSigner signs by asking the security key for an assertion over the hash of the data.
+type skSigner struct {
+	key       *skPrivateKey
+	publicKey ssh.PublicKey
+	name      string
+}
+
+func newSKSigner(data []byte, name string) (ssh.Signer, error) {
+	key, err := parseSKPrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := key.sshPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	return &skSigner{key: key, publicKey: publicKey, name: name}, nil
+}
+
+func (signer *skSigner) PublicKey() ssh.PublicKey {
+	return signer.publicKey
+}
+
+func (signer *skSigner) Sign(_ io.Reader, data []byte) (*ssh.Signature, error) {
+	messageHash := sha256.Sum256(data)
+
+	notify.Notify("Goldwarden", "Touch your security key to sign with "+signer.name, "", 10*time.Second, func() {})
+	authData, rawSignature, err := securityKey.GetAssertion(signer.key.algorithm, signer.key.application, signer.key.keyHandle, messageHash[:], signer.key.flags)
+	if err != nil {
+		return nil, err
+	}
+
+	// rp id hash, flags and the signature counter
+	applicationHash := sha256.Sum256([]byte(signer.key.application))
+	if len(authData) < 37 || !bytes.Equal(authData[:32], applicationHash[:]) {
+		return nil, errors.New("invalid authenticator data")
+	}
+	flags := authData[32]
+	counter := binary.BigEndian.Uint32(authData[33:37])
+
+	signature := &ssh.Signature{
+		Format: signer.key.algorithm,
+		Rest: ssh.Marshal(struct {
+			Flags   byte
+			Counter uint32
+		}{flags, counter}),
+	}
+	if signer.key.algorithm == ssh.KeyAlgoSKECDSA256 {
+		var ecSignature struct {
+			R, S *big.Int
+		}
+		if _, err := asn1.Unmarshal(rawSignature, &ecSignature); err != nil {
+			return nil, err
+		}
+		signature.Blob = ssh.Marshal(ecSignature)
+	} else {
+		signature.Blob = rawSignature
+	}
+
+	if err := signer.publicKey.Verify(data, signature); err != nil {
+		return nil, errors.New("security key returned an invalid signature")
+	}
+	if signer.key.flags&skUserPresenceRequired != 0 && flags&skUserPresenceRequired == 0 {
+		return nil, errors.New("security key did not confirm user presence")
+	}
+	return signature, nil
+}
+
+// parsePrivateKeySigner parses a vault private key, including keys of security keys.
+func parsePrivateKeySigner(privateKey string, name string) (ssh.Signer, error) {
+	if isSKPrivateKey([]byte(privateKey)) {
+		return newSKSigner([]byte(privateKey), name)
+	}
+	return ssh.ParsePrivateKey([]byte(privateKey))
+}
+
+// isSecurityKey reports whether the public key belongs to an sk-ssh key.
+func isSecurityKey(pub ssh.PublicKey) bool {
+	return strings.HasPrefix(pub.Type(), "sk-")
+}
+
+// decodeCBORByteString unwraps a CBOR encoded byte string, the encoding libfido2 returns authenticator data in.
+func decodeCBORByteString(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0]>>5 != 2 {
+		return nil, errors.New("not a cbor byte string")
+	}
+	length := int(data[0] & 0x1f)
+	offset := 1
+	switch {
+	case length < 24:
+	case length == 24 && len(data) >= 2:
+		length, offset = int(data[1]), 2
+	case length == 25 && len(data) >= 3:
+		length, offset = int(binary.BigEndian.Uint16(data[1:3])), 3
+	default:
+		return nil, errors.New("unsupported cbor byte string length")
+	}
+	if len(data) != offset+length {
+		return nil, errors.New("invalid cbor byte string length")
+	}
+	return data[offset:], nil
+}
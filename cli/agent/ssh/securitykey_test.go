@@ -0,0 +1,214 @@
+package ssh
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+
+	"github.com/quexten/goldwarden/cli/agent/vault"
+	"golang.org/x/crypto/ssh"
+)
+
+// softwareSecurityKey is a stand-in for a FIDO authenticator that keeps no state: its key handles
+// are the private keys, encrypted with the master key. User presence is confirmed unless
+// withoutPresence is set.
+type softwareSecurityKey struct {
+	aead            cipher.AEAD
+	counter         atomic.Uint32
+	withoutPresence bool
+}
+
+func newSoftwareSecurityKey(t *testing.T) *softwareSecurityKey {
+	masterKey := make([]byte, 32)
+	if _, err := rand.Read(masterKey); err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &softwareSecurityKey{aead: aead}
+}
+
+func (key *softwareSecurityKey) MakeCredential(algorithm string, application string, flags byte) ([]byte, []byte, error) {
+	var privateKey, publicKey []byte
+	switch algorithm {
+	case ssh.KeyAlgoSKED25519:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		privateKey, publicKey = priv.Seed(), pub
+	case ssh.KeyAlgoSKECDSA256:
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		privateKey = priv.D.FillBytes(make([]byte, 32))
+		publicKey = elliptic.Marshal(elliptic.P256(), priv.X, priv.Y)
+	default:
+		return nil, nil, errors.New("unsupported security key algorithm " + algorithm)
+	}
+
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	keyHandle := key.aead.Seal(nonce, nonce, privateKey, []byte(algorithm+application))
+	return publicKey, keyHandle, nil
+}
+
+func (key *softwareSecurityKey) GetAssertion(algorithm string, application string, keyHandle []byte, messageHash []byte, flags byte) ([]byte, []byte, error) {
+	nonceSize := key.aead.NonceSize()
+	if len(keyHandle) < nonceSize {
+		return nil, nil, errors.New("invalid key handle")
+	}
+	privateKey, err := key.aead.Open(nil, keyHandle[:nonceSize], keyHandle[nonceSize:], []byte(algorithm+application))
+	if err != nil {
+		return nil, nil, errors.New("key handle does not belong to this security key")
+	}
+
+	if key.withoutPresence {
+		flags &^= skUserPresenceRequired
+	} else {
+		flags |= skUserPresenceRequired
+	}
+	applicationHash := sha256.Sum256([]byte(application))
+	authData := append(applicationHash[:], flags)
+	authData = binary.BigEndian.AppendUint32(authData, key.counter.Add(1))
+	signedData := append(append([]byte{}, authData...), messageHash...)
+
+	switch algorithm {
+	case ssh.KeyAlgoSKED25519:
+		return authData, ed25519.Sign(ed25519.NewKeyFromSeed(privateKey), signedData), nil
+	case ssh.KeyAlgoSKECDSA256:
+		priv := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(privateKey)}
+		priv.Curve = elliptic.P256()
+		priv.X, priv.Y = elliptic.P256().ScalarBaseMult(privateKey)
+		digest := sha256.Sum256(signedData)
+		signature, err := ecdsa.SignASN1(rand.Reader, priv, digest[:])
+		return authData, signature, err
+	default:
+		return nil, nil, errors.New("unsupported security key algorithm " + algorithm)
+	}
+}
+
+func useSoftwareSecurityKey(t *testing.T) *softwareSecurityKey {
+	key := newSoftwareSecurityKey(t)
+	previous := securityKey
+	securityKey = key
+	t.Cleanup(func() {
+		securityKey = previous
+	})
+	return key
+}
+
+var securityKeyTypes = []struct {
+	keyType   string
+	algorithm string
+}{
+	{KeyTypeED25519SK, ssh.KeyAlgoSKED25519},
+	{KeyTypeECDSASK, ssh.KeyAlgoSKECDSA256},
+}
+
+func TestSecurityKeyListAndSign(t *testing.T) {
+	for _, test := range securityKeyTypes {
+		t.Run(test.keyType, func(t *testing.T) {
+			useSoftwareSecurityKey(t)
+
+			privateKey, err := generateSKPrivateKey(test.keyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isSKPrivateKey([]byte(privateKey)) {
+				t.Fatal("generated key is not recognized as security key")
+			}
+
+			signer, identities, err := vaultKeyIdentities(vault.SSHKey{Name: "sk", Key: privateKey})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(identities) != 1 || !Eq(identities[0], signer.PublicKey()) {
+				t.Fatalf("unexpected identities %v", identities)
+			}
+			listed := identities[0]
+			if listed.Type() != test.algorithm || !isSecurityKey(listed) {
+				t.Fatalf("listed key has type %s, want %s", listed.Type(), test.algorithm)
+			}
+			parsed, _, _, _, err := ssh.ParseAuthorizedKey(ssh.MarshalAuthorizedKey(listed))
+			if err != nil || !Eq(parsed, listed) {
+				t.Fatalf("listed key does not round trip as authorized key: %v", err)
+			}
+
+			data := []byte("session identifier")
+			signature, err := signer.Sign(rand.Reader, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if signature.Format != test.algorithm {
+				t.Fatalf("signature format %s, want %s", signature.Format, test.algorithm)
+			}
+			if err := listed.Verify(data, signature); err != nil {
+				t.Fatalf("signature does not verify: %v", err)
+			}
+			if err := listed.Verify([]byte("other data"), signature); err == nil {
+				t.Fatal("signature verifies for other data")
+			}
+		})
+	}
+}
+
+func TestSecurityKeyOfAnotherAuthenticator(t *testing.T) {
+	for _, test := range securityKeyTypes {
+		t.Run(test.keyType, func(t *testing.T) {
+			useSoftwareSecurityKey(t)
+			privateKey, err := generateSKPrivateKey(test.keyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signer, err := parsePrivateKeySigner(privateKey, "sk")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			useSoftwareSecurityKey(t)
+			if _, err := signer.Sign(rand.Reader, []byte("data")); err == nil {
+				t.Fatal("signed with the key handle of another authenticator")
+			}
+		})
+	}
+}
+
+func TestSecurityKeyRequiresUserPresence(t *testing.T) {
+	for _, test := range securityKeyTypes {
+		t.Run(test.keyType, func(t *testing.T) {
+			key := useSoftwareSecurityKey(t)
+			privateKey, err := generateSKPrivateKey(test.keyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signer, err := parsePrivateKeySigner(privateKey, "sk")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			key.withoutPresence = true
+			if _, err := signer.Sign(rand.Reader, []byte("data")); err == nil {
+				t.Fatal("signed without user presence")
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+//go:build !nofido2
+
+package ssh
+
+import (
+	"crypto/rand"
+	"errors"
+
+	"github.com/keys-pub/go-libfido2"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/pinentry"
+	"golang.org/x/crypto/ssh"
+)
+
+// fido2SecurityKey uses the first connected FIDO2 device that knows the key handle.
+type fido2SecurityKey struct{}
+
+func fido2Devices() ([]*libfido2.Device, error) {
+	locs, err := libfido2.DeviceLocations()
+	if err != nil {
+		return nil, err
+	}
+	if len(locs) == 0 {
+		return nil, errors.New("no security key found")
+	}
+
+	devices := make([]*libfido2.Device, 0, len(locs))
+	for _, loc := range locs {
+		device, err := libfido2.NewDevice(loc.Path)
+		if err != nil {
+			log.Warn("Could not open security key %s: %s", loc.Path, err.Error())
+			continue
+		}
+		devices = append(devices, device)
+	}
+	if len(devices) == 0 {
+		return nil, errors.New("no usable security key found")
+	}
+	return devices, nil
+}
+
+func hasClientPin(device *libfido2.Device) bool {
+	info, err := device.Info()
+	if err != nil {
+		return false
+	}
+	for _, option := range info.Options {
+		if option.Name == "clientPin" && option.Value == libfido2.True {
+			return true
+		}
+	}
+	return false
+}
+
+func getSecurityKeyPin(description string) (string, error) {
+	return pinentry.GetPassword("Security Key PIN", description)
+}
+
+func credentialType(algorithm string) (libfido2.CredentialType, error) {
+	switch algorithm {
+	case ssh.KeyAlgoSKED25519:
+		return libfido2.EDDSA, nil
+	case ssh.KeyAlgoSKECDSA256:
+		return libfido2.ES256, nil
+	default:
+		return 0, errors.New("unsupported security key algorithm " + algorithm)
+	}
+}
+
+func (fido2SecurityKey) MakeCredential(algorithm string, application string, flags byte) ([]byte, []byte, error) {
+	typ, err := credentialType(algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	devices, err := fido2Devices()
+	if err != nil {
+		return nil, nil, err
+	}
+	device := devices[0]
+
+	pin := ""
+	if hasClientPin(device) {
+		if pin, err = getSecurityKeyPin("Enter the PIN of your security key to create an SSH key"); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, nil, err
+	}
+	uv := libfido2.Default
+	if flags&skUserVerificationRequired != 0 {
+		uv = libfido2.True
+	}
+	attestation, err := device.MakeCredential(
+		challenge,
+		libfido2.RelyingParty{ID: application},
+		// like openssh, which does not identify users on the security key
+		libfido2.User{ID: make([]byte, 32), Name: "openssh"},
+		typ,
+		pin,
+		&libfido2.MakeCredentialOpts{UV: uv},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publicKey := attestation.PubKey
+	if typ == libfido2.ES256 {
+		// libfido2 returns the coordinates without the uncompressed point prefix
+		publicKey = append([]byte{4}, publicKey...)
+	}
+	return publicKey, attestation.CredentialID, nil
+}
+
+func (fido2SecurityKey) GetAssertion(algorithm string, application string, keyHandle []byte, messageHash []byte, flags byte) ([]byte, []byte, error) {
+	devices, err := fido2Devices()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := &libfido2.AssertionOpts{UP: libfido2.True}
+	if flags&skUserPresenceRequired == 0 {
+		opts.UP = libfido2.False
+	}
+	pin := ""
+	if flags&skUserVerificationRequired != 0 {
+		opts.UV = libfido2.True
+		if pin, err = getSecurityKeyPin("Enter the PIN of your security key to sign"); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var lastErr error
+	for _, device := range devices {
+		assertion, err := device.Assertion(application, messageHash, [][]byte{keyHandle}, pin, opts)
+		if errors.Is(err, libfido2.ErrPinRequired) && pin == "" {
+			if pin, err = getSecurityKeyPin("Enter the PIN of your security key to sign"); err != nil {
+				return nil, nil, err
+			}
+			assertion, err = device.Assertion(application, messageHash, [][]byte{keyHandle}, pin, opts)
+		}
+		if err != nil {
+			// other devices may hold the key
+			lastErr = err
+			continue
+		}
+
+		authData, err := decodeCBORByteString(assertion.AuthDataCBOR)
+		if err != nil {
+			return nil, nil, err
+		}
+		return authData, assertion.Sig, nil
+	}
+	return nil, nil, lastErr
+}
@@ -0,0 +1,15 @@
+//go:build nofido2
+
+package ssh
+
+import "errors"
+
+type fido2SecurityKey struct{}
+
+func (fido2SecurityKey) MakeCredential(algorithm string, application string, flags byte) ([]byte, []byte, error) {
+	return nil, nil, errors.New("Fido2 is not enabled")
+}
+
+func (fido2SecurityKey) GetAssertion(algorithm string, application string, keyHandle []byte, messageHash []byte, flags byte) ([]byte, []byte, error) {
+	return nil, nil, errors.New("Fido2 is not enabled")
+}
@@ -5,13 +5,19 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"net"
+	"strconv"
 	"time"
 
+	"github.com/quexten/goldwarden/cli/agent/accounts"
+	"github.com/quexten/goldwarden/cli/agent/audit"
 	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/events"
 	"github.com/quexten/goldwarden/cli/agent/notify"
 	"github.com/quexten/goldwarden/cli/agent/sockets"
 	"github.com/quexten/goldwarden/cli/agent/systemauth"
 	"github.com/quexten/goldwarden/cli/agent/systemauth/pinentry"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/policy"
 	"github.com/quexten/goldwarden/cli/agent/vault"
 	"github.com/quexten/goldwarden/cli/logging"
 	"golang.org/x/crypto/ssh"
@@ -21,59 +27,195 @@ import (
 var log = logging.GetLogger("Goldwarden", "SSH")
 
 type vaultAgent struct {
-	vault               *vault.Vault
-	config              *config.Config
-	unlockRequestAction func() bool
+	unlockRequestAction func(account *accounts.Account) bool
+	lockAction          func()
 	context             sockets.CallingContext
+	connection          *connectionState
+	// set on the sockets of ssh agent profiles
+	profileName string
+	profile     *config.SSHAgentProfile
 }
 
-func (vaultAgent) Add(key agent.AddedKey) error {
-	log.Warn("Add Request - Not implemented")
-	return nil
+func (vaultAgent vaultAgent) Add(key agent.AddedKey) error {
+	log.Info("Add Request for key: %s", key.Comment)
+	if vaultAgent.profile != nil {
+		return errProfileSocket
+	}
+	return keystore.add(key)
+}
+
+// unlockedAccounts returns the accounts whose keys are served. A locked default account is
+// unlocked on demand, other accounts have to be unlocked on their own.
+func (vaultAgent vaultAgent) unlockedAccounts() ([]*accounts.Account, error) {
+	defaultAccount, ok := accounts.Get(accounts.DefaultAccount)
+	defaultUnlockFailed := false
+	if ok && defaultAccount.Vault.Keyring.IsLocked() && (defaultAccount.Config.IsLoggedIn() || accounts.Count() == 1) {
+		if vaultAgent.unlockRequestAction(defaultAccount) {
+			systemauth.CreatePinSession(vaultAgent.context, systemauth.SSHTTL)
+		} else {
+			defaultUnlockFailed = true
+		}
+	}
+
+	unlocked := make([]*accounts.Account, 0)
+	for _, account := range accounts.All() {
+		if !account.Vault.Keyring.IsLocked() {
+			unlocked = append(unlocked, account)
+		}
+	}
+	if len(unlocked) == 0 && defaultUnlockFailed {
+		return nil, errors.New("vault is locked")
+	}
+	return unlocked, nil
+}
+
+func keyComment(account *accounts.Account, name string) string {
+	if accounts.Count() > 1 {
+		return name + " (" + account.Name + ")"
+	}
+	return name
 }
 
 func (vaultAgent vaultAgent) List() ([]*agent.Key, error) {
 	log.Info("List Request")
-	if vaultAgent.vault.Keyring.IsLocked() {
-		if !vaultAgent.unlockRequestAction() {
-			log.Warn("List request failed - Vault is locked")
-			return nil, errors.New("vault is locked")
-		}
+	if keystore.isLocked() {
+		return []*agent.Key{}, nil
+	}
 
-		systemauth.CreatePinSession(vaultAgent.context, systemauth.SSHTTL)
+	unlockedAccounts, err := vaultAgent.unlockedAccounts()
+	if err != nil {
+		log.Warn("List request failed - Vault is locked")
+		return nil, err
 	}
 
-	vaultSSHKeys := (*vaultAgent.vault).GetSSHKeys()
+	_, isRemote := vaultAgent.remoteOrigin()
 	var sshKeys []*agent.Key
-	for _, vaultSSHKey := range vaultSSHKeys {
-		signer, err := ssh.ParsePrivateKey([]byte(vaultSSHKey.Key))
-		if err != nil {
-			log.Warn("List request key skipped - Could not parse key: %s", err)
+	for _, account := range unlockedAccounts {
+		for _, vaultSSHKey := range account.Vault.GetSSHKeys() {
+			if !selectsKey(vaultAgent.profile, vaultSSHKey) {
+				continue
+			}
+			signer, identities, err := vaultKeyIdentities(vaultSSHKey)
+			if err != nil {
+				log.Warn("List request key skipped - Could not parse key: %s", err)
+				continue
+			}
+			if keystore.isVaultKeyHidden(signer.PublicKey()) || !vaultAgent.connection.listVaultKey(vaultSSHKey) {
+				continue
+			}
+			if isRemote && ForwardingDenied(vaultSSHKey) {
+				continue
+			}
+			for _, pub := range identities {
+				if keystore.isVaultKeyHidden(pub) {
+					continue
+				}
+				sshKeys = append(sshKeys, &agent.Key{
+					Format:  pub.Type(),
+					Blob:    pub.Marshal(),
+					Comment: keyComment(account, vaultSSHKey.Name)})
+			}
+		}
+	}
+
+	for _, sessionKey := range keystore.list() {
+		// keys added with ssh-add are only served on the main socket
+		if vaultAgent.profile != nil || !vaultAgent.connection.listSessionKey(sessionKey) {
 			continue
 		}
-		pub := signer.PublicKey()
+		pub := sessionKey.signer.PublicKey()
 		sshKeys = append(sshKeys, &agent.Key{
 			Format:  pub.Type(),
 			Blob:    pub.Marshal(),
-			Comment: vaultSSHKey.Name})
+			Comment: sessionKey.comment})
 	}
 
 	return sshKeys, nil
 }
 
-func (vaultAgent) Lock(passphrase []byte) error {
-	log.Warn("Lock Request - Not implemented")
+// Lock locks the agent until Unlock is called with the same passphrase and locks the vaults of all accounts.
+func (vaultAgent vaultAgent) Lock(passphrase []byte) error {
+	log.Info("Lock Request")
+	if vaultAgent.profile != nil {
+		return errProfileSocket
+	}
+	if err := keystore.lock(passphrase); err != nil {
+		return err
+	}
+
+	if vaultAgent.lockAction != nil {
+		vaultAgent.lockAction()
+	}
 	return nil
 }
 
-func (vaultAgent) Remove(key ssh.PublicKey) error {
-	log.Warn("Remove Request - Not implemented")
-	return nil
+// Remove deletes a key added with ssh-add, or hides a vault key until the daemon restarts.
+func (vaultAgent vaultAgent) Remove(key ssh.PublicKey) error {
+	log.Info("Remove Request for key: %s", ssh.FingerprintSHA256(key))
+	if vaultAgent.profile != nil {
+		return errProfileSocket
+	}
+	return keystore.remove(key, isUnlockedVaultKey(key))
 }
 
-func (vaultAgent) RemoveAll() error {
-	log.Warn("RemoveAll Request - Not implemented")
-	return nil
+// RemoveAll deletes all keys added with ssh-add and hides all vault keys until the daemon restarts.
+func (vaultAgent vaultAgent) RemoveAll() error {
+	log.Info("RemoveAll Request")
+	if vaultAgent.profile != nil {
+		return errProfileSocket
+	}
+	return keystore.removeAll()
+}
+
+func isUnlockedVaultKey(key ssh.PublicKey) bool {
+	for _, account := range accounts.All() {
+		if account.Vault.Keyring.IsLocked() {
+			continue
+		}
+		for _, vaultSSHKey := range account.Vault.GetSSHKeys() {
+			_, identities, err := vaultKeyIdentities(vaultSSHKey)
+			if err != nil {
+				continue
+			}
+			for _, pub := range identities {
+				if Eq(pub, key) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// vaultKeyIdentities returns the signer of a vault key and the public keys it is offered as: the
+// plain key and its certificate, if one is attached and currently valid.
+func vaultKeyIdentities(vaultSSHKey vault.SSHKey) (ssh.Signer, []ssh.PublicKey, error) {
+	signer, err := parsePrivateKeySigner(vaultSSHKey.Key, vaultSSHKey.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	identities := []ssh.PublicKey{signer.PublicKey()}
+	if vaultSSHKey.Certificate == "" {
+		return signer, identities, nil
+	}
+
+	cert, err := ParseCertificate(vaultSSHKey.Certificate)
+	if err != nil {
+		log.Warn("Certificate of key %s skipped - Could not parse certificate: %s", vaultSSHKey.Name, err)
+		return signer, identities, nil
+	}
+	if !Eq(cert.Key, signer.PublicKey()) {
+		log.Warn("Certificate of key %s skipped - Certificate is for a different key", vaultSSHKey.Name)
+		return signer, identities, nil
+	}
+	now := uint64(time.Now().Unix())
+	if now < cert.ValidAfter || (cert.ValidBefore != ssh.CertTimeInfinity && now >= cert.ValidBefore) {
+		log.Warn("Certificate of key %s skipped - Certificate is not valid at this time", vaultSSHKey.Name)
+		return signer, identities, nil
+	}
+
+	return signer, append(identities, cert), nil
 }
 
 func Eq(a, b ssh.PublicKey) bool {
@@ -84,80 +226,150 @@ func (vaultAgent vaultAgent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signatur
 	return vaultAgent.SignWithFlags(key, data, agent.SignatureFlagReserved)
 }
 
+func (vaultAgent vaultAgent) logSignDecision(auditAction string, accountName string, keyID string, keyName string, approved bool, method string) {
+	ctx := vaultAgent.context
+	detail := keyName
+	remoteHost := ""
+	if origin, remote := vaultAgent.remoteOrigin(); remote {
+		detail += " from " + origin.String()
+		remoteHost = origin.host
+	}
+
+	audit.Log(auditAction, ctx, keyID, detail, approved, method)
+	events.Publish(events.TypeSSHSign, map[string]string{
+		"key":        keyName,
+		"keyId":      keyID,
+		"git":        strconv.FormatBool(auditAction == audit.ActionGitSign),
+		"approved":   strconv.FormatBool(approved),
+		"method":     method,
+		"process":    ctx.ProcessName,
+		"account":    accountName,
+		"remoteHost": remoteHost,
+	})
+}
+
 func (vaultAgent vaultAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
 	log.Info("Sign Request for key: %s", ssh.FingerprintSHA256(key))
-	if vaultAgent.vault.Keyring.IsLocked() {
-		if !vaultAgent.unlockRequestAction() {
-			return nil, errors.New("vault is locked")
-		}
+	if keystore.isLocked() {
+		return nil, errAgentLocked
+	}
+	if sessionKey := keystore.find(key); sessionKey != nil && vaultAgent.profile == nil {
+		return vaultAgent.signWithSessionKey(sessionKey, data, flags)
+	}
+	if keystore.isVaultKeyHidden(key) {
+		return nil, errors.New("key not found")
+	}
 
-		systemauth.CreatePinSession(vaultAgent.context, systemauth.SSHTTL)
+	unlockedAccounts, err := vaultAgent.unlockedAccounts()
+	if err != nil {
+		return nil, err
 	}
 
 	var signer ssh.Signer
 	var sshKey *vault.SSHKey
+	var account *accounts.Account
 
-	vaultSSHKeys := (*vaultAgent.vault).GetSSHKeys()
-	for _, vaultSSHKey := range vaultSSHKeys {
-		sg, err := ssh.ParsePrivateKey([]byte(vaultSSHKey.Key))
-		if err != nil {
-			return nil, err
+	for _, candidate := range unlockedAccounts {
+		for _, vaultSSHKey := range candidate.Vault.GetSSHKeys() {
+			if !selectsKey(vaultAgent.profile, vaultSSHKey) {
+				continue
+			}
+			sg, identities, err := vaultKeyIdentities(vaultSSHKey)
+			if err != nil {
+				log.Warn("Sign request key skipped - Could not parse key: %s", err)
+				continue
+			}
+			// a certificate signs with the key it was issued for
+			for _, pub := range identities {
+				if Eq(pub, key) {
+					signer = sg
+					sshKey = &vaultSSHKey
+					account = candidate
+					break
+				}
+			}
+			if sshKey != nil {
+				break
+			}
 		}
-		if Eq(sg.PublicKey(), key) {
-			signer = sg
-			sshKey = &vaultSSHKey
+		if sshKey != nil {
 			break
 		}
 	}
 
-	if sshKey == nil {
+	if sshKey == nil || keystore.isVaultKeyHidden(signer.PublicKey()) {
 		return nil, errors.New("key not found")
 	}
 
-	isGit := false
-	magicHeader := []byte("SSHSIG\x00\x00\x00\x03git")
-	if bytes.HasPrefix(data, magicHeader) {
-		isGit = true
+	isGit := isGitSignRequest(data)
+	message := vaultAgent.signRequestMessage(isGit, sshKey.Name)
+	if isSecurityKey(signer.PublicKey()) {
+		message += ". Touch your security key after approving"
 	}
 
-	requestTemplate := ""
-	message := ""
-	if !vaultAgent.context.Error {
-		if isGit {
-			requestTemplate = "%s on %s>%s>%s is requesting git signage with key %s"
-		} else {
-			requestTemplate = "%s on %s>%s>%s is requesting ssh signage with key %s"
-		}
-		message = fmt.Sprintf(requestTemplate, vaultAgent.context.UserName, vaultAgent.context.GrandParentProcessName, vaultAgent.context.ParentProcessName, vaultAgent.context.ProcessName, sshKey.Name)
-	} else {
-		if isGit {
-			requestTemplate = "%s is requesting git signage with key %s"
-		} else {
-			requestTemplate = "%s is requesting ssh signage with key %s"
-		}
-		message = fmt.Sprintf(requestTemplate, vaultAgent.context.UserName, sshKey.Name)
+	auditAction := audit.ActionSSHSign
+	if isGit {
+		auditAction = audit.ActionGitSign
 	}
 
+	if err := vaultAgent.connection.checkVaultKey(*sshKey, data); err != nil {
+		log.Info("Sign Request for key: %s refused: %s", sshKey.Name, err.Error())
+		vaultAgent.logSignDecision(auditAction, account.Name, sshKey.ID, sshKey.Name, false, "key restrictions")
+		return nil, err
+	}
+
+	origin, isRemote := vaultAgent.remoteOrigin()
+	if isRemote && ForwardingDenied(*sshKey) {
+		log.Info("Sign Request for key: %s refused: forwarded use is not allowed", sshKey.Name)
+		vaultAgent.logSignDecision(auditAction, account.Name, sshKey.ID, sshKey.Name, false, "key restrictions")
+		return nil, errors.New("key may not be used through a forwarded agent")
+	}
+
+	policyAction := policy.ActionSSHSign
+	if isGit {
+		policyAction = policy.ActionGitSign
+	}
+	policyRequest := vaultAgent.policyRequest(policyAction)
+	policyRequest.Cipher = sshKey.Name
+	policyRequest.Key = sshKey.Name
+	policyRequest.Folder = sshKey.Folder
+
 	// todo refactor
-	if !systemauth.GetSSHSession(vaultAgent.context) {
+	if approved, method, decided := systemauth.CheckPolicy(policyRequest, vaultAgent.context, account.Config, "SSH Key Signing Request", message); decided {
+		vaultAgent.logSignDecision(auditAction, account.Name, sshKey.ID, sshKey.Name, approved, method)
+		if !approved {
+			log.Info("Sign Request for key: %s denied by policy", sshKey.Name)
+			return nil, errors.New("Approval not given")
+		}
+	} else if isRemote || !systemauth.GetSSHSession(vaultAgent.context) {
+		// forwarded requests are confirmed one by one and never start an ssh session
 		if approved, err := pinentry.GetApproval("SSH Key Signing Request", message); err != nil || !approved {
 			log.Info("Sign Request for key: %s denied", sshKey.Name)
+			vaultAgent.logSignDecision(auditAction, account.Name, sshKey.ID, sshKey.Name, false, "prompt")
 			return nil, errors.New("Approval not given")
 		}
 
+		method := "prompt, pin session"
 		if !systemauth.VerifyPinSession(vaultAgent.context) {
-			if permission, err := systemauth.GetPermission(systemauth.SSHKey, vaultAgent.context, vaultAgent.config); err != nil || !permission {
+			method = "prompt, biometrics"
+			if permission, err := systemauth.GetPermission(systemauth.SSHKey, vaultAgent.context, account.Config); err != nil || !permission {
 				log.Info("Sign Request for key: %s denied", key.Marshal())
+				vaultAgent.logSignDecision(auditAction, account.Name, sshKey.ID, sshKey.Name, false, method)
 				return nil, errors.New("Biometrics not checked")
 			}
 		}
 
-		systemauth.CreateSSHSession(vaultAgent.context)
+		if isRemote {
+			log.Info("Sign Request for key: %s approved for %s", sshKey.Name, origin.String())
+		} else {
+			systemauth.CreateSSHSession(vaultAgent.context)
+		}
+		vaultAgent.logSignDecision(auditAction, account.Name, sshKey.ID, sshKey.Name, true, method)
 	} else {
 		log.Info("Using cached session approval")
+		vaultAgent.logSignDecision(auditAction, account.Name, sshKey.ID, sshKey.Name, true, "ssh session")
 	}
 
-	var rand = rand.Reader
 	log.Info("Sign Request for key: %s %s accepted", ssh.FingerprintSHA256(key), sshKey.Name)
 	if isGit {
 		notify.Notify("Goldwarden", fmt.Sprintf("Git Signing Request Approved for %s", sshKey.Name), "", 10*time.Second, func() {})
@@ -165,6 +377,57 @@ func (vaultAgent vaultAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags
 		notify.Notify("Goldwarden", fmt.Sprintf("SSH Signing Request Approved for %s", sshKey.Name), "", 10*time.Second, func() {})
 	}
 
+	return signWithFlags(signer, data, flags)
+}
+
+func isGitSignRequest(data []byte) bool {
+	magicHeader := []byte("SSHSIG\x00\x00\x00\x03git")
+	return bytes.HasPrefix(data, magicHeader)
+}
+
+func (vaultAgent vaultAgent) signRequestMessage(isGit bool, keyName string) string {
+	message := vaultAgent.callerSignRequestMessage(isGit, keyName)
+	if origin, remote := vaultAgent.remoteOrigin(); remote {
+		message += " for " + origin.String()
+	}
+	if vaultAgent.profile != nil {
+		message += " on ssh agent profile " + vaultAgent.profileName
+	}
+	return message
+}
+
+// policyRequest creates a policy request that only matches rules for forwarded use if the request
+// is forwarded.
+func (vaultAgent vaultAgent) policyRequest(action policy.Action) policy.Request {
+	request := policy.NewRequest(action, vaultAgent.context)
+	if origin, remote := vaultAgent.remoteOrigin(); remote {
+		request.Forwarded = true
+		request.RemoteHost = origin.host
+	}
+	return request
+}
+
+func (vaultAgent vaultAgent) callerSignRequestMessage(isGit bool, keyName string) string {
+	requestTemplate := ""
+	if !vaultAgent.context.Error {
+		if isGit {
+			requestTemplate = "%s on %s>%s>%s is requesting git signage with key %s"
+		} else {
+			requestTemplate = "%s on %s>%s>%s is requesting ssh signage with key %s"
+		}
+		return fmt.Sprintf(requestTemplate, vaultAgent.context.UserName, vaultAgent.context.GrandParentProcessName, vaultAgent.context.ParentProcessName, vaultAgent.context.ProcessName, keyName)
+	}
+
+	if isGit {
+		requestTemplate = "%s is requesting git signage with key %s"
+	} else {
+		requestTemplate = "%s is requesting ssh signage with key %s"
+	}
+	return fmt.Sprintf(requestTemplate, vaultAgent.context.UserName, keyName)
+}
+
+func signWithFlags(signer ssh.Signer, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	var rand = rand.Reader
 	algo := ""
 
 	switch flags {
@@ -186,8 +449,62 @@ func (vaultAgent vaultAgent) SignWithFlags(key ssh.PublicKey, data []byte, flags
 	return algoSigner.SignWithAlgorithm(rand, data, algo)
 }
 
-func (vaultAgent) Extension(extensionType string, contents []byte) ([]byte, error) {
-	return nil, agent.ErrExtensionUnsupported
+// signWithSessionKey signs with a key added by ssh-add. These keys were handed to the agent by the
+// user, so they are only confirmed if added with ssh-add -c, but the policy can still deny them.
+func (vaultAgent vaultAgent) signWithSessionKey(sessionKey *sessionKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+	isGit := isGitSignRequest(data)
+	message := vaultAgent.signRequestMessage(isGit, sessionKey.comment)
+
+	policyAction := policy.ActionSSHSign
+	auditAction := audit.ActionSSHSign
+	if isGit {
+		policyAction = policy.ActionGitSign
+		auditAction = audit.ActionGitSign
+	}
+	if err := vaultAgent.connection.checkSessionKey(sessionKey, data); err != nil {
+		log.Info("Sign Request for key: %s refused: %s", sessionKey.comment, err.Error())
+		vaultAgent.logSignDecision(auditAction, "", "", sessionKey.comment, false, "key constraints")
+		return nil, err
+	}
+
+	policyRequest := vaultAgent.policyRequest(policyAction)
+	policyRequest.Key = sessionKey.comment
+
+	method := "session key"
+	if defaultAccount, ok := accounts.Get(accounts.DefaultAccount); ok {
+		if approved, policyMethod, decided := systemauth.CheckPolicy(policyRequest, vaultAgent.context, defaultAccount.Config, "SSH Key Signing Request", message); decided {
+			method = policyMethod
+			if !approved {
+				vaultAgent.logSignDecision(auditAction, "", "", sessionKey.comment, false, method)
+				return nil, errors.New("Approval not given")
+			}
+		}
+	}
+
+	// forwarded use is always confirmed
+	if _, isRemote := vaultAgent.remoteOrigin(); sessionKey.confirm || isRemote {
+		method = "session key, prompt"
+		if approved, err := pinentry.GetApproval("SSH Key Signing Request", message); err != nil || !approved {
+			vaultAgent.logSignDecision(auditAction, "", "", sessionKey.comment, false, method)
+			return nil, errors.New("Approval not given")
+		}
+	}
+
+	vaultAgent.logSignDecision(auditAction, "", "", sessionKey.comment, true, method)
+	return signWithFlags(sessionKey.signer, data, flags)
+}
+
+func (vaultAgent vaultAgent) Extension(extensionType string, contents []byte) ([]byte, error) {
+	switch extensionType {
+	case extensionSessionBind:
+		if err := vaultAgent.connection.bind(contents); err != nil {
+			log.Warn("session-bind failed: %s", err.Error())
+			return nil, err
+		}
+		return nil, nil
+	default:
+		return nil, agent.ErrExtensionUnsupported
+	}
 }
 
 func (vaultAgent) Signers() ([]ssh.Signer, error) {
@@ -195,28 +512,66 @@ func (vaultAgent) Signers() ([]ssh.Signer, error) {
 	return []ssh.Signer{}, nil
 }
 
-func (vaultAgent) Unlock(passphrase []byte) error {
-	log.Warn("Unlock Request - Not implemented")
-	return nil
+func (vaultAgent vaultAgent) Unlock(passphrase []byte) error {
+	log.Info("Unlock Request")
+	if vaultAgent.profile != nil {
+		return errProfileSocket
+	}
+	return keystore.unlock(passphrase)
 }
 
 type SSHAgentServer struct {
-	vault               *vault.Vault
-	config              *config.Config
 	runtimeConfig       *config.RuntimeConfig
-	unlockRequestAction func() bool
+	unlockRequestAction func(account *accounts.Account) bool
+	lockAction          func()
 }
 
-func (v *SSHAgentServer) SetUnlockRequestAction(action func() bool) {
+func (v *SSHAgentServer) SetUnlockRequestAction(action func(account *accounts.Account) bool) {
 	v.unlockRequestAction = action
 }
 
-func NewVaultAgent(vault *vault.Vault, config *config.Config, runtimeConfig *config.RuntimeConfig) SSHAgentServer {
+// SetLockAction sets what happens besides locking the agent on ssh-add -x.
+func (v *SSHAgentServer) SetLockAction(action func()) {
+	v.lockAction = action
+}
+
+// serve accepts connections until the listener is closed. Profile sockets serve only the vault keys
+// selected by the profile.
+func (v SSHAgentServer) serve(listener net.Listener, profileName string, profile *config.SSHAgentProfile) {
+	for {
+		var conn, err = listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			panic(err)
+		}
+
+		callingContext := sockets.GetCallingContext(conn)
+
+		log.Info("SSH Agent connection from %s>%s>%s \nby user %s", callingContext.GrandParentProcessName, callingContext.ParentProcessName, callingContext.ProcessName, callingContext.UserName)
+		if profile != nil {
+			log.Info("SSH Agent connection accepted on profile %s", profileName)
+		} else {
+			log.Info("SSH Agent connection accepted")
+		}
+
+		go agent.ServeAgent(vaultAgent{
+			unlockRequestAction: v.unlockRequestAction,
+			lockAction:          v.lockAction,
+			connection:          newConnectionState(),
+			context:             callingContext,
+			profileName:         profileName,
+			profile:             profile,
+		}, conn)
+	}
+}
+
+// NewVaultAgent creates an ssh agent serving the keys of all unlocked accounts.
+func NewVaultAgent(runtimeConfig *config.RuntimeConfig) SSHAgentServer {
 	return SSHAgentServer{
-		vault:         vault,
-		config:        config,
 		runtimeConfig: runtimeConfig,
-		unlockRequestAction: func() bool {
+		unlockRequestAction: func(account *accounts.Account) bool {
 			log.Info("Unlock Request, but no action defined")
 			return false
 		},
@@ -0,0 +1,239 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const sshsigMagic = "SSHSIG"
+
+// SSHSignature is a parsed ssh-keygen -Y sign signature.
+type SSHSignature struct {
+	PublicKey     ssh.PublicKey
+	Namespace     string
+	HashAlgorithm string
+	signature     *ssh.Signature
+}
+
+// ParseSSHSignature parses an armored SSH SIGNATURE block.
+func ParseSSHSignature(armored []byte) (*SSHSignature, error) {
+	block, _ := pem.Decode(armored)
+	if block == nil || block.Type != "SSH SIGNATURE" {
+		return nil, errors.New("not an ssh signature")
+	}
+	if !bytes.HasPrefix(block.Bytes, []byte(sshsigMagic)) {
+		return nil, errors.New("invalid ssh signature magic")
+	}
+
+	var msg struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      []byte
+		HashAlgorithm string
+		Signature     []byte
+	}
+	if err := ssh.Unmarshal(block.Bytes[len(sshsigMagic):], &msg); err != nil {
+		return nil, err
+	}
+	if msg.Version != 1 {
+		return nil, errors.New("unsupported ssh signature version")
+	}
+
+	publicKey, err := ssh.ParsePublicKey(msg.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	signature := new(ssh.Signature)
+	if err := ssh.Unmarshal(msg.Signature, signature); err != nil {
+		return nil, err
+	}
+	return &SSHSignature{
+		PublicKey:     publicKey,
+		Namespace:     msg.Namespace,
+		HashAlgorithm: msg.HashAlgorithm,
+		signature:     signature,
+	}, nil
+}
+
+// Verify checks the signature over message and its namespace. It does not check who signed.
+func (signature *SSHSignature) Verify(message io.Reader, namespace string) error {
+	if signature.Namespace != namespace {
+		return errors.New("signature namespace " + signature.Namespace + " does not match " + namespace)
+	}
+
+	var digest []byte
+	switch signature.HashAlgorithm {
+	case "sha256":
+		hash := sha256.New()
+		if _, err := io.Copy(hash, message); err != nil {
+			return err
+		}
+		digest = hash.Sum(nil)
+	case "sha512":
+		hash := sha512.New()
+		if _, err := io.Copy(hash, message); err != nil {
+			return err
+		}
+		digest = hash.Sum(nil)
+	default:
+		return errors.New("unsupported signature hash " + signature.HashAlgorithm)
+	}
+
+	signedData := append([]byte(sshsigMagic), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      []byte
+		HashAlgorithm string
+		Hash          []byte
+	}{signature.Namespace, nil, signature.HashAlgorithm, digest})...)
+	return signature.PublicKey.Verify(signedData, signature.signature)
+}
+
+// AllowedSigner is an entry of an allowed signers file (see ssh-keygen(1)).
+type AllowedSigner struct {
+	// patterns like in the allowed signers file, e.g. *@example.com
+	Principals []string
+	// compare the principals literally instead of as patterns, for principals not written by the user
+	LiteralPrincipals bool
+	// empty if the key may sign in any namespace
+	Namespaces    []string
+	PublicKey     ssh.PublicKey
+	CertAuthority bool
+}
+
+// ParseAllowedSigners parses an allowed signers file. valid-after and valid-before are not supported
+// and such entries are skipped.
+func ParseAllowedSigners(data []byte) ([]AllowedSigner, error) {
+	var signers []AllowedSigner
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		principals, rest, found := cutPrincipals(line)
+		if !found {
+			return nil, errors.New("invalid allowed signers line: " + line)
+		}
+		publicKey, _, options, _, err := ssh.ParseAuthorizedKey([]byte(rest))
+		if err != nil {
+			return nil, err
+		}
+
+		signer := AllowedSigner{
+			Principals: strings.Split(principals, ","),
+			PublicKey:  publicKey,
+		}
+		supported := true
+		for _, option := range options {
+			name, value, _ := strings.Cut(option, "=")
+			switch strings.ToLower(name) {
+			case "namespaces":
+				signer.Namespaces = strings.Split(strings.Trim(value, "\""), ",")
+			case "cert-authority":
+				signer.CertAuthority = true
+			default:
+				supported = false
+			}
+		}
+		if supported {
+			signers = append(signers, signer)
+		}
+	}
+	return signers, scanner.Err()
+}
+
+// cutPrincipals splits the principals, which may be quoted, from the rest of an allowed signers line.
+func cutPrincipals(line string) (string, string, bool) {
+	if strings.HasPrefix(line, "\"") {
+		end := strings.Index(line[1:], "\"")
+		if end < 0 {
+			return "", "", false
+		}
+		return line[1 : end+1], strings.TrimSpace(line[end+2:]), true
+	}
+	principals, rest, found := strings.Cut(line, " ")
+	return principals, strings.TrimSpace(rest), found
+}
+
+func (signer AllowedSigner) allowsNamespace(namespace string) bool {
+	if len(signer.Namespaces) == 0 {
+		return true
+	}
+	for _, pattern := range signer.Namespaces {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (signer AllowedSigner) matchesKey(publicKey ssh.PublicKey) bool {
+	cert, isCert := publicKey.(*ssh.Certificate)
+	if signer.CertAuthority {
+		return isCert && cert.CertType == ssh.UserCert && Eq(cert.SignatureKey, signer.PublicKey)
+	}
+	return !isCert && Eq(publicKey, signer.PublicKey)
+}
+
+func (signer AllowedSigner) matchesPrincipal(principal string) bool {
+	for _, pattern := range signer.Principals {
+		if signer.LiteralPrincipals {
+			if pattern == principal {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(pattern, principal); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// FindPrincipals returns the principals allowed to make the signature, like ssh-keygen -Y find-principals.
+func FindPrincipals(signers []AllowedSigner, signature *SSHSignature) []string {
+	var principals []string
+	for _, signer := range signers {
+		if !signer.matchesKey(signature.PublicKey) || !signer.allowsNamespace(signature.Namespace) {
+			continue
+		}
+		if cert, ok := signature.PublicKey.(*ssh.Certificate); ok {
+			for _, principal := range cert.ValidPrincipals {
+				if signer.matchesPrincipal(principal) {
+					principals = append(principals, principal)
+				}
+			}
+			continue
+		}
+		principals = append(principals, signer.Principals...)
+	}
+	return principals
+}
+
+// IsAllowedSigner reports whether principal may make the signature, like ssh-keygen -Y verify.
+func IsAllowedSigner(signers []AllowedSigner, signature *SSHSignature, principal string) bool {
+	for _, signer := range signers {
+		if !signer.matchesKey(signature.PublicKey) || !signer.allowsNamespace(signature.Namespace) || !signer.matchesPrincipal(principal) {
+			continue
+		}
+		if cert, ok := signature.PublicKey.(*ssh.Certificate); ok {
+			checker := ssh.CertChecker{}
+			if err := checker.CheckCert(principal, cert); err != nil {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
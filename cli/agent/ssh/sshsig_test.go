@@ -0,0 +1,22 @@
+package ssh
+
+import "testing"
+
+func TestMatchesPrincipal(t *testing.T) {
+	tests := []struct {
+		signer    AllowedSigner
+		principal string
+		matches   bool
+	}{
+		{AllowedSigner{Principals: []string{"*@example.com"}}, "alice@example.com", true},
+		{AllowedSigner{Principals: []string{"*@example.com"}}, "alice@example.org", false},
+		{AllowedSigner{Principals: []string{"*@example.com"}, LiteralPrincipals: true}, "alice@example.com", false},
+		{AllowedSigner{Principals: []string{"*"}, LiteralPrincipals: true}, "alice@example.com", false},
+		{AllowedSigner{Principals: []string{"bob", "alice@example.com"}, LiteralPrincipals: true}, "alice@example.com", true},
+	}
+	for _, test := range tests {
+		if matches := test.signer.matchesPrincipal(test.principal); matches != test.matches {
+			t.Errorf("%v (literal %t) matching %s: got %t, want %t", test.signer.Principals, test.signer.LiteralPrincipals, test.principal, matches, test.matches)
+		}
+	}
+}
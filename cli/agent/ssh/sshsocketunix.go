@@ -3,45 +3,33 @@
 package ssh
 
 import (
+	"errors"
 	"net"
 	"os"
-
-	"github.com/quexten/goldwarden/cli/agent/sockets"
-	"golang.org/x/crypto/ssh/agent"
 )
 
-func (v SSHAgentServer) Serve() {
-	path := v.runtimeConfig.SSHAgentSocketPath
-	if _, err := os.Stat(path); err == nil {
+// listen replaces a stale socket at the path, but never removes other files.
+func listen(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != os.ModeSocket {
+			return nil, errors.New(path + " exists and is not a socket")
+		}
 		if err := os.Remove(path); err != nil {
 			log.Error("Could not remove old socket file: %s", err)
-			return
+			return nil, err
 		}
 	}
-	listener, err := net.Listen("unix", path)
+	return net.Listen("unix", path)
+}
+
+func (v SSHAgentServer) Serve() {
+	path := v.runtimeConfig.SSHAgentSocketPath
+	listener, err := listen(path)
 	if err != nil {
 		panic(err)
 	}
 	defer listener.Close()
 
 	log.Info("SSH Agent listening on %s", path)
-
-	for {
-		var conn, err = listener.Accept()
-		if err != nil {
-			panic(err)
-		}
-
-		callingContext := sockets.GetCallingContext(conn)
-
-		log.Info("SSH Agent connection from %s>%s>%s \nby user %s", callingContext.GrandParentProcessName, callingContext.ParentProcessName, callingContext.ProcessName, callingContext.UserName)
-		log.Info("SSH Agent connection accepted")
-
-		go agent.ServeAgent(vaultAgent{
-			vault:               v.vault,
-			config:              v.config,
-			unlockRequestAction: v.unlockRequestAction,
-			context:             callingContext,
-		}, conn)
-	}
+	v.serve(listener, "", nil)
 }
@@ -3,6 +3,7 @@ package pinentry
 import (
 	"errors"
 	"os"
+	"sync"
 
 	"github.com/quexten/goldwarden/cli/logging"
 )
@@ -15,7 +16,9 @@ type Pinentry struct {
 	GetApproval func(title string, description string) (bool, error)
 }
 
-var externalPinentry Pinentry = Pinentry{}
+// pinentry of a connected client, used when no system pinentry is available
+var externalPinentry *Pinentry
+var externalPinentryMu sync.Mutex
 
 func init() {
 	if os.Getenv("GOLDWARDEN_SYSTEM_AUTH_DISABLED") == "true" {
@@ -23,8 +26,11 @@ func init() {
 	}
 }
 
-func SetExternalPinentry(pinentry Pinentry) error {
-	if externalPinentry.GetPassword != nil {
+func SetExternalPinentry(pinentry *Pinentry) error {
+	externalPinentryMu.Lock()
+	defer externalPinentryMu.Unlock()
+
+	if externalPinentry != nil {
 		return errors.New("External pinentry already set")
 	}
 
@@ -32,14 +38,31 @@ func SetExternalPinentry(pinentry Pinentry) error {
 	return nil
 }
 
+// ClearExternalPinentry removes the external pinentry, unless another one was registered since.
+func ClearExternalPinentry(pinentry *Pinentry) {
+	externalPinentryMu.Lock()
+	defer externalPinentryMu.Unlock()
+
+	if externalPinentry == pinentry {
+		externalPinentry = nil
+	}
+}
+
+func getExternalPinentry() *Pinentry {
+	externalPinentryMu.Lock()
+	defer externalPinentryMu.Unlock()
+
+	return externalPinentry
+}
+
 func GetPassword(title string, description string) (string, error) {
 	password, err := getPassword(title, description)
 	if err == nil {
 		return password, nil
 	}
 
-	if externalPinentry.GetPassword != nil {
-		return externalPinentry.GetPassword(title, description)
+	if external := getExternalPinentry(); external != nil && external.GetPassword != nil {
+		return external.GetPassword(title, description)
 	}
 
 	return password, err
@@ -51,8 +74,8 @@ func GetApproval(title string, description string) (bool, error) {
 		return approval, nil
 	}
 
-	if externalPinentry.GetApproval != nil {
-		return externalPinentry.GetApproval(title, description)
+	if external := getExternalPinentry(); external != nil && external.GetApproval != nil {
+		return external.GetApproval(title, description)
 	}
 
 	return approval, err
@@ -0,0 +1,118 @@
+package systemauth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/sockets"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/biometrics"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/pinentry"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/policy"
+)
+
+type policyApproval struct {
+	ruleIndex      int
+	pid            int
+	parentPid      int
+	grandParentPid int
+	expires        time.Time
+}
+
+var policyApprovals = []policyApproval{}
+var policyApprovalsMu sync.Mutex
+
+// CheckPolicy applies the first matching policy rule. If no rule matches, decided is false and the
+// caller should fall back to its built-in approval flow. method describes how the decision was made.
+func CheckPolicy(request policy.Request, ctx sockets.CallingContext, config *config.Config, title string, message string) (approved bool, method string, decided bool) {
+	result := policy.Evaluate(request)
+	method = fmt.Sprintf("policy rule %d %s", result.RuleIndex, result.Decision)
+
+	switch result.Decision {
+	case policy.DecisionNone:
+		return false, "", false
+	case policy.DecisionAllow:
+		log.Info("Policy rule %d (%s) allowed %s for %s", result.RuleIndex, result.RuleName, request.Action, ctx.ProcessName)
+		return true, method, true
+	case policy.DecisionDeny:
+		log.Info("Policy rule %d (%s) denied %s for %s", result.RuleIndex, result.RuleName, request.Action, ctx.ProcessName)
+		return false, method, true
+	}
+
+	// the same rule may match in the action wrapper and in the action itself
+	if ctx.ApprovedPolicyRules[result.RuleIndex] {
+		return true, method + " (approved for this request)", true
+	}
+	if isPolicyApprovalRemembered(result.RuleIndex, ctx) {
+		log.Info("Using remembered approval of policy rule %d (%s)", result.RuleIndex, result.RuleName)
+		return true, method + " (remembered)", true
+	}
+
+	approved = false
+	switch result.Decision {
+	case policy.DecisionAsk:
+		approval, err := pinentry.GetApproval(title, message)
+		if err != nil {
+			log.Error(err.Error())
+		}
+		approved = err == nil && approval
+	case policy.DecisionBiometrics:
+		biometricsApprovalType := biometrics.AccessVault
+		if request.Action == policy.ActionSSHSign || request.Action == policy.ActionGitSign || request.Action == policy.ActionUseSSHKey {
+			biometricsApprovalType = biometrics.SSHKey
+		}
+		verified, err := verifyUser(biometricsApprovalType, message, config)
+		if err != nil {
+			log.Error(err.Error())
+		}
+		approved = err == nil && verified
+	}
+
+	if approved {
+		if ctx.ApprovedPolicyRules != nil {
+			ctx.ApprovedPolicyRules[result.RuleIndex] = true
+		}
+		if result.TTL > 0 {
+			rememberPolicyApproval(result.RuleIndex, ctx, result.TTL)
+		}
+	}
+	return approved, method, true
+}
+
+func rememberPolicyApproval(ruleIndex int, ctx sockets.CallingContext, ttl time.Duration) {
+	policyApprovalsMu.Lock()
+	defer policyApprovalsMu.Unlock()
+
+	validApprovals := make([]policyApproval, 0)
+	for _, approval := range policyApprovals {
+		if approval.expires.After(time.Now()) {
+			validApprovals = append(validApprovals, approval)
+		}
+	}
+	policyApprovals = append(validApprovals, policyApproval{
+		ruleIndex:      ruleIndex,
+		pid:            ctx.ProcessPid,
+		parentPid:      ctx.ParentProcessPid,
+		grandParentPid: ctx.GrandParentProcessPid,
+		expires:        time.Now().Add(ttl),
+	})
+}
+
+func isPolicyApprovalRemembered(ruleIndex int, ctx sockets.CallingContext) bool {
+	policyApprovalsMu.Lock()
+	defer policyApprovalsMu.Unlock()
+
+	for _, approval := range policyApprovals {
+		if approval.ruleIndex == ruleIndex && approval.pid == ctx.ProcessPid && approval.parentPid == ctx.ParentProcessPid && approval.grandParentPid == ctx.GrandParentProcessPid && approval.expires.After(time.Now()) {
+			return true
+		}
+	}
+	return false
+}
+
+func WipePolicyApprovals() {
+	policyApprovalsMu.Lock()
+	policyApprovals = []policyApproval{}
+	policyApprovalsMu.Unlock()
+}
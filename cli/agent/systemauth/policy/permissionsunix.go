@@ -0,0 +1,24 @@
+//go:build !windows
+
+package policy
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+func checkPermissions(info fs.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return errors.New("could not determine the owner")
+	}
+	if int(stat.Uid) != os.Getuid() {
+		return errors.New("file is not owned by the current user")
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return errors.New("file is writable by group or others")
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/quexten/goldwarden/cli/agent/sockets"
+	"github.com/quexten/goldwarden/cli/logging"
+)
+
+var log = logging.GetLogger("Goldwarden", "Policy")
+
+type Action string
+
+const (
+	ActionAccessVault       Action = "access-vault"
+	ActionUseSSHKey         Action = "use-ssh-key"
+	ActionGetLogin          Action = "get-login"
+	ActionGetTOTP           Action = "get-totp"
+	ActionCreateLogin       Action = "create-login"
+	ActionEditLogin         Action = "edit-login"
+	ActionDeleteLogin       Action = "delete-login"
+	ActionGetCard           Action = "get-card"
+	ActionGetIdentity       Action = "get-identity"
+	ActionGetCLICredentials Action = "get-cli-credentials"
+	ActionBrowserBiometrics Action = "browser-biometrics"
+	ActionSSHSign           Action = "ssh-sign"
+	ActionGitSign           Action = "git-sign"
+	ActionEditSSHKey        Action = "edit-ssh-key"
+)
+
+type Decision string
+
+const (
+	// no rule matched, the built-in approval flow is used
+	DecisionNone       Decision = ""
+	DecisionAllow      Decision = "allow"
+	DecisionDeny       Decision = "deny"
+	DecisionAsk        Decision = "ask"
+	DecisionBiometrics Decision = "biometrics"
+)
+
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(data []byte) error {
+	parsed, err := time.ParseDuration(string(data))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Rule fields are glob patterns (see path.Match), empty fields match everything.
+// Ancestry is matched against the calling process, its parent and its grandparent, in that order.
+// Cipher, Folder and Key only match requests that concern a specific entry.
+// Rules apply either to local requests or, with Forwarded set, to requests from a forwarded ssh agent
+// or a remote ssh session, so rules for local use never allow remote use. RemoteHost only matches
+// forwarded requests.
+type Rule struct {
+	Name       string   `json:"name"`
+	Actions    []Action `json:"actions"`
+	Executable string   `json:"executable"`
+	Ancestry   []string `json:"ancestry"`
+	Cipher     string   `json:"cipher"`
+	Folder     string   `json:"folder"`
+	Key        string   `json:"key"`
+	Forwarded  bool     `json:"forwarded"`
+	RemoteHost string   `json:"remoteHost"`
+	Decision   Decision `json:"decision"`
+	TTL        Duration `json:"ttl"`
+}
+
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+type Request struct {
+	Action         Action
+	ExecutablePath string
+	Ancestry       []string
+	Cipher         string
+	Folder         string
+	Key            string
+	Forwarded      bool
+	RemoteHost     string
+}
+
+type Result struct {
+	Decision  Decision
+	RuleIndex int
+	RuleName  string
+	TTL       time.Duration
+}
+
+var current = Policy{}
+var currentPath = ""
+var mu sync.Mutex
+
+func NewRequest(action Action, ctx sockets.CallingContext) Request {
+	return Request{
+		Action:         action,
+		ExecutablePath: ctx.ProcessPath,
+		Ancestry:       []string{ctx.ProcessName, ctx.ParentProcessName, ctx.GrandParentProcessName},
+	}
+}
+
+func Parse(data []byte) (Policy, error) {
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return Policy{}, err
+	}
+
+	for i, rule := range policy.Rules {
+		switch rule.Decision {
+		case DecisionAllow, DecisionDeny, DecisionAsk, DecisionBiometrics:
+		default:
+			return Policy{}, fmt.Errorf("rule %d: invalid decision %q", i, rule.Decision)
+		}
+
+		patterns := append([]string{rule.Executable, rule.Cipher, rule.Folder, rule.Key, rule.RemoteHost}, rule.Ancestry...)
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return Policy{}, fmt.Errorf("rule %d: invalid pattern %q", i, pattern)
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// Read parses the policy in the given file without applying it. A missing file results in an
+// empty policy. Files other users can modify are refused, as an allow rule skips all prompts.
+func Read(policyPath string) (Policy, error) {
+	info, err := os.Stat(policyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Info("No policy file found at %s", policyPath)
+		return Policy{}, nil
+	} else if err != nil {
+		return Policy{}, err
+	}
+	if err := checkPermissions(info); err != nil {
+		return Policy{}, fmt.Errorf("refusing to load %s: %w", policyPath, err)
+	}
+
+	data, err := os.ReadFile(policyPath)
+	if err != nil {
+		return Policy{}, err
+	}
+	return Parse(data)
+}
+
+// Apply replaces the current policy.
+func Apply(policyPath string, policy Policy) {
+	mu.Lock()
+	current = policy
+	currentPath = policyPath
+	mu.Unlock()
+	log.Info("Loaded %d policy rules from %s", len(policy.Rules), policyPath)
+}
+
+// Load replaces the current policy with the one in the given file.
+func Load(policyPath string) (int, error) {
+	policy, err := Read(policyPath)
+	if err != nil {
+		return 0, err
+	}
+	Apply(policyPath, policy)
+	return len(policy.Rules), nil
+}
+
+func Reload() (int, error) {
+	mu.Lock()
+	policyPath := currentPath
+	mu.Unlock()
+
+	if policyPath == "" {
+		return 0, errors.New("no policy file configured")
+	}
+	return Load(policyPath)
+}
+
+func Evaluate(request Request) Result {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return current.Evaluate(request)
+}
+
+// Evaluate returns the decision of the first matching rule.
+func (policy Policy) Evaluate(request Request) Result {
+	for i, rule := range policy.Rules {
+		if rule.matches(request) {
+			return Result{
+				Decision:  rule.Decision,
+				RuleIndex: i,
+				RuleName:  rule.Name,
+				TTL:       time.Duration(rule.TTL),
+			}
+		}
+	}
+
+	return Result{
+		Decision:  DecisionNone,
+		RuleIndex: -1,
+	}
+}
+
+func (rule Rule) matches(request Request) bool {
+	if len(rule.Actions) > 0 {
+		found := false
+		for _, action := range rule.Actions {
+			if action == request.Action || action == "*" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if !matchPattern(rule.Executable, request.ExecutablePath) {
+		return false
+	}
+
+	for i, pattern := range rule.Ancestry {
+		if i >= len(request.Ancestry) || !matchPattern(pattern, request.Ancestry[i]) {
+			return false
+		}
+	}
+
+	if rule.Forwarded != request.Forwarded {
+		return false
+	}
+
+	return matchPattern(rule.Cipher, request.Cipher) &&
+		matchPattern(rule.Folder, request.Folder) &&
+		matchPattern(rule.Key, request.Key) &&
+		matchPattern(rule.RemoteHost, request.RemoteHost)
+}
+
+func matchPattern(pattern string, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	if value == "" {
+		return false
+	}
+
+	matched, err := path.Match(pattern, value)
+	return err == nil && matched
+}
@@ -0,0 +1,151 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+const testPolicy = `{
+	"rules": [
+		{"name": "deny forwarded", "actions": ["ssh-sign"], "forwarded": true, "remoteHost": "*.untrusted.example", "decision": "deny"},
+		{"name": "git signing", "actions": ["git-sign"], "executable": "/usr/bin/git", "decision": "allow"},
+		{"name": "work keys", "actions": ["ssh-sign"], "ancestry": ["ssh", "bash"], "key": "work-*", "decision": "ask", "ttl": "10m"},
+		{"name": "browser", "actions": ["*"], "executable": "/usr/lib/*/firefox", "folder": "Web", "decision": "biometrics"},
+		{"name": "totp", "actions": ["get-totp"], "cipher": "github*", "decision": "allow"},
+		{"name": "remote", "actions": ["ssh-sign"], "forwarded": true, "decision": "ask"}
+	]
+}`
+
+func TestEvaluate(t *testing.T) {
+	policy, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		request  Request
+		decision Decision
+		rule     int
+	}{
+		{
+			name:     "executable matches exactly",
+			request:  Request{Action: ActionGitSign, ExecutablePath: "/usr/bin/git"},
+			decision: DecisionAllow,
+			rule:     1,
+		},
+		{
+			name:     "executable does not match",
+			request:  Request{Action: ActionGitSign, ExecutablePath: "/tmp/git"},
+			decision: DecisionNone,
+			rule:     -1,
+		},
+		{
+			name:     "ancestry and key glob",
+			request:  Request{Action: ActionSSHSign, Ancestry: []string{"ssh", "bash", "sshd"}, Key: "work-laptop"},
+			decision: DecisionAsk,
+			rule:     2,
+		},
+		{
+			name:     "key glob does not match",
+			request:  Request{Action: ActionSSHSign, Ancestry: []string{"ssh", "bash"}, Key: "personal"},
+			decision: DecisionNone,
+			rule:     -1,
+		},
+		{
+			name:     "ancestry longer than request",
+			request:  Request{Action: ActionSSHSign, Ancestry: []string{"ssh"}, Key: "work-laptop"},
+			decision: DecisionNone,
+			rule:     -1,
+		},
+		{
+			name:     "glob does not match across path separators",
+			request:  Request{Action: ActionAccessVault, ExecutablePath: "/usr/lib/firefox/esr/firefox", Folder: "Web"},
+			decision: DecisionNone,
+			rule:     -1,
+		},
+		{
+			name:     "wildcard action and executable glob",
+			request:  Request{Action: ActionAccessVault, ExecutablePath: "/usr/lib/firefox-esr/firefox", Folder: "Web"},
+			decision: DecisionBiometrics,
+			rule:     3,
+		},
+		{
+			name:     "entry patterns do not match requests without an entry",
+			request:  Request{Action: ActionAccessVault, ExecutablePath: "/usr/lib/firefox-esr/firefox"},
+			decision: DecisionNone,
+			rule:     -1,
+		},
+		{
+			name:     "cipher glob",
+			request:  Request{Action: ActionGetTOTP, Cipher: "github.com"},
+			decision: DecisionAllow,
+			rule:     4,
+		},
+		{
+			name:     "local rules do not match forwarded requests",
+			request:  Request{Action: ActionSSHSign, Ancestry: []string{"ssh", "bash"}, Key: "work-laptop", Forwarded: true, RemoteHost: "build.example"},
+			decision: DecisionAsk,
+			rule:     5,
+		},
+		{
+			name:     "first matching rule wins",
+			request:  Request{Action: ActionSSHSign, Forwarded: true, RemoteHost: "host.untrusted.example"},
+			decision: DecisionDeny,
+			rule:     0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := policy.Evaluate(test.request)
+			if result.Decision != test.decision || result.RuleIndex != test.rule {
+				t.Errorf("got %s by rule %d, want %s by rule %d", result.Decision, result.RuleIndex, test.decision, test.rule)
+			}
+		})
+	}
+
+	if result := policy.Evaluate(tests[2].request); result.TTL != 10*time.Minute {
+		t.Errorf("got ttl %s, want 10m", result.TTL)
+	}
+}
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	invalid := []string{
+		`{"rules": [{"decision": "maybe"}]}`,
+		`{"rules": [{"executable": "[", "decision": "allow"}]}`,
+		`{"rules": [{"ancestry": ["ssh", "["], "decision": "allow"}]}`,
+		`{"rules": [{"ttl": "soon", "decision": "ask"}]}`,
+	}
+	for _, data := range invalid {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("expected %s to be rejected", data)
+		}
+	}
+}
+
+func TestReadRejectsWritablePolicy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not checked on windows")
+	}
+
+	policyPath := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(policyPath, []byte(testPolicy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if policy, err := Read(policyPath); err != nil || len(policy.Rules) != 6 {
+		t.Fatalf("got %d rules, %v", len(policy.Rules), err)
+	}
+
+	for _, mode := range []os.FileMode{0620, 0602} {
+		if err := os.Chmod(policyPath, mode); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Read(policyPath); err == nil {
+			t.Errorf("policy with mode %o was loaded", mode)
+		}
+	}
+}
@@ -90,20 +90,8 @@ func GetPermission(sessionType SessionType, ctx sockets.CallingContext, config *
 		log.Info("Permission granted from cached session")
 	} else {
 		if !sessionStore.verifySession(ctx, Pin) {
-			if biometrics.BiometricsWorking() {
-				biometricsApproval := biometrics.CheckBiometrics(biometricsApprovalType)
-				if !biometricsApproval {
-					return false, nil
-				}
-			} else {
-				log.Warn("Biometrics is not available, asking for pin")
-				pin, err := pinentry.GetPassword("Enter PIN", "Biometrics is not available. Enter your pin to authorize this action. "+message)
-				if err != nil {
-					return false, err
-				}
-				if !config.VerifyPin(pin) {
-					return false, nil
-				}
+			if verified, err := verifyUser(biometricsApprovalType, message, config); err != nil || !verified {
+				return false, err
 			}
 		}
 
@@ -118,6 +106,19 @@ func GetPermission(sessionType SessionType, ctx sockets.CallingContext, config *
 	return true, nil
 }
 
+func verifyUser(biometricsApprovalType biometrics.Approval, message string, config *config.Config) (bool, error) {
+	if biometrics.BiometricsWorking() {
+		return biometrics.CheckBiometrics(biometricsApprovalType), nil
+	}
+
+	log.Warn("Biometrics is not available, asking for pin")
+	pin, err := pinentry.GetPassword("Enter PIN", "Biometrics is not available. Enter your pin to authorize this action. "+message)
+	if err != nil {
+		return false, err
+	}
+	return config.VerifyPin(pin), nil
+}
+
 // no session
 func CheckBiometrics(callingContext *sockets.CallingContext, approvalType biometrics.Approval) bool {
 	var message = fmt.Sprintf("Do you want to grant %s>%s>%s one-time access your vault?", callingContext.GrandParentProcessName, callingContext.ParentProcessName, callingContext.ProcessName)
@@ -152,4 +153,5 @@ func GetSSHSession(ctx sockets.CallingContext) bool {
 
 func WipeSessions() {
 	sessionStore.Store = []Session{}
+	WipePolicyApprovals()
 }
@@ -0,0 +1,183 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDigits = 6
+	defaultPeriod = 30
+	steamDigits   = 5
+	steamAlphabet = "23456789BCDFGHJKMNPQRTVWXY"
+)
+
+type Algorithm string
+
+const (
+	AlgorithmSHA1   Algorithm = "SHA1"
+	AlgorithmSHA256 Algorithm = "SHA256"
+	AlgorithmSHA512 Algorithm = "SHA512"
+)
+
+type Params struct {
+	Secret    []byte
+	Digits    int
+	Period    int
+	Algorithm Algorithm
+	Steam     bool
+}
+
+type Code struct {
+	Code             string
+	Period           int
+	SecondsRemaining int
+}
+
+// ParseSeed accepts a plain base32 secret, an otpauth://totp/ uri or a steam:// secret
+// as stored in the totp field of a login.
+func ParseSeed(seed string) (Params, error) {
+	params := Params{
+		Digits:    defaultDigits,
+		Period:    defaultPeriod,
+		Algorithm: AlgorithmSHA1,
+	}
+
+	seed = strings.TrimSpace(seed)
+	if seed == "" {
+		return Params{}, errors.New("empty totp seed")
+	}
+
+	var secret string
+	lowerSeed := strings.ToLower(seed)
+	switch {
+	case strings.HasPrefix(lowerSeed, "steam://"):
+		secret = seed[len("steam://"):]
+		params.Steam = true
+		params.Digits = steamDigits
+	case strings.HasPrefix(lowerSeed, "otpauth://"):
+		uri, err := url.Parse(seed)
+		if err != nil {
+			return Params{}, errors.New("invalid otpauth uri")
+		}
+		if !strings.EqualFold(uri.Host, "totp") {
+			return Params{}, errors.New("unsupported otp type " + uri.Host)
+		}
+
+		query := uri.Query()
+		secret = query.Get("secret")
+		if digits := query.Get("digits"); digits != "" {
+			params.Digits, err = strconv.Atoi(digits)
+			if err != nil || params.Digits < 1 || params.Digits > 10 {
+				return Params{}, errors.New("invalid digits " + digits)
+			}
+		}
+		if period := query.Get("period"); period != "" {
+			params.Period, err = strconv.Atoi(period)
+			if err != nil || params.Period < 1 {
+				return Params{}, errors.New("invalid period " + period)
+			}
+		}
+		if algorithm := query.Get("algorithm"); algorithm != "" {
+			params.Algorithm = Algorithm(strings.ToUpper(algorithm))
+			if params.Algorithm != AlgorithmSHA1 && params.Algorithm != AlgorithmSHA256 && params.Algorithm != AlgorithmSHA512 {
+				return Params{}, errors.New("unsupported algorithm " + algorithm)
+			}
+		}
+		if strings.EqualFold(query.Get("encoder"), "steam") {
+			params.Steam = true
+			params.Digits = steamDigits
+		}
+	default:
+		secret = seed
+	}
+
+	decodedSecret, err := decodeSecret(secret)
+	if err != nil {
+		return Params{}, err
+	}
+	params.Secret = decodedSecret
+	return params, nil
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+	if secret == "" {
+		return nil, errors.New("missing totp secret")
+	}
+
+	decoded, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return nil, errors.New("totp secret is not valid base32")
+	}
+	return decoded, nil
+}
+
+func GenerateCode(params Params, at time.Time) (Code, error) {
+	if len(params.Secret) == 0 {
+		return Code{}, errors.New("missing totp secret")
+	}
+	if params.Period <= 0 {
+		params.Period = defaultPeriod
+	}
+	if params.Digits <= 0 {
+		params.Digits = defaultDigits
+	}
+
+	var hashFunc func() hash.Hash
+	switch params.Algorithm {
+	case AlgorithmSHA1, "":
+		hashFunc = sha1.New
+	case AlgorithmSHA256:
+		hashFunc = sha256.New
+	case AlgorithmSHA512:
+		hashFunc = sha512.New
+	default:
+		return Code{}, errors.New("unsupported algorithm " + string(params.Algorithm))
+	}
+
+	unix := at.Unix()
+	counter := uint64(unix / int64(params.Period))
+	counterBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(counterBytes, counter)
+
+	mac := hmac.New(hashFunc, params.Secret)
+	mac.Write(counterBytes)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	truncated := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	var code string
+	if params.Steam {
+		steamCode := make([]byte, steamDigits)
+		for i := range steamCode {
+			steamCode[i] = steamAlphabet[truncated%uint32(len(steamAlphabet))]
+			truncated /= uint32(len(steamAlphabet))
+		}
+		code = string(steamCode)
+	} else {
+		code = strconv.FormatUint(uint64(truncated), 10)
+		if len(code) > params.Digits {
+			code = code[len(code)-params.Digits:]
+		}
+		code = strings.Repeat("0", params.Digits-len(code)) + code
+	}
+
+	return Code{
+		Code:             code,
+		Period:           params.Period,
+		SecondsRemaining: params.Period - int(unix%int64(params.Period)),
+	}, nil
+}
@@ -0,0 +1,104 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// test vectors from RFC 6238 appendix B
+func TestGenerateCodeRFC6238(t *testing.T) {
+	secrets := map[Algorithm][]byte{
+		AlgorithmSHA1:   []byte("12345678901234567890"),
+		AlgorithmSHA256: []byte("12345678901234567890123456789012"),
+		AlgorithmSHA512: []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	tests := []struct {
+		unix      int64
+		algorithm Algorithm
+		code      string
+	}{
+		{59, AlgorithmSHA1, "94287082"},
+		{59, AlgorithmSHA256, "46119246"},
+		{59, AlgorithmSHA512, "90693936"},
+		{1111111109, AlgorithmSHA1, "07081804"},
+		{1111111109, AlgorithmSHA256, "68084774"},
+		{1111111109, AlgorithmSHA512, "25091201"},
+		{1111111111, AlgorithmSHA1, "14050471"},
+		{1111111111, AlgorithmSHA256, "67062674"},
+		{1111111111, AlgorithmSHA512, "99943326"},
+		{1234567890, AlgorithmSHA1, "89005924"},
+		{1234567890, AlgorithmSHA256, "91819424"},
+		{1234567890, AlgorithmSHA512, "93441116"},
+		{2000000000, AlgorithmSHA1, "69279037"},
+		{2000000000, AlgorithmSHA256, "90698825"},
+		{2000000000, AlgorithmSHA512, "38618901"},
+		{20000000000, AlgorithmSHA1, "65353130"},
+		{20000000000, AlgorithmSHA256, "77737706"},
+		{20000000000, AlgorithmSHA512, "47863826"},
+	}
+
+	for _, test := range tests {
+		params := Params{
+			Secret:    secrets[test.algorithm],
+			Digits:    8,
+			Period:    30,
+			Algorithm: test.algorithm,
+		}
+		code, err := GenerateCode(params, time.Unix(test.unix, 0))
+		if err != nil {
+			t.Fatalf("%s at %d: %v", test.algorithm, test.unix, err)
+		}
+		if code.Code != test.code {
+			t.Errorf("%s at %d: got %s, want %s", test.algorithm, test.unix, code.Code, test.code)
+		}
+	}
+}
+
+func TestGenerateCodeSteam(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	params, err := ParseSeed("steam://" + secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !params.Steam || params.Digits != steamDigits {
+		t.Fatalf("steam seed parsed as %+v", params)
+	}
+
+	// the truncated values 1284755224 and 1094287082 of RFC 4226 appendix D, in steam's alphabet
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{0, "GG5F5"},
+		{59, "PV9M4"},
+	}
+	for _, test := range tests {
+		code, err := GenerateCode(params, time.Unix(test.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code.Code != test.code {
+			t.Errorf("at %d: got %s, want %s", test.unix, code.Code, test.code)
+		}
+	}
+}
+
+func TestParseSeedOtpauth(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890123456789012"))
+	params, err := ParseSeed("otpauth://totp/Example:alice?secret=" + secret + "&algorithm=SHA256&digits=8&period=60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Algorithm != AlgorithmSHA256 || params.Digits != 8 || params.Period != 60 {
+		t.Fatalf("unexpected params %+v", params)
+	}
+
+	code, err := GenerateCode(params, time.Unix(119, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.SecondsRemaining != 1 {
+		t.Errorf("got %d seconds remaining, want 1", code.SecondsRemaining)
+	}
+}
@@ -1,32 +1,39 @@
 package agent
 
 import (
+	"bufio"
 	"context"
 	"crypto/subtle"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"time"
 
+	"github.com/quexten/goldwarden/cli/agent/accounts"
 	"github.com/quexten/goldwarden/cli/agent/actions"
+	"github.com/quexten/goldwarden/cli/agent/audit"
 	"github.com/quexten/goldwarden/cli/agent/bitwarden"
 	"github.com/quexten/goldwarden/cli/agent/bitwarden/crypto"
 	"github.com/quexten/goldwarden/cli/agent/config"
+	"github.com/quexten/goldwarden/cli/agent/events"
 	"github.com/quexten/goldwarden/cli/agent/notify"
 	"github.com/quexten/goldwarden/cli/agent/processsecurity"
 	"github.com/quexten/goldwarden/cli/agent/sockets"
 	"github.com/quexten/goldwarden/cli/agent/ssh"
 	"github.com/quexten/goldwarden/cli/agent/systemauth"
 	"github.com/quexten/goldwarden/cli/agent/systemauth/pinentry"
+	"github.com/quexten/goldwarden/cli/agent/systemauth/policy"
 	"github.com/quexten/goldwarden/cli/agent/vault"
+	"github.com/quexten/goldwarden/cli/ipc"
 	"github.com/quexten/goldwarden/cli/ipc/messages"
 	"github.com/quexten/goldwarden/cli/logging"
 )
 
 const (
-	FullSyncInterval     = 60 * time.Minute
-	TokenRefreshInterval = 10 * time.Minute
+	FullSyncInterval       = 60 * time.Minute
+	CacheReconcileInterval = 1 * time.Minute
 )
 
 var log = logging.GetLogger("Goldwarden", "Agent")
@@ -47,10 +54,40 @@ func writeError(c net.Conn, errMsg error) {
 	}
 }
 
-func serveAgentSession(c net.Conn, vault *vault.Vault, cfg *config.Config) {
+func authenticateSession(req messages.SessionAuthRequest, callingContext sockets.CallingContext, cfg *config.Config) messages.SessionAuthResponse {
+	verified := subtle.ConstantTimeCompare([]byte(cfg.ConfigFile.RuntimeConfig.DaemonAuthToken), []byte(req.Token)) == 1
+	log.Info("Verified: %t", verified)
+	if verified {
+		systemauth.CreatePinSession(callingContext, 365*24*time.Hour) // permanent session
+	}
+	return messages.SessionAuthResponse{
+		Verified: verified,
+	}
+}
+
+// serveAgentSession serves a connection to the agent socket, cfg is the config of the default account
+func serveAgentSession(c net.Conn, cfg *config.Config) {
+	// sized like the legacy read buffer, so legacy messages still arrive in a single read
+	reader := bufio.NewReaderSize(c, 1024*1024)
+	firstByte, err := reader.Peek(1)
+	if err != nil {
+		c.Close()
+		return
+	}
+
+	if ipc.IsLegacyMessage(firstByte[0]) {
+		// the legacy protocol has no way to select an account
+		defaultAccount, _ := accounts.Get(accounts.DefaultAccount)
+		serveLegacyAgentSession(c, reader, defaultAccount.Vault, cfg)
+	} else {
+		serveFramedAgentSession(c, reader, cfg)
+	}
+}
+
+func serveLegacyAgentSession(c net.Conn, reader io.Reader, vault *vault.Vault, cfg *config.Config) {
 	for {
 		buf := make([]byte, 1024*1024)
-		nr, err := c.Read(buf)
+		nr, err := reader.Read(buf)
 		if err != nil {
 			return
 		}
@@ -71,16 +108,7 @@ func serveAgentSession(c net.Conn, vault *vault.Vault, cfg *config.Config) {
 			}
 
 			req := messages.ParsePayload(msg).(messages.SessionAuthRequest)
-			verified := subtle.ConstantTimeCompare([]byte(cfg.ConfigFile.RuntimeConfig.DaemonAuthToken), []byte(req.Token)) == 1
-
-			payload := messages.SessionAuthResponse{
-				Verified: verified,
-			}
-			log.Info("Verified: %t", verified)
-			callingContext := sockets.GetCallingContext(c)
-			if verified {
-				systemauth.CreatePinSession(callingContext, 365*24*time.Hour) // permanent session
-			}
+			payload := authenticateSession(req, sockets.GetCallingContext(c), cfg)
 
 			responsePayload, err := messages.IPCMessageFromPayload(payload)
 			if err != nil {
@@ -145,7 +173,7 @@ func serveAgentSession(c net.Conn, vault *vault.Vault, cfg *config.Config) {
 				},
 			}
 
-			pinentrySetError := pinentry.SetExternalPinentry(pe)
+			pinentrySetError := pinentry.SetExternalPinentry(&pe)
 			payload := messages.PinentryRegistrationResponse{
 				Success: pinentrySetError == nil,
 			}
@@ -202,7 +230,7 @@ func serveAgentSession(c net.Conn, vault *vault.Vault, cfg *config.Config) {
 					}
 
 					buf := make([]byte, 1024*1024)
-					nr, err := c.Read(buf)
+					nr, err := reader.Read(buf)
 					if err != nil {
 						return
 					}
@@ -246,7 +274,7 @@ func serveAgentSession(c net.Conn, vault *vault.Vault, cfg *config.Config) {
 					}
 
 					buf := make([]byte, 1024*1024)
-					nr, err := c.Read(buf)
+					nr, err := reader.Read(buf)
 					if err != nil {
 						return
 					}
@@ -273,7 +301,12 @@ func serveAgentSession(c net.Conn, vault *vault.Vault, cfg *config.Config) {
 
 		var responseBytes []byte
 		if action, actionFound := actions.AgentActionsRegistry.Get(msg.Type); actionFound {
+			if err := messages.ValidatePayload(msg); err != nil {
+				writeError(c, err)
+				continue
+			}
 			callingContext := sockets.GetCallingContext(c)
+			callingContext.ApprovedPolicyRules = map[int]bool{}
 			payload, err := action(msg, cfg, vault, &callingContext)
 			if err != nil {
 				writeError(c, err)
@@ -307,9 +340,7 @@ func serveAgentSession(c net.Conn, vault *vault.Vault, cfg *config.Config) {
 type AgentState struct {
 }
 
-func StartUnixAgent(path string, runtimeConfig config.RuntimeConfig) error {
-	ctx := context.Background()
-
+func newVault(runtimeConfig config.RuntimeConfig) *vault.Vault {
 	var keyring crypto.Keyring
 	if runtimeConfig.UseMemguard {
 		keyring = crypto.NewMemguardKeyring(nil)
@@ -317,7 +348,174 @@ func StartUnixAgent(path string, runtimeConfig config.RuntimeConfig) error {
 		keyring = crypto.NewMemoryKeyring(nil)
 	}
 
-	var vault = vault.NewVault(&keyring)
+	return vault.NewVault(&keyring)
+}
+
+// sleep waits for the given duration and returns false if the context ends first
+func sleep(ctx context.Context, duration time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(duration):
+		return true
+	}
+}
+
+func fullSyncWithUserKey(ctx context.Context, account *accounts.Account) error {
+	cfg := account.Config
+	userSymmetricKey, err := cfg.GetUserSymmetricKey()
+	if err != nil {
+		return err
+	}
+	var protectedUserSymmetricKey crypto.SymmetricEncryptionKey
+	if account.Vault.Keyring.IsMemguard {
+		protectedUserSymmetricKey, err = crypto.MemguardSymmetricEncryptionKeyFromBytes(userSymmetricKey)
+	} else {
+		protectedUserSymmetricKey, err = crypto.MemorySymmetricEncryptionKeyFromBytes(userSymmetricKey)
+	}
+	if err != nil {
+		return fmt.Errorf("could not get encryption key from bytes: %s", err.Error())
+	}
+
+	return bitwarden.DoFullSync(bitwarden.WithAuthentication(ctx, cfg), account.Vault, cfg, &protectedUserSymmetricKey, true)
+}
+
+// initialSync syncs an account whose config is not protected by a pin, retrying every minute until successful.
+func initialSync(account *accounts.Account) {
+	cfg := account.Config
+	if cfg.IsLocked() {
+		return
+	}
+
+	log.Warn("Config of account %s is not locked. SET A PIN!!", account.Name)
+	token, err := cfg.GetToken()
+	if err != nil || token.AccessToken == "" {
+		return
+	}
+
+	for {
+		err := fullSyncWithUserKey(account.Context, account)
+		if err == nil {
+			return
+		}
+
+		log.Error("Could not sync: %s", err.Error())
+		notify.Notify("Goldwarden", "Could not perform initial sync", "", 0, func() {})
+		if !sleep(account.Context, 60*time.Second) {
+			return
+		}
+	}
+}
+
+// unlockAccount asks for the pin of a locked account and syncs it
+func unlockAccount(account *accounts.Account) bool {
+	cfg := account.Config
+	err := cfg.TryUnlock(account.Vault)
+	if err != nil {
+		log.Warn("Could not unlock: %s", err.Error())
+		return false
+	}
+
+	token, err := cfg.GetToken()
+	if err != nil {
+		log.Error("Could not get token: %s", err.Error())
+		return true
+	}
+	if token.AccessToken == "" {
+		log.Warn("Access token is empty")
+		return true
+	}
+
+	if _, err := bitwarden.TokenManagerFor(cfg).GetValidToken(account.Context); err != nil {
+		log.Warn("Could not refresh token, the vault cache will be used if the server is unreachable")
+	}
+	err = fullSyncWithUserKey(account.Context, account)
+	if err != nil {
+		log.Error("Could not sync: %s", err.Error())
+		notify.Notify("Goldwarden", "Could not perform initial sync on ssh unlock", "", 0, func() {})
+	}
+	return true
+}
+
+func lockAllAccounts() {
+	for _, account := range accounts.All() {
+		account.Config.Lock()
+		account.Vault.Clear()
+		account.Vault.Keyring.Lock()
+	}
+	systemauth.WipeSessions()
+}
+
+// setAuditKeyOnUnlock passes the audit key to the audit log whenever the config is unlocked. The key
+// is stored encrypted in the config, so records are only written once it was unlocked.
+func setAuditKeyOnUnlock(cfg *config.Config) {
+	unlocked, unsubscribe := events.Subscribe([]events.Type{events.TypeUnlocked})
+	defer unsubscribe()
+
+	for {
+		if !cfg.IsLocked() {
+			key, err := cfg.AuditKey()
+			if err != nil {
+				log.Warn("Could not get audit key: %s", err.Error())
+			} else {
+				// the key changes when the account was logged out and logged in again
+				audit.SetKey(key)
+			}
+		}
+		if _, ok := <-unlocked; !ok {
+			return
+		}
+	}
+}
+
+// startAccountLoops runs the websocket connection, token refresh and periodic syncs of an account until it is removed.
+func startAccountLoops(account *accounts.Account, runtimeConfig config.RuntimeConfig) {
+	ctx := account.Context
+	cfg := account.Config
+	vault := account.Vault
+
+	if !runtimeConfig.WebsocketDisabled {
+		go bitwarden.RunWebsocketDaemon(ctx, vault, cfg)
+	}
+
+	go bitwarden.TokenManagerFor(cfg).Run(ctx)
+
+	go func() {
+		for sleep(ctx, CacheReconcileInterval) {
+			if cfg.IsLocked() || !vault.IsLoadedFromCache() {
+				continue
+			}
+
+			log.Info("Vault of account %s was loaded from offline cache, trying to reconcile with server...", account.Name)
+			if _, err := bitwarden.TokenManagerFor(cfg).GetValidToken(ctx); err != nil {
+				continue
+			}
+
+			err := bitwarden.DoFullSync(bitwarden.WithAuthentication(ctx, cfg), vault, cfg, nil, false)
+			if err != nil {
+				log.Warn("Could not reconcile offline vault: %s", err.Error())
+				continue
+			}
+			notify.Notify("Goldwarden", "Vault synced with server", "", 10*time.Second, func() {})
+		}
+	}()
+
+	go func() {
+		for sleep(ctx, FullSyncInterval) {
+			if !cfg.IsLocked() {
+				err := bitwarden.DoFullSync(bitwarden.WithAuthentication(ctx, cfg), vault, cfg, nil, false)
+				if err != nil {
+					log.Warn("Could not do full sync: %s", err.Error())
+					continue
+				}
+			}
+		}
+	}()
+}
+
+func StartUnixAgent(path string, runtimeConfig config.RuntimeConfig) error {
+	ctx := context.Background()
+
 	cfg, err := config.ReadConfig(runtimeConfig)
 	if err != nil {
 		log.Warn("Could not read config: %s", err.Error())
@@ -333,47 +531,40 @@ func StartUnixAgent(path string, runtimeConfig config.RuntimeConfig) error {
 		cfg.ConfigFile.DeviceUUID = cfg.ConfigFile.RuntimeConfig.DeviceUUID
 	}
 
-	if !cfg.IsLocked() {
-		log.Warn("Config is not locked. SET A PIN!!")
-		token, err := cfg.GetToken()
-		if err == nil {
-			if token.AccessToken != "" {
-				// attempt to sync every minute until successful
-				for {
-					bitwarden.RefreshToken(ctx, &cfg)
-					token, err := cfg.GetToken()
-					if err != nil {
-						log.Error("Could not get token: %s", err.Error())
-					}
-
-					userSymmetricKey, err := cfg.GetUserSymmetricKey()
-					if err != nil {
-						fmt.Println(err)
-						time.Sleep(60 * time.Second)
-						continue
-					}
-					var protectedUserSymmetricKey crypto.SymmetricEncryptionKey
-					if vault.Keyring.IsMemguard {
-						protectedUserSymmetricKey, err = crypto.MemguardSymmetricEncryptionKeyFromBytes(userSymmetricKey)
-					} else {
-						protectedUserSymmetricKey, err = crypto.MemorySymmetricEncryptionKeyFromBytes(userSymmetricKey)
-					}
-					if err != nil {
-						log.Error("could not get encryption key from bytes: %s", err.Error())
-					}
+	defaultAccount := accounts.NewAccount(ctx, accounts.DefaultAccount, &cfg, newVault(runtimeConfig))
+	accounts.Register(defaultAccount)
+	initialSync(defaultAccount)
 
-					err = bitwarden.DoFullSync(context.WithValue(ctx, bitwarden.AuthToken{}, token.AccessToken), vault, &cfg, &protectedUserSymmetricKey, true)
-					if err != nil {
-						log.Error("Could not sync: %s", err.Error())
-						notify.Notify("Goldwarden", "Could not perform initial sync", "", 0, func() {})
-						time.Sleep(60 * time.Second)
-						continue
-					} else {
-						break
-					}
-				}
-			}
+	for _, name := range cfg.ProfileNames() {
+		profileCfg, err := cfg.OpenProfile(name)
+		if err != nil {
+			log.Warn("Could not open account %s: %s", name, err.Error())
+			continue
 		}
+		account := accounts.NewAccount(ctx, name, profileCfg, newVault(runtimeConfig))
+		accounts.Register(account)
+		go func() {
+			initialSync(account)
+			startAccountLoops(account, runtimeConfig)
+		}()
+	}
+	accounts.SetFactory(func(name string) (*accounts.Account, error) {
+		profileCfg, err := cfg.CreateProfile(name)
+		if err != nil {
+			return nil, err
+		}
+		account := accounts.NewAccount(ctx, name, profileCfg, newVault(runtimeConfig))
+		startAccountLoops(account, runtimeConfig)
+		return account, nil
+	})
+
+	if _, err := policy.Load(cfg.PolicyPath()); err != nil {
+		log.Warn("Could not load policy: %s", err.Error())
+	}
+	audit.Init(cfg.AuditLogPath())
+	go setAuditKeyOnUnlock(&cfg)
+	if err := bitwarden.ConfigureHTTPClient(cfg.HTTPSettings()); err != nil {
+		log.Warn("Could not apply http settings: %s", err.Error())
 	}
 
 	err = processsecurity.DisableDumpable()
@@ -382,23 +573,13 @@ func StartUnixAgent(path string, runtimeConfig config.RuntimeConfig) error {
 	}
 
 	go func() {
-		err = processsecurity.MonitorLocks(func() {
-			cfg.Lock()
-			vault.Clear()
-			vault.Keyring.Lock()
-			systemauth.WipeSessions()
-		})
+		err = processsecurity.MonitorLocks(lockAllAccounts)
 		if err != nil {
 			log.Warn("Could not monitor screensaver: %s", err.Error())
 		}
 	}()
 	go func() {
-		err = processsecurity.MonitorIdle(func() {
-			cfg.Lock()
-			vault.Clear()
-			vault.Keyring.Lock()
-			systemauth.WipeSessions()
-		})
+		err = processsecurity.MonitorIdle(lockAllAccounts)
 		if err != nil {
 			log.Warn("Could not monitor idle: %s", err.Error())
 		}
@@ -410,101 +591,16 @@ func StartUnixAgent(path string, runtimeConfig config.RuntimeConfig) error {
 		}
 	}()
 
-	go func() {
-		if !runtimeConfig.WebsocketDisabled {
-			for {
-				// polling, switch this to signal based later
-				if !cfg.IsLocked() && cfg.IsLoggedIn() {
-					bitwarden.RunWebsocketDaemon(ctx, vault, &cfg)
-					time.Sleep(60 * time.Second)
-				}
-				time.Sleep(1 * time.Second)
-			}
-		}
-	}()
+	startAccountLoops(defaultAccount, runtimeConfig)
 
 	if !runtimeConfig.DisableSSHAgent {
-		vaultAgent := ssh.NewVaultAgent(vault, &cfg, &runtimeConfig)
-		vaultAgent.SetUnlockRequestAction(func() bool {
-			err := cfg.TryUnlock(vault)
-			if err == nil {
-				token, err := cfg.GetToken()
-				if err == nil {
-					if token.AccessToken != "" {
-						gotToken := bitwarden.RefreshToken(ctx, &cfg)
-						if !gotToken {
-							log.Warn("Could not get token")
-							return false
-						} else {
-							token, err = cfg.GetToken()
-							if err != nil {
-								log.Warn("Could not get token: %s", err.Error())
-								return false
-							}
-						}
-						userSymmetricKey, err := cfg.GetUserSymmetricKey()
-						if err != nil {
-							log.Error("Could not get user symmetric key: %s", err.Error())
-						}
-						var protectedUserSymmetricKey crypto.SymmetricEncryptionKey
-						if vault.Keyring.IsMemguard {
-							protectedUserSymmetricKey, err = crypto.MemguardSymmetricEncryptionKeyFromBytes(userSymmetricKey)
-						} else {
-							protectedUserSymmetricKey, err = crypto.MemorySymmetricEncryptionKeyFromBytes(userSymmetricKey)
-						}
-						if err != nil {
-							log.Error("could not get encryption key from bytes: %s", err.Error())
-						}
-
-						err = bitwarden.DoFullSync(context.WithValue(ctx, bitwarden.AuthToken{}, token.AccessToken), vault, &cfg, &protectedUserSymmetricKey, true)
-						if err != nil {
-							log.Error("Could not sync: %s", err.Error())
-							notify.Notify("Goldwarden", "Could not perform initial sync on ssh unlock", "", 0, func() {})
-						}
-					} else {
-						log.Warn("Access token is empty")
-					}
-				} else {
-					log.Error("Could not get token: %s", err.Error())
-				}
-				return true
-			} else {
-				log.Warn("Could not unlock: %s", err.Error())
-			}
-			return false
-		})
+		vaultAgent := ssh.NewVaultAgent(&runtimeConfig)
+		vaultAgent.SetUnlockRequestAction(unlockAccount)
+		vaultAgent.SetLockAction(lockAllAccounts)
 		go vaultAgent.Serve()
+		vaultAgent.ServeProfiles(cfg.SSHAgentProfiles())
 	}
 
-	go func() {
-		for {
-			time.Sleep(TokenRefreshInterval)
-			if !cfg.IsLocked() {
-				bitwarden.RefreshToken(ctx, &cfg)
-			}
-		}
-	}()
-
-	go func() {
-		for {
-			time.Sleep(FullSyncInterval)
-			if !cfg.IsLocked() {
-				bitwarden.RefreshToken(ctx, &cfg)
-				token, err := cfg.GetToken()
-				if err != nil {
-					log.Warn("Could not get token: %s", err.Error())
-					continue
-				}
-
-				err = bitwarden.DoFullSync(context.WithValue(ctx, bitwarden.AuthToken{}, token.AccessToken), vault, &cfg, nil, false)
-				if err != nil {
-					log.Warn("Could not do full sync: %s", err.Error())
-					continue
-				}
-			}
-		}
-	}()
-
 	if _, err := os.Stat(path); err == nil {
 		if err := os.Remove(path); err != nil {
 			return err
@@ -526,7 +622,7 @@ func StartUnixAgent(path string, runtimeConfig config.RuntimeConfig) error {
 				fmt.Println("accept error", err.Error())
 			}
 
-			go serveAgentSession(fd, vault, &cfg)
+			go serveAgentSession(fd, &cfg)
 		}
 	}()
 
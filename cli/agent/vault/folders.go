@@ -0,0 +1,143 @@
+package vault
+
+import (
+	"github.com/quexten/goldwarden/cli/agent/bitwarden/crypto"
+	"github.com/quexten/goldwarden/cli/agent/bitwarden/models"
+)
+
+type Folder struct {
+	ID   string
+	Name string
+}
+
+type Collection struct {
+	ID             string
+	OrganizationID string
+	Name           string
+}
+
+func (vault *Vault) AddOrUpdateFolder(folder models.Folder) {
+	name, err := crypto.DecryptWith(folder.Name, vault.Keyring.GetAccountKey())
+	if err != nil {
+		vaultLog.Error("Failed to decrypt name for folder %s: %s", folder.ID.String(), err.Error())
+		return
+	}
+
+	vault.lockMutex()
+	vault.folders[folder.ID.String()] = Folder{
+		ID:   folder.ID.String(),
+		Name: string(name),
+	}
+	vault.unlockMutex()
+}
+
+func (vault *Vault) DeleteFolder(uuid string) {
+	vault.lockMutex()
+	defer vault.unlockMutex()
+
+	delete(vault.folders, uuid)
+
+	// the server moves the ciphers of a deleted folder to "no folder"
+	for _, ciphers := range []map[string]models.Cipher{vault.logins, vault.secureNotes, vault.sshKeys, vault.cards, vault.identities} {
+		for id, cipher := range ciphers {
+			if cipher.FolderID != nil && cipher.FolderID.String() == uuid {
+				cipher.FolderID = nil
+				ciphers[id] = cipher
+			}
+		}
+	}
+}
+
+func (vault *Vault) AddOrUpdateCollection(collection models.Collection) {
+	key, err := vault.Keyring.GetSymmetricKeyForOrganization(collection.OrganizationID.String())
+	if err != nil {
+		vaultLog.Error("Failed to get key for collection %s: %s", collection.ID.String(), err.Error())
+		return
+	}
+	name, err := crypto.DecryptWith(collection.Name, key)
+	if err != nil {
+		vaultLog.Error("Failed to decrypt name for collection %s: %s", collection.ID.String(), err.Error())
+		return
+	}
+
+	vault.lockMutex()
+	vault.collections[collection.ID.String()] = Collection{
+		ID:             collection.ID.String(),
+		OrganizationID: collection.OrganizationID.String(),
+		Name:           string(name),
+	}
+	vault.unlockMutex()
+}
+
+func (vault *Vault) GetFolders() []Folder {
+	vault.lockMutex()
+	defer vault.unlockMutex()
+
+	folders := make([]Folder, 0, len(vault.folders))
+	for _, folder := range vault.folders {
+		folders = append(folders, folder)
+	}
+	return folders
+}
+
+func (vault *Vault) GetCollections() []Collection {
+	vault.lockMutex()
+	defer vault.unlockMutex()
+
+	collections := make([]Collection, 0, len(vault.collections))
+	for _, collection := range vault.collections {
+		collections = append(collections, collection)
+	}
+	return collections
+}
+
+// MatchesFilter checks whether a cipher is in the given folder and collection, each given either
+// as id or as name. Empty values match every cipher.
+func (vault *Vault) MatchesFilter(cipher models.Cipher, folder string, collection string) bool {
+	vault.lockMutex()
+	defer vault.unlockMutex()
+
+	return vault.matchesFilter(cipher, folder, collection)
+}
+
+func (vault *Vault) matchesFilter(cipher models.Cipher, folderFilter string, collectionFilter string) bool {
+	if folderFilter != "" {
+		if cipher.FolderID == nil {
+			return false
+		}
+		folder, ok := vault.folders[cipher.FolderID.String()]
+		if !ok || (folder.ID != folderFilter && folder.Name != folderFilter) {
+			return false
+		}
+	}
+
+	if collectionFilter != "" {
+		found := false
+		for _, collectionID := range cipher.CollectionIDs {
+			collection, ok := vault.collections[collectionID]
+			if ok && (collection.ID == collectionFilter || collection.Name == collectionFilter) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (vault *Vault) GetFolderName(cipher models.Cipher) string {
+	vault.lockMutex()
+	defer vault.unlockMutex()
+
+	return vault.folderName(cipher)
+}
+
+func (vault *Vault) folderName(cipher models.Cipher) string {
+	if cipher.FolderID == nil {
+		return ""
+	}
+	return vault.folders[cipher.FolderID.String()].Name
+}
@@ -2,10 +2,11 @@ package vault
 
 import (
 	"errors"
-	"strings"
 	"fmt"
 	"regexp"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/quexten/goldwarden/cli/agent/bitwarden/crypto"
 	"github.com/quexten/goldwarden/cli/agent/bitwarden/models"
@@ -20,9 +21,15 @@ type Vault struct {
 	logins             map[string]models.Cipher
 	secureNotes        map[string]models.Cipher
 	sshKeys            map[string]models.Cipher
+	cards              map[string]models.Cipher
+	identities         map[string]models.Cipher
 	sshKeyNoteIDs      []string
-	envCredentials     map[string]string
+	envCredentials     map[string][]string
+	folders            map[string]Folder
+	collections        map[string]Collection
 	lastSynced         int64
+	revisionDate       time.Time
+	loadedFromCache    bool
 	websocketConnected bool
 	mu                 sync.Mutex
 }
@@ -32,9 +39,13 @@ func NewVault(keyring *crypto.Keyring) *Vault {
 		Keyring:            keyring,
 		logins:             make(map[string]models.Cipher),
 		secureNotes:        make(map[string]models.Cipher),
-		sshKeys: 		    make(map[string]models.Cipher),
+		sshKeys:            make(map[string]models.Cipher),
+		cards:              make(map[string]models.Cipher),
+		identities:         make(map[string]models.Cipher),
 		sshKeyNoteIDs:      make([]string, 0),
-		envCredentials:     make(map[string]string),
+		envCredentials:     make(map[string][]string),
+		folders:            make(map[string]Folder),
+		collections:        make(map[string]Collection),
 		lastSynced:         0,
 		websocketConnected: false,
 	}
@@ -52,9 +63,16 @@ func (vault *Vault) Clear() {
 	vault.lockMutex()
 	vault.logins = make(map[string]models.Cipher)
 	vault.secureNotes = make(map[string]models.Cipher)
+	vault.sshKeys = make(map[string]models.Cipher)
+	vault.cards = make(map[string]models.Cipher)
+	vault.identities = make(map[string]models.Cipher)
 	vault.sshKeyNoteIDs = make([]string, 0)
-	vault.envCredentials = make(map[string]string)
+	vault.envCredentials = make(map[string][]string)
+	vault.folders = make(map[string]Folder)
+	vault.collections = make(map[string]Collection)
 	vault.lastSynced = 0
+	vault.revisionDate = time.Time{}
+	vault.loadedFromCache = false
 	vault.unlockMutex()
 }
 
@@ -67,39 +85,89 @@ func (vault *Vault) AddOrUpdateLogin(cipher models.Cipher) {
 func (vault *Vault) DeleteCipher(uuid string) {
 	vault.lockMutex()
 	delete(vault.logins, uuid)
-	delete(vault.envCredentials, uuid)
+	delete(vault.secureNotes, uuid)
+	delete(vault.sshKeys, uuid)
+	delete(vault.cards, uuid)
+	delete(vault.identities, uuid)
+	vault.removeEnvCredential(uuid)
 
-	newSecureNotes := make(map[string]models.Cipher)
+	newSSHKeyNoteIDs := make([]string, 0)
 	for _, noteID := range vault.sshKeyNoteIDs {
 		if noteID != uuid {
-			newSecureNotes[noteID] = vault.secureNotes[noteID]
+			newSSHKeyNoteIDs = append(newSSHKeyNoteIDs, noteID)
 		}
 	}
-	vault.secureNotes = newSecureNotes
+	vault.sshKeyNoteIDs = newSSHKeyNoteIDs
 	vault.unlockMutex()
 }
 
+func (vault *Vault) AddOrUpdateCipher(cipher models.Cipher) {
+	switch cipher.Type {
+	case models.CipherLogin:
+		vault.AddOrUpdateLogin(cipher)
+	case models.CipherNote:
+		vault.AddOrUpdateSecureNote(cipher)
+	case models.CipherSSHKey:
+		vault.AddOrUpdateSSHKey(cipher)
+	case models.CipherCard:
+		vault.AddOrUpdateCard(cipher)
+	case models.CipherIdentity:
+		vault.AddOrUpdateIdentity(cipher)
+	default:
+		vaultLog.Warn("Unknown cipher type %d for cipher %s", cipher.Type, cipher.ID.String())
+	}
+}
+
 func (vault *Vault) AddOrUpdateSecureNote(cipher models.Cipher) {
 	vault.lockMutex()
 	vault.secureNotes[cipher.ID.String()] = cipher
 
+	vault.removeEnvCredential(cipher.ID.String())
 	if vault.isSSHKey(cipher) {
 		if !slices.Contains(vault.sshKeyNoteIDs, cipher.ID.String()) {
 			vault.sshKeyNoteIDs = append(vault.sshKeyNoteIDs, cipher.ID.String())
 		}
 	} else if executableName, isEnv := vault.isEnv(cipher); isEnv {
-		vault.envCredentials[executableName] = cipher.ID.String()
+		vault.envCredentials[executableName] = append(vault.envCredentials[executableName], cipher.ID.String())
 	}
 
 	vault.unlockMutex()
 }
 
+func (vault *Vault) removeEnvCredential(uuid string) {
+	for executableName, ids := range vault.envCredentials {
+		newIDs := make([]string, 0)
+		for _, id := range ids {
+			if id != uuid {
+				newIDs = append(newIDs, id)
+			}
+		}
+		if len(newIDs) == 0 {
+			delete(vault.envCredentials, executableName)
+		} else {
+			vault.envCredentials[executableName] = newIDs
+		}
+	}
+}
+
 func (vault *Vault) AddOrUpdateSSHKey(cipher models.Cipher) {
 	vault.lockMutex()
 	vault.sshKeys[cipher.ID.String()] = cipher
 	vault.unlockMutex()
 }
 
+func (vault *Vault) AddOrUpdateCard(cipher models.Cipher) {
+	vault.lockMutex()
+	vault.cards[cipher.ID.String()] = cipher
+	vault.unlockMutex()
+}
+
+func (vault *Vault) AddOrUpdateIdentity(cipher models.Cipher) {
+	vault.lockMutex()
+	vault.identities[cipher.ID.String()] = cipher
+	vault.unlockMutex()
+}
+
 func (vault *Vault) isEnv(cipher models.Cipher) (string, bool) {
 	if cipher.Type != models.CipherNote {
 		return "", false
@@ -179,9 +247,58 @@ func (vault *Vault) isSSHKey(cipher models.Cipher) bool {
 }
 
 type SSHKey struct {
-	Name      string
-	Key       string
-	PublicKey string
+	ID          string
+	Name        string
+	Key         string
+	PublicKey   string
+	Certificate string
+	Folder      string
+	// hosts and users the key may be used for, unrestricted if empty
+	AllowedHosts []string
+	AllowedUsers []string
+	// principals for git signature verification, the name is used if empty
+	GitEmails []string
+	// custom fields by name, without the private key
+	Fields map[string]string
+}
+
+var sshKeyListFields = []string{"allowed-hosts", "allowed-users", "git-email"}
+
+// readSSHKeyListFields reads the comma separated allowed-hosts, allowed-users and git-email fields of an ssh key.
+func readSSHKeyListFields(cipher models.Cipher, key crypto.SymmetricEncryptionKey) map[string][]string {
+	values := make(map[string][]string)
+	for _, field := range cipher.Fields {
+		fieldName, err := crypto.DecryptWith(field.Name, key)
+		if err != nil || !slices.Contains(sshKeyListFields, string(fieldName)) {
+			continue
+		}
+		fieldValue, err := crypto.DecryptWith(field.Value, key)
+		if err != nil {
+			continue
+		}
+
+		values[string(fieldName)] = append(values[string(fieldName)], strings.FieldsFunc(string(fieldValue), func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\n'
+		})...)
+	}
+	return values
+}
+
+// readSSHKeyFields reads the custom fields of an ssh key, used to select keys for agent profiles.
+func readSSHKeyFields(cipher models.Cipher, key crypto.SymmetricEncryptionKey) map[string]string {
+	values := make(map[string]string)
+	for _, field := range cipher.Fields {
+		fieldName, err := crypto.DecryptWith(field.Name, key)
+		if err != nil || string(fieldName) == "private-key" {
+			continue
+		}
+		fieldValue, err := crypto.DecryptWith(field.Value, key)
+		if err != nil {
+			continue
+		}
+		values[string(fieldName)] = string(fieldValue)
+	}
+	return values
 }
 
 func extractKeyMarker(text, pattern string) (string, string, error) {
@@ -198,20 +315,29 @@ func extractKeyMarker(text, pattern string) (string, string, error) {
 			// end marker
 			return extracted, text[:match[0]], nil
 		}
-		return "", text, fmt.Errorf("Token found is neither at the beginning nor end: pattern: %s. match idx: %s", pattern, match)
+		return "", text, fmt.Errorf("Token found is neither at the beginning nor end: pattern: %s. match idx: %v", pattern, match)
 	}
 
 	return "", text, fmt.Errorf("No match found in pattern %s", pattern)
 }
 
 func (vault *Vault) GetSSHKeys() []SSHKey {
+	return vault.GetSSHKeysWithFilter("", "")
+}
+
+func (vault *Vault) GetSSHKeysWithFilter(folder string, collection string) []SSHKey {
 	vault.lockMutex()
 	defer vault.unlockMutex()
 
 	var sshKeys []SSHKey
 	for _, id := range vault.sshKeyNoteIDs {
+		if !vault.matchesFilter(vault.secureNotes[id], folder, collection) {
+			continue
+		}
+
 		privateKey := ""
 		publicKey := ""
+		certificate := ""
 
 		key, err := vault.secureNotes[id].GetKeyForCipher(*vault.Keyring)
 		if err != nil {
@@ -239,16 +365,24 @@ func (vault *Vault) GetSSHKeys() []SSHKey {
 					publicKey = string(pk)
 				}
 			}
+			if string(fieldName) == "certificate" {
+				cert, err := crypto.DecryptWith(field.Value, key)
+				if err != nil {
+					continue
+				} else {
+					certificate = string(cert)
+				}
+			}
 		}
 
 		beginMarker, privateKey, err := extractKeyMarker(privateKey, `-----\w*BEGIN [a-zA-Z ]+\w*-----`)
 		if err != nil {
-			vaultLog.Error("Failed for note %s: %s", vault.secureNotes[id].Name, err.Error())
+			vaultLog.Error("Failed for note %s: %s", id, err.Error())
 			continue
 		}
 		endMarker, privateKey, err := extractKeyMarker(privateKey, `-----\w*END [a-zA-Z ]+\w*-----`)
 		if err != nil {
-			vaultLog.Error("Failed for note %s: %s", vault.secureNotes[id].Name, err.Error())
+			vaultLog.Error("Failed for note %s: %s", id, err.Error())
 			continue
 		}
 
@@ -259,41 +393,69 @@ func (vault *Vault) GetSSHKeys() []SSHKey {
 		if err != nil {
 			continue
 		}
+		listFields := readSSHKeyListFields(vault.secureNotes[id], key)
 
 		sshKeys = append(sshKeys, SSHKey{
-			Name:      string(decryptedTitle),
-			Key:       string(privateKeyString),
-			PublicKey: string(publicKey),
+			ID:           id,
+			Name:         string(decryptedTitle),
+			Key:          string(privateKeyString),
+			PublicKey:    string(publicKey),
+			Certificate:  certificate,
+			Folder:       vault.folderName(vault.secureNotes[id]),
+			AllowedHosts: listFields["allowed-hosts"],
+			AllowedUsers: listFields["allowed-users"],
+			GitEmails:    listFields["git-email"],
+			Fields:       readSSHKeyFields(vault.secureNotes[id], key),
 		})
 	}
 
-	for id, _ := range vault.sshKeys {
+	for id := range vault.sshKeys {
+		if !vault.matchesFilter(vault.sshKeys[id], folder, collection) {
+			continue
+		}
+
 		key, _ := vault.sshKeys[id].GetKeyForCipher(*vault.Keyring)
 		privKey, _ := crypto.DecryptWith(vault.sshKeys[id].SSHKey.PrivateKey, key)
 		pubKey, _ := crypto.DecryptWith(vault.sshKeys[id].SSHKey.PublicKey, key)
 		name, _ := crypto.DecryptWith(vault.sshKeys[id].Name, key)
+		var certificate []byte
+		if vault.sshKeys[id].SSHKey.Certificate != nil {
+			certificate, _ = crypto.DecryptWith(*vault.sshKeys[id].SSHKey.Certificate, key)
+		}
+		listFields := readSSHKeyListFields(vault.sshKeys[id], key)
 
 		sshKeys = append(sshKeys, SSHKey{
-			Name:      string(name),
-			Key:       string(privKey),
-			PublicKey: string(pubKey),
+			ID:           id,
+			Name:         string(name),
+			Key:          string(privKey),
+			PublicKey:    string(pubKey),
+			Certificate:  string(certificate),
+			Folder:       vault.folderName(vault.sshKeys[id]),
+			AllowedHosts: listFields["allowed-hosts"],
+			AllowedUsers: listFields["allowed-users"],
+			GitEmails:    listFields["git-email"],
+			Fields:       readSSHKeyFields(vault.sshKeys[id], key),
 		})
 	}
 
 	return sshKeys
 }
 
-func (vault *Vault) GetEnvCredentialForExecutable(executableName string) (map[string]string, bool) {
+func (vault *Vault) GetEnvCredentialForExecutable(executableName string, folder string, collection string) (map[string]string, string, bool) {
 	vault.lockMutex()
 	defer vault.unlockMutex()
 
 	env := make(map[string]string)
 
-	if id, ok := vault.envCredentials[executableName]; ok {
+	for _, id := range vault.envCredentials[executableName] {
+		if !vault.matchesFilter(vault.secureNotes[id], folder, collection) {
+			continue
+		}
+
 		key, err := vault.secureNotes[id].GetKeyForCipher(*vault.Keyring)
 		if err != nil {
 			vaultLog.Error("Failed to get key for cipher " + id)
-			return make(map[string]string), false
+			return make(map[string]string), id, false
 		}
 
 		for _, field := range vault.secureNotes[id].Fields {
@@ -312,9 +474,9 @@ func (vault *Vault) GetEnvCredentialForExecutable(executableName string) (map[st
 
 			env[string(fieldName)] = string(fieldValue)
 		}
-		return env, true
+		return env, id, true
 	}
-	return make(map[string]string), false
+	return make(map[string]string), "", false
 }
 
 func (vault *Vault) GetLogins() []models.Cipher {
@@ -351,6 +513,113 @@ func (vault *Vault) GetNotes() []models.Cipher {
 	return notes
 }
 
+func (vault *Vault) GetCards() []models.Cipher {
+	vault.lockMutex()
+	defer vault.unlockMutex()
+
+	var cards []models.Cipher
+	for _, cipher := range vault.cards {
+		if !cipher.DeletedDate.IsZero() {
+			continue
+		}
+		cards = append(cards, cipher)
+	}
+	return cards
+}
+
+func (vault *Vault) GetIdentities() []models.Cipher {
+	vault.lockMutex()
+	defer vault.unlockMutex()
+
+	var identities []models.Cipher
+	for _, cipher := range vault.identities {
+		if !cipher.DeletedDate.IsZero() {
+			continue
+		}
+		identities = append(identities, cipher)
+	}
+	return identities
+}
+
+func (vault *Vault) GetSSHKeyCiphers() []models.Cipher {
+	vault.lockMutex()
+	defer vault.unlockMutex()
+
+	var sshKeys []models.Cipher
+	for _, cipher := range vault.sshKeys {
+		if !cipher.DeletedDate.IsZero() {
+			continue
+		}
+		sshKeys = append(sshKeys, cipher)
+	}
+	for _, id := range vault.sshKeyNoteIDs {
+		sshKeys = append(sshKeys, vault.secureNotes[id])
+	}
+	return sshKeys
+}
+
+func (vault *Vault) GetSSHKeyCipherByFilter(uuid string, name string) (models.Cipher, error) {
+	vault.lockMutex()
+	defer vault.unlockMutex()
+
+	ciphers := make(map[string]models.Cipher)
+	for id, cipher := range vault.sshKeys {
+		ciphers[id] = cipher
+	}
+	for _, id := range vault.sshKeyNoteIDs {
+		ciphers[id] = vault.secureNotes[id]
+	}
+	return vault.getCipherByFilter(ciphers, uuid, "", name)
+}
+
+func (vault *Vault) GetCardByFilter(uuid string, orgId string, name string) (models.Cipher, error) {
+	vault.lockMutex()
+	defer vault.unlockMutex()
+
+	return vault.getCipherByFilter(vault.cards, uuid, orgId, name)
+}
+
+func (vault *Vault) GetIdentityByFilter(uuid string, orgId string, name string) (models.Cipher, error) {
+	vault.lockMutex()
+	defer vault.unlockMutex()
+
+	return vault.getCipherByFilter(vault.identities, uuid, orgId, name)
+}
+
+func (vault *Vault) getCipherByFilter(ciphers map[string]models.Cipher, uuid string, orgId string, name string) (models.Cipher, error) {
+	for _, cipher := range ciphers {
+		if !cipher.DeletedDate.IsZero() {
+			continue
+		}
+		if uuid != "" && cipher.ID.String() != uuid {
+			continue
+		}
+		if orgId != "" && (cipher.OrganizationID == nil || cipher.OrganizationID.String() != orgId) {
+			continue
+		}
+
+		if name != "" {
+			key, err := cipher.GetKeyForCipher(*vault.Keyring)
+			if err != nil {
+				vaultLog.Error("Failed to get key for cipher " + cipher.ID.String())
+				continue
+			}
+			decryptedName, err := crypto.DecryptWith(cipher.Name, key)
+			if err != nil {
+				vaultLog.Error("Failed to decrypt name for cipher " + cipher.ID.String())
+				continue
+			}
+			if string(decryptedName) != name {
+				continue
+			}
+		}
+
+		return cipher, nil
+	}
+
+	return models.Cipher{}, errors.New("cipher not found")
+}
+
 func (vault *Vault) GetLoginByFilter(uuid string, orgId string, name string, username string) (models.Cipher, error) {
 	vault.lockMutex()
 	defer vault.unlockMutex()
@@ -474,6 +743,36 @@ func (vault *Vault) GetLastSynced() int64 {
 	return vault.lastSynced
 }
 
+// SetRevisionDate records the server revision date the vault contents were fully synced at
+func (vault *Vault) SetRevisionDate(revisionDate time.Time) {
+	vault.lockMutex()
+	vault.revisionDate = revisionDate
+	vault.unlockMutex()
+}
+
+// GetRevisionDate returns the server revision date of the last full sync, or the zero time if it is not known
+func (vault *Vault) GetRevisionDate() time.Time {
+	vault.lockMutex()
+	defer vault.unlockMutex()
+
+	return vault.revisionDate
+}
+
+func (vault *Vault) SetLoadedFromCache(loadedFromCache bool) {
+	vault.lockMutex()
+	vault.loadedFromCache = loadedFromCache
+	vault.unlockMutex()
+}
+
+// IsLoadedFromCache reports whether the vault contents come from the offline
+// cache and still need to be reconciled with the server.
+func (vault *Vault) IsLoadedFromCache() bool {
+	vault.lockMutex()
+	defer vault.unlockMutex()
+
+	return vault.loadedFromCache
+}
+
 func (vault *Vault) SetWebsocketConnected(connected bool) {
 	vault.lockMutex()
 	vault.websocketConnected = connected
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/quexten/goldwarden/cli/ipc"
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+)
+
+const handshakeTimeout = 5 * time.Second
+
+var errLegacyAgent = errors.New("agent only supports the legacy protocol")
+
+type framedConnection struct {
+	conn    net.Conn
+	account string
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	nextID   uint64
+	pending  map[uint64]chan ipc.Frame
+	err      error
+	requests chan ipc.Frame
+	// agent request last returned by readRequest, answered by the next writeMessage
+	replyID  uint64
+	hasReply bool
+}
+
+func handshake(c net.Conn, account string) (*framedConnection, error) {
+	if err := c.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return nil, err
+	}
+
+	frame, err := ipc.RequestFrame(1, messages.ProtocolHandshakeRequest{Version: ipc.ProtocolVersion})
+	if err != nil {
+		return nil, err
+	}
+	if err := ipc.WriteFrame(c, frame); err != nil {
+		return nil, err
+	}
+
+	// legacy agents answer the unparseable frame with a bare json error
+	reader := bufio.NewReader(c)
+	firstByte, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if ipc.IsLegacyMessage(firstByte[0]) {
+		return nil, errLegacyAgent
+	}
+
+	reply, err := ipc.ReadFrame(reader)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Error != nil {
+		if reply.Error.Code == messages.ErrorCodeUnsupportedVersion {
+			return nil, errLegacyAgent
+		}
+		return nil, reply.Error
+	}
+	payload, err := reply.Payload()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := payload.(messages.ProtocolHandshakeResponse); !ok {
+		return nil, errors.New("invalid handshake response")
+	}
+
+	if err := c.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+
+	framed := &framedConnection{
+		conn:     c,
+		account:  account,
+		nextID:   1,
+		pending:  make(map[uint64]chan ipc.Frame),
+		requests: make(chan ipc.Frame, 16),
+	}
+	go framed.readLoop(reader)
+	return framed, nil
+}
+
+func (framed *framedConnection) readLoop(reader io.Reader) {
+	for {
+		frame, err := ipc.ReadFrame(reader)
+		if err != nil {
+			framed.mu.Lock()
+			framed.err = err
+			for id, replyChan := range framed.pending {
+				close(replyChan)
+				delete(framed.pending, id)
+			}
+			framed.mu.Unlock()
+			close(framed.requests)
+			return
+		}
+
+		if !frame.Reply {
+			framed.requests <- frame
+			continue
+		}
+
+		framed.mu.Lock()
+		replyChan, ok := framed.pending[frame.ID]
+		delete(framed.pending, frame.ID)
+		framed.mu.Unlock()
+		if ok {
+			replyChan <- frame
+		}
+	}
+}
+
+func (framed *framedConnection) send(payload interface{}, replyChan chan ipc.Frame) error {
+	framed.mu.Lock()
+	if framed.err != nil {
+		err := framed.err
+		framed.mu.Unlock()
+		return err
+	}
+	framed.nextID++
+	id := framed.nextID
+	if replyChan != nil {
+		framed.pending[id] = replyChan
+	}
+	framed.mu.Unlock()
+
+	frame, err := ipc.RequestFrame(id, payload)
+	if err == nil {
+		frame.Account = framed.account
+		err = framed.write(frame)
+	}
+	if err != nil {
+		framed.mu.Lock()
+		delete(framed.pending, id)
+		framed.mu.Unlock()
+	}
+	return err
+}
+
+func (framed *framedConnection) write(frame ipc.Frame) error {
+	framed.writeMu.Lock()
+	defer framed.writeMu.Unlock()
+
+	return ipc.WriteFrame(framed.conn, frame)
+}
+
+func (framed *framedConnection) roundTrip(request interface{}) (interface{}, error) {
+	replyChan := make(chan ipc.Frame, 1)
+	if err := framed.send(request, replyChan); err != nil {
+		return nil, err
+	}
+
+	reply, ok := <-replyChan
+	if !ok {
+		framed.mu.Lock()
+		err := framed.err
+		framed.mu.Unlock()
+		return nil, err
+	}
+	return reply.Payload()
+}
+
+func (framed *framedConnection) readRequest() interface{} {
+	frame, ok := <-framed.requests
+	if !ok || frame.Message == nil {
+		return nil
+	}
+
+	framed.mu.Lock()
+	framed.replyID = frame.ID
+	framed.hasReply = true
+	framed.mu.Unlock()
+	return messages.ParsePayload(*frame.Message)
+}
+
+func (framed *framedConnection) writeMessage(payload interface{}) error {
+	framed.mu.Lock()
+	replyID, hasReply := framed.replyID, framed.hasReply
+	framed.hasReply = false
+	framed.mu.Unlock()
+
+	if !hasReply {
+		return framed.send(payload, nil)
+	}
+
+	message, err := messages.IPCMessageFromPayload(payload)
+	if err != nil {
+		return err
+	}
+	return framed.write(ipc.ReplyFrame(replyID, message))
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net"
 	"os"
@@ -16,8 +17,12 @@ type UnixSocketClient struct {
 	runtimeConfig *config.RuntimeConfig
 }
 
+// UnixSocketConnection can be used from several goroutines at once when the agent speaks the
+// framed protocol.
 type UnixSocketConnection struct {
 	conn net.Conn
+	// nil when talking to an agent that only knows the legacy protocol
+	framed *framedConnection
 }
 
 func NewUnixSocketClient(runtimeConfig *config.RuntimeConfig) UnixSocketClient {
@@ -73,7 +78,30 @@ func (client UnixSocketClient) Connect() (UnixSocketConnection, error) {
 		}
 	}
 
-	c, err := net.Dial("unix", client.runtimeConfig.GoldwardenSocketPath)
+	return connect(client.runtimeConfig.GoldwardenSocketPath, client.runtimeConfig.Account)
+}
+
+// connect negotiates the framed protocol and falls back to the legacy protocol for older agents,
+// which only serve the default account.
+func connect(socketPath string, account string) (UnixSocketConnection, error) {
+	c, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return UnixSocketConnection{}, err
+	}
+
+	framed, err := handshake(c, account)
+	if err == nil {
+		return UnixSocketConnection{conn: c, framed: framed}, nil
+	}
+	c.Close()
+	if !errors.Is(err, errLegacyAgent) {
+		return UnixSocketConnection{}, err
+	}
+
+	if account != "" {
+		return UnixSocketConnection{}, errors.New("the running daemon does not support accounts")
+	}
+	c, err = net.Dial("unix", socketPath)
 	if err != nil {
 		return UnixSocketConnection{}, err
 	}
@@ -81,6 +109,10 @@ func (client UnixSocketClient) Connect() (UnixSocketConnection, error) {
 }
 
 func (conn UnixSocketConnection) SendCommand(request interface{}) (interface{}, error) {
+	if conn.framed != nil {
+		return conn.framed.roundTrip(request)
+	}
+
 	err := conn.WriteMessage(request)
 	if err != nil {
 		return nil, err
@@ -88,13 +120,24 @@ func (conn UnixSocketConnection) SendCommand(request interface{}) (interface{},
 	return conn.ReadMessage(), nil
 }
 
+// ReadMessage reads the next message sent by the agent on its own, like a pinentry prompt.
 func (conn UnixSocketConnection) ReadMessage() interface{} {
+	if conn.framed != nil {
+		return conn.framed.readRequest()
+	}
+
 	result := Reader(conn.conn)
 	payload := messages.ParsePayload(result.(messages.IPCMessage))
 	return payload
 }
 
+// WriteMessage answers the message last returned by ReadMessage, or sends a new message
+// without waiting for its response.
 func (conn UnixSocketConnection) WriteMessage(message interface{}) error {
+	if conn.framed != nil {
+		return conn.framed.writeMessage(message)
+	}
+
 	messagePacket, err := messages.IPCMessageFromPayload(message)
 	if err != nil {
 		panic(err)
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+	"github.com/spf13/cobra"
+)
+
+var accountCmd = &cobra.Command{
+	Use:   "account",
+	Short: "Manage accounts",
+	Long: `Manage the accounts of the daemon.
+	Each account has its own login, pin, vault and server urls. Other commands select an account with --account.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var listAccountsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists all accounts",
+	Long:  `Lists all accounts.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commandClient.SendToAgent(messages.ListAccountsRequest{})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch result.(type) {
+		case messages.ListAccountsResponse:
+			output := []map[string]interface{}{}
+			for _, account := range result.(messages.ListAccountsResponse).Accounts {
+				output = append(output, map[string]interface{}{
+					"name":     account.Name,
+					"loggedIn": account.LoggedIn,
+					"locked":   account.Locked,
+					"apiUrl":   account.ApiUrl,
+				})
+			}
+			outputJSON, _ := json.Marshal(output)
+			fmt.Println(string(outputJSON))
+		case messages.ActionResponse:
+			fmt.Println("Error: " + result.(messages.ActionResponse).Message)
+		default:
+			fmt.Println("Wrong response type")
+		}
+	},
+}
+
+var addAccountCmd = &cobra.Command{
+	Use:   "add [name]",
+	Short: "Adds an account",
+	Long:  `Adds an account. Configure its server with "config set-server --account [name]" and log in with "vault login --account [name]".`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commandClient.SendToAgent(messages.AddAccountRequest{Name: args[0]})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+		printActionResponse(result)
+	},
+}
+
+var removeAccountCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Removes an account",
+	Long:  `Removes an account, its stored credentials and its offline vault cache.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commandClient.SendToAgent(messages.RemoveAccountRequest{Name: args[0]})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+		printActionResponse(result)
+	},
+}
+
+func printActionResponse(result interface{}) {
+	switch result.(type) {
+	case messages.ActionResponse:
+		response := result.(messages.ActionResponse)
+		if response.Success {
+			fmt.Println(response.Message)
+		} else {
+			fmt.Println("Error: " + response.Message)
+		}
+	default:
+		fmt.Println("Wrong response type")
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(accountCmd)
+	accountCmd.AddCommand(listAccountsCmd)
+	accountCmd.AddCommand(addAccountCmd)
+	accountCmd.AddCommand(removeAccountCmd)
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+	"github.com/spf13/cobra"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect the audit log",
+	Long: `Inspect the audit log.
+	The agent records every credential access and signing operation in a hash-chained log next to the config file.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var listAuditCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists audit records, newest first",
+	Long:  `Lists audit records, newest first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		action, _ := cmd.Flags().GetString("action")
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		result, err := commandClient.SendToAgent(messages.ListAuditLogRequest{
+			Action: action,
+			Limit:  limit,
+		})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch result.(type) {
+		case messages.ListAuditLogResponse:
+			records := make([]map[string]interface{}, 0)
+			for _, record := range result.(messages.ListAuditLogResponse).Records {
+				records = append(records, map[string]interface{}{
+					"sequence": record.Sequence,
+					"time":     time.Unix(record.Time, 0).String(),
+					"action":   record.Action,
+					"cipherId": record.CipherID,
+					"detail":   record.Detail,
+					"decision": record.Decision,
+					"method":   record.Method,
+					"user":     record.UserName,
+					"process":  fmt.Sprintf("%s>%s>%s", record.GrandParentProcessName, record.ParentProcessName, record.ProcessName),
+					"path":     record.ProcessPath,
+					"pid":      record.ProcessPid,
+				})
+			}
+			recordsJSON, _ := json.Marshal(records)
+			fmt.Println(string(recordsJSON))
+		case messages.ActionResponse:
+			fmt.Println("Error: " + result.(messages.ActionResponse).Message)
+		default:
+			fmt.Println("Wrong response type")
+		}
+	},
+}
+
+var verifyAuditCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verifies the hash chain of the audit log",
+	Long:  `Verifies the hash chain of the audit log, detecting modified, removed and truncated records.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commandClient.SendToAgent(messages.VerifyAuditLogRequest{})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch result.(type) {
+		case messages.VerifyAuditLogResponse:
+			response := result.(messages.VerifyAuditLogResponse)
+			if response.Valid {
+				fmt.Printf("Audit log valid, %d records\n", response.Records)
+			} else {
+				fmt.Printf("Audit log INVALID (%d records read): %s\n", response.Records, response.Message)
+				os.Exit(1)
+			}
+		case messages.ActionResponse:
+			fmt.Println("Error: " + result.(messages.ActionResponse).Message)
+		default:
+			fmt.Println("Wrong response type")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(listAuditCmd)
+	listAuditCmd.PersistentFlags().String("action", "", "only list records of this action, e.g. get-login or ssh-sign")
+	listAuditCmd.PersistentFlags().Int("limit", 50, "maximum number of records, 0 for all")
+	auditCmd.AddCommand(verifyAuditCmd)
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+	"github.com/spf13/cobra"
+)
+
+var baseCardsCmd = &cobra.Command{
+	Use:   "cards",
+	Short: "Commands for managing cards.",
+	Long:  `Commands for managing cards.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var getCardCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Gets a card in your vault",
+	Long:  `Gets a card in your vault.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := loginIfRequired()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		uuid, _ := cmd.Flags().GetString("uuid")
+		name, _ := cmd.Flags().GetString("name")
+		fullOutput, _ := cmd.Flags().GetBool("full")
+
+		resp, err := commandClient.SendToAgent(messages.GetCardRequest{
+			Name: name,
+			UUID: uuid,
+		})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch resp.(type) {
+		case messages.GetCardResponse:
+			card := resp.(messages.GetCardResponse).Result
+			if fullOutput {
+				cardJSON, _ := json.Marshal(map[string]string{
+					"name":           card.Name,
+					"uuid":           card.UUID,
+					"cardholderName": card.CardholderName,
+					"brand":          card.Brand,
+					"number":         card.Number,
+					"expMonth":       card.ExpMonth,
+					"expYear":        card.ExpYear,
+					"code":           card.Code,
+					"notes":          card.Notes,
+				})
+				fmt.Println(string(cardJSON))
+			} else {
+				fmt.Println(card.Number)
+			}
+			return
+		case messages.ActionResponse:
+			fmt.Println("Error: " + resp.(messages.ActionResponse).Message)
+			return
+		}
+	},
+}
+
+var listCardsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists all cards in your vault",
+	Long:  `Lists all cards in your vault. Card numbers are masked, use get to retrieve a full card.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := loginIfRequired()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		resp, err := commandClient.SendToAgent(messages.ListCardsRequest{})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch resp.(type) {
+		case messages.GetCardsResponse:
+			toPrintCards := []map[string]string{}
+			for _, card := range resp.(messages.GetCardsResponse).Result {
+				toPrintCards = append(toPrintCards, map[string]string{
+					"name":           card.Name,
+					"uuid":           card.UUID,
+					"cardholderName": card.CardholderName,
+					"brand":          card.Brand,
+					"number":         card.Number,
+					"expMonth":       card.ExpMonth,
+					"expYear":        card.ExpYear,
+				})
+			}
+			toPrintJSON, _ := json.Marshal(toPrintCards)
+			fmt.Println(string(toPrintJSON))
+			return
+		case messages.ActionResponse:
+			fmt.Println("Error: " + resp.(messages.ActionResponse).Message)
+			return
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(baseCardsCmd)
+	baseCardsCmd.AddCommand(getCardCmd)
+	getCardCmd.PersistentFlags().String("name", "", "")
+	getCardCmd.PersistentFlags().String("uuid", "", "")
+	getCardCmd.PersistentFlags().Bool("full", false, "")
+	baseCardsCmd.AddCommand(listCardsCmd)
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/quexten/goldwarden/cli/ipc/messages"
@@ -303,6 +304,109 @@ var getRuntimeConfigCmd = &cobra.Command{
 	},
 }
 
+func getHTTPSettings() (messages.HTTPSettings, bool) {
+	result, err := commandClient.SendToAgent(messages.GetHTTPSettingsRequest{})
+	if err != nil {
+		handleSendToAgentError(err)
+		return messages.HTTPSettings{}, false
+	}
+
+	switch result := result.(type) {
+	case messages.GetHTTPSettingsResponse:
+		return result.Settings, true
+	case messages.ActionResponse:
+		fmt.Println("Error: " + result.Message)
+	default:
+		fmt.Println("Wrong IPC response type")
+	}
+	return messages.HTTPSettings{}, false
+}
+
+var setTLSCmd = &cobra.Command{
+	Use:   "set-tls",
+	Short: "Set the tls, proxy and retry settings",
+	Long: `Set the tls, proxy and retry settings used to connect to the server, e.g. for a self-hosted instance behind an internal CA.
+	Only the given flags are changed, pass an empty value to reset one. The settings apply to all accounts and the websocket connection.
+
+	Examples:
+	goldwarden config set-tls --ca-bundle /etc/ssl/company-ca.pem
+	goldwarden config set-tls --client-cert client.pem --client-key client-key.pem
+	goldwarden config set-tls --proxy http://proxy.example.com:3128 --retries 5
+	goldwarden config set-tls --proxy ""`,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings, ok := getHTTPSettings()
+		if !ok {
+			return
+		}
+
+		pathFlags := map[string]*string{
+			"ca-bundle":   &settings.CABundle,
+			"client-cert": &settings.ClientCertificate,
+			"client-key":  &settings.ClientKey,
+		}
+		for flag, setting := range pathFlags {
+			if !cmd.Flags().Changed(flag) {
+				continue
+			}
+			path, _ := cmd.Flags().GetString(flag)
+			if path != "" {
+				// the agent runs in a different working directory
+				absolutePath, err := filepath.Abs(path)
+				if err != nil {
+					fmt.Println("Error: " + err.Error())
+					return
+				}
+				path = absolutePath
+			}
+			*setting = path
+		}
+		if cmd.Flags().Changed("proxy") {
+			settings.Proxy, _ = cmd.Flags().GetString("proxy")
+		}
+		if cmd.Flags().Changed("retries") {
+			settings.Retries, _ = cmd.Flags().GetInt("retries")
+		}
+
+		result, err := commandClient.SendToAgent(messages.SetHTTPSettingsRequest{Settings: settings})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch result := result.(type) {
+		case messages.ActionResponse:
+			if result.Success {
+				fmt.Println("Done")
+			} else {
+				fmt.Println("Setting tls settings failed: " + result.Message)
+			}
+		default:
+			fmt.Println("Wrong IPC response type")
+		}
+	},
+}
+
+var getTLSCmd = &cobra.Command{
+	Use:   "get-tls",
+	Short: "Get the tls, proxy and retry settings",
+	Long:  `Get the tls, proxy and retry settings.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings, ok := getHTTPSettings()
+		if !ok {
+			return
+		}
+
+		response := map[string]interface{}{}
+		response["caBundle"] = settings.CABundle
+		response["clientCertificate"] = settings.ClientCertificate
+		response["clientKey"] = settings.ClientKey
+		response["proxy"] = settings.Proxy
+		response["retries"] = settings.Retries
+		responseJSON, _ := json.Marshal(response)
+		fmt.Println(string(responseJSON))
+	},
+}
+
 var configCmd = &cobra.Command{
 	Use:   "config",
 	Short: "Manage the configuration",
@@ -320,4 +424,11 @@ func init() {
 	configCmd.AddCommand(getRuntimeConfigCmd)
 	configCmd.AddCommand(setApiClientIDCmd)
 	configCmd.AddCommand(setApiSecretCmd)
+	configCmd.AddCommand(setTLSCmd)
+	setTLSCmd.PersistentFlags().String("ca-bundle", "", "PEM file with additional trusted CA certificates")
+	setTLSCmd.PersistentFlags().String("client-cert", "", "PEM client certificate for mutual TLS")
+	setTLSCmd.PersistentFlags().String("client-key", "", "PEM private key of the client certificate")
+	setTLSCmd.PersistentFlags().String("proxy", "", "proxy url, defaults to the HTTPS_PROXY environment variable")
+	setTLSCmd.PersistentFlags().Int("retries", 0, "retries on network and server errors, 0 for the default of 3, -1 to disable")
+	configCmd.AddCommand(getTLSCmd)
 }
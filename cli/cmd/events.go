@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+	"github.com/spf13/cobra"
+)
+
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Streams events from the daemon",
+	Long: `Streams events from the daemon until interrupted, such as locked, unlocked, synced, sync-failed,
+	websocket-connected, websocket-disconnected, ssh-sign and auth-request.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		types, _ := cmd.Flags().GetStringArray("type")
+		outputJSON, _ := cmd.Flags().GetBool("json")
+
+		conn, err := commandClient.Connect()
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+		defer conn.Close()
+
+		result, err := conn.SendCommand(messages.SubscribeEventsRequest{Types: types})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch result.(type) {
+		case messages.SubscribeEventsResponse:
+		case messages.ActionResponse:
+			fmt.Println("Error: " + result.(messages.ActionResponse).Message)
+			os.Exit(1)
+		default:
+			fmt.Println("Wrong response type")
+			os.Exit(1)
+		}
+
+		for {
+			message := conn.ReadMessage()
+			if message == nil {
+				fmt.Fprintln(os.Stderr, "Connection to daemon closed")
+				os.Exit(1)
+			}
+			event, ok := message.(messages.AgentEvent)
+			if !ok {
+				continue
+			}
+
+			if outputJSON {
+				output, _ := json.Marshal(map[string]interface{}{
+					"type": event.Type,
+					"time": event.Time,
+					"data": event.Data,
+				})
+				fmt.Println(string(output))
+				continue
+			}
+
+			keys := make([]string, 0, len(event.Data))
+			for key := range event.Data {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			fields := []string{event.Time.Local().Format(time.RFC3339), event.Type}
+			for _, key := range keys {
+				fields = append(fields, key+"="+event.Data[key])
+			}
+			fmt.Println(strings.Join(fields, " "))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(eventsCmd)
+	eventsCmd.PersistentFlags().StringArray("type", []string{}, "only stream events of this type, can be repeated")
+	eventsCmd.PersistentFlags().Bool("json", false, "print one json object per event")
+}
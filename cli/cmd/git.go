@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/quexten/goldwarden/cli/agent/ssh"
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+	"github.com/spf13/cobra"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var gitCmd = &cobra.Command{
+	Use:   "git",
+	Short: "Git integration",
+	Long:  `Git integration.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var gitVerifyCmd = &cobra.Command{
+	Use:   "verify -Y find-principals|check-novalidate|verify [ssh-keygen options]",
+	Short: "Verifies git ssh signatures against the ssh keys in your vault",
+	Long: `Verifies git ssh signatures against the ssh keys in your vault, taking the same arguments as ssh-keygen -Y.
+	Signers are identified by the git-email field of their key, or by the key name. Entries of git's
+	gpg.ssh.allowedSignersFile are accepted as well; git requires the option to point to an existing (possibly empty) file.
+	All other ssh-keygen invocations, like signing, are passed to ssh-keygen.
+
+	To use it, create a script like
+	  #!/bin/sh
+	  exec goldwarden git verify "$@"
+	and set it as git's gpg.ssh.program.`,
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+			_ = cmd.Help()
+			return
+		}
+
+		options, err := parseSSHKeygenArgs(args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(255)
+		}
+
+		switch options.mode {
+		case "find-principals", "check-novalidate", "verify":
+			os.Exit(verifyGitSignature(options))
+		default:
+			os.Exit(runSSHKeygen(args))
+		}
+	},
+}
+
+type sshKeygenOptions struct {
+	mode               string
+	namespace          string
+	allowedSignersFile string
+	principal          string
+	signatureFile      string
+}
+
+func parseSSHKeygenArgs(args []string) (sshKeygenOptions, error) {
+	var options sshKeygenOptions
+	for i := 0; i < len(args); i++ {
+		flag := args[i]
+		if len(flag) != 2 || flag[0] != '-' {
+			continue
+		}
+
+		var target *string
+		switch flag {
+		case "-Y":
+			target = &options.mode
+		case "-n":
+			target = &options.namespace
+		case "-f":
+			target = &options.allowedSignersFile
+		case "-I":
+			target = &options.principal
+		case "-s":
+			target = &options.signatureFile
+		case "-O":
+			// e.g. verify-time, ignored
+			i++
+			continue
+		default:
+			continue
+		}
+		if i+1 >= len(args) {
+			return options, errors.New("missing value for " + flag)
+		}
+		i++
+		*target = args[i]
+	}
+	return options, nil
+}
+
+func runSSHKeygen(args []string) int {
+	sshKeygen := exec.Command("ssh-keygen", args...)
+	sshKeygen.Stdin = os.Stdin
+	sshKeygen.Stdout = os.Stdout
+	sshKeygen.Stderr = os.Stderr
+	if err := sshKeygen.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 255
+	}
+	return 0
+}
+
+// vaultAllowedSigners returns the ssh keys of the vault as allowed signers for any namespace.
+func vaultAllowedSigners() []ssh.AllowedSigner {
+	result, err := commandClient.SendToAgent(messages.ExportSSHKeysRequest{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not get ssh keys from the vault: "+err.Error())
+		return nil
+	}
+
+	response, ok := result.(messages.ExportSSHKeysResponse)
+	if !ok {
+		if actionResponse, ok := result.(messages.ActionResponse); ok {
+			fmt.Fprintln(os.Stderr, "Could not get ssh keys from the vault: "+actionResponse.Message)
+		}
+		return nil
+	}
+
+	var signers []ssh.AllowedSigner
+	for _, key := range response.Keys {
+		publicKey, _, _, _, err := gossh.ParseAuthorizedKey([]byte(key.PublicKey))
+		if err != nil {
+			continue
+		}
+		principals := sshKeyPrincipals(key)
+		if len(principals) == 0 {
+			continue
+		}
+		signers = append(signers, ssh.AllowedSigner{
+			Principals:        principals,
+			LiteralPrincipals: true,
+			PublicKey:         publicKey,
+		})
+	}
+	return signers
+}
+
+// verifyGitSignature implements ssh-keygen -Y find-principals, check-novalidate and verify and
+// returns the exit code.
+func verifyGitSignature(options sshKeygenOptions) int {
+	armored, err := os.ReadFile(options.signatureFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 255
+	}
+	signature, err := ssh.ParseSSHSignature(armored)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not parse signature: "+err.Error())
+		return 255
+	}
+	keyType, _ := ssh.DescribePublicKey(signature.PublicKey)
+	fingerprint := gossh.FingerprintSHA256(signature.PublicKey)
+
+	var signers []ssh.AllowedSigner
+	if options.mode != "check-novalidate" {
+		signers = vaultAllowedSigners()
+		if options.allowedSignersFile != "" {
+			data, err := os.ReadFile(options.allowedSignersFile)
+			if err != nil && !os.IsNotExist(err) {
+				fmt.Fprintln(os.Stderr, err.Error())
+				return 255
+			}
+			fileSigners, err := ssh.ParseAllowedSigners(data)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Could not parse allowed signers: "+err.Error())
+				return 255
+			}
+			signers = append(signers, fileSigners...)
+		}
+	}
+
+	switch options.mode {
+	case "find-principals":
+		principals := ssh.FindPrincipals(signers, signature)
+		if len(principals) == 0 {
+			fmt.Fprintln(os.Stderr, "No principal matched.")
+			return 1
+		}
+		fmt.Println(strings.Join(principals, "\n"))
+		return 0
+	case "check-novalidate":
+		if err := signature.Verify(os.Stdin, options.namespace); err != nil {
+			fmt.Fprintln(os.Stderr, "Could not verify signature: "+err.Error())
+			return 255
+		}
+		fmt.Printf("Good \"%s\" signature with %s key %s\n", options.namespace, keyType, fingerprint)
+		return 0
+	default:
+		if err := signature.Verify(os.Stdin, options.namespace); err != nil {
+			fmt.Fprintln(os.Stderr, "Could not verify signature: "+err.Error())
+			return 255
+		}
+		if !ssh.IsAllowedSigner(signers, signature, options.principal) {
+			fmt.Fprintln(os.Stderr, "Could not verify signature: "+options.principal+" is not an allowed signer for this key")
+			return 255
+		}
+		fmt.Printf("Good \"%s\" signature for %s with %s key %s\n", options.namespace, options.principal, keyType, fingerprint)
+		return 0
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(gitCmd)
+	gitCmd.AddCommand(gitVerifyCmd)
+}
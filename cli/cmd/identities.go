@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+	"github.com/spf13/cobra"
+)
+
+var baseIdentitiesCmd = &cobra.Command{
+	Use:   "identities",
+	Short: "Commands for managing identities.",
+	Long:  `Commands for managing identities.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var getIdentityCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Gets an identity in your vault",
+	Long:  `Gets an identity in your vault.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := loginIfRequired()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		uuid, _ := cmd.Flags().GetString("uuid")
+		name, _ := cmd.Flags().GetString("name")
+
+		resp, err := commandClient.SendToAgent(messages.GetIdentityRequest{
+			Name: name,
+			UUID: uuid,
+		})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch resp.(type) {
+		case messages.GetIdentityResponse:
+			identity := resp.(messages.GetIdentityResponse).Result
+			identityJSON, _ := json.Marshal(map[string]string{
+				"name":           identity.Name,
+				"uuid":           identity.UUID,
+				"notes":          identity.Notes,
+				"title":          identity.Title,
+				"firstName":      identity.FirstName,
+				"middleName":     identity.MiddleName,
+				"lastName":       identity.LastName,
+				"username":       identity.Username,
+				"company":        identity.Company,
+				"ssn":            identity.SSN,
+				"passportNumber": identity.PassportNumber,
+				"licenseNumber":  identity.LicenseNumber,
+				"email":          identity.Email,
+				"phone":          identity.Phone,
+				"address1":       identity.Address1,
+				"address2":       identity.Address2,
+				"address3":       identity.Address3,
+				"city":           identity.City,
+				"state":          identity.State,
+				"postalCode":     identity.PostalCode,
+				"country":        identity.Country,
+			})
+			fmt.Println(string(identityJSON))
+			return
+		case messages.ActionResponse:
+			fmt.Println("Error: " + resp.(messages.ActionResponse).Message)
+			return
+		}
+	},
+}
+
+var listIdentitiesCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists all identities in your vault",
+	Long:  `Lists all identities in your vault. Only the name, email and company are shown, use get to retrieve a full identity.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := loginIfRequired()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		resp, err := commandClient.SendToAgent(messages.ListIdentitiesRequest{})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch resp.(type) {
+		case messages.GetIdentitiesResponse:
+			toPrintIdentities := []map[string]string{}
+			for _, identity := range resp.(messages.GetIdentitiesResponse).Result {
+				toPrintIdentities = append(toPrintIdentities, map[string]string{
+					"name":      identity.Name,
+					"uuid":      identity.UUID,
+					"firstName": identity.FirstName,
+					"lastName":  identity.LastName,
+					"email":     identity.Email,
+					"company":   identity.Company,
+				})
+			}
+			toPrintJSON, _ := json.Marshal(toPrintIdentities)
+			fmt.Println(string(toPrintJSON))
+			return
+		case messages.ActionResponse:
+			fmt.Println("Error: " + resp.(messages.ActionResponse).Message)
+			return
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(baseIdentitiesCmd)
+	baseIdentitiesCmd.AddCommand(getIdentityCmd)
+	getIdentityCmd.PersistentFlags().String("name", "", "")
+	getIdentityCmd.PersistentFlags().String("uuid", "", "")
+	baseIdentitiesCmd.AddCommand(listIdentitiesCmd)
+}
@@ -14,7 +14,9 @@ var loginCmd = &cobra.Command{
 	Use:   "login",
 	Short: "Starts the login process for Bitwarden",
 	Long: `Starts the login process for Bitwarden.
-	You will be prompted to enter your password, and confirm your second factor if you have one.`,
+	You will be prompted to enter your password, and confirm your second factor if you have one.
+	If several second factors are enabled, you are asked which one to use, unless --2fa-method is set.
+	Leaving the email code empty sends a new email.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		request := messages.DoLoginRequest{}
 		email, _ := cmd.Flags().GetString("email")
@@ -26,6 +28,8 @@ var loginCmd = &cobra.Command{
 		request.Email = email
 		passwordless, _ := cmd.Flags().GetBool("passwordless")
 		request.Passwordless = passwordless
+		twoFactorMethod, _ := cmd.Flags().GetString("2fa-method")
+		request.TwoFactorMethod = twoFactorMethod
 
 		result, err := commandClient.SendToAgent(request)
 		if err != nil {
@@ -51,4 +55,5 @@ func init() {
 	loginCmd.PersistentFlags().String("email", "", "")
 	_ = loginCmd.MarkFlagRequired("email")
 	loginCmd.PersistentFlags().Bool("passwordless", false, "")
+	loginCmd.PersistentFlags().String("2fa-method", "", "second factor to use: webauthn, authenticator, yubikey, duo, organization-duo or email. Asked for if the account has several")
 }
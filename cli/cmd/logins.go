@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/icza/gox/stringsx"
@@ -75,7 +78,9 @@ var listLoginsCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		logins, err := ListLogins(commandClient)
+		folder, _ := cmd.Flags().GetString("folder")
+		collection, _ := cmd.Flags().GetString("collection")
+		logins, err := ListLogins(commandClient, folder, collection)
 		if err != nil {
 			handleSendToAgentError(err)
 			return
@@ -88,7 +93,7 @@ var listLoginsCmd = &cobra.Command{
 				"uuid":     stringsx.Clean(login.UUID),
 				"username": stringsx.Clean(login.Username),
 				"password": stringsx.Clean(strings.ReplaceAll(login.Password, "\"", "\\\"")),
-				"totp":     stringsx.Clean(login.TOTPSeed),
+				"hasTotp":  strconv.FormatBool(login.HasTOTP),
 				"uri":      stringsx.Clean(login.URI),
 			}
 			toPrintLogins = append(toPrintLogins, data)
@@ -98,8 +103,279 @@ var listLoginsCmd = &cobra.Command{
 	},
 }
 
-func ListLogins(client client.UnixSocketClient) ([]messages.DecryptedLoginCipher, error) {
-	resp, err := client.SendToAgent(messages.ListLoginsRequest{})
+var createLoginCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Creates a login in your vault",
+	Long:  `Creates a login in your vault.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := loginIfRequired()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		name, _ := cmd.Flags().GetString("name")
+		username, _ := cmd.Flags().GetString("username")
+		password, err := getPasswordFlag(cmd)
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			return
+		}
+		uris, _ := cmd.Flags().GetStringArray("uri")
+		totp, _ := cmd.Flags().GetString("totp")
+		notes, _ := cmd.Flags().GetString("notes")
+		fields, err := getLoginFieldFlags(cmd)
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			return
+		}
+		orgId, _ := cmd.Flags().GetString("org")
+		collectionIDs, _ := cmd.Flags().GetStringArray("collection")
+
+		resp, err := commandClient.SendToAgent(messages.AddLoginRequest{
+			Name:          name,
+			Username:      username,
+			Password:      password,
+			URIs:          uris,
+			TOTP:          totp,
+			Notes:         notes,
+			Fields:        fields,
+			OrgId:         orgId,
+			CollectionIDs: collectionIDs,
+		})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch resp.(type) {
+		case messages.AddLoginResponse:
+			response := resp.(messages.AddLoginResponse)
+			toPrintJSON, _ := json.Marshal(map[string]string{
+				"name": response.Name,
+				"uuid": response.UUID,
+			})
+			fmt.Println(string(toPrintJSON))
+			return
+		case messages.ActionResponse:
+			fmt.Println("Error: " + resp.(messages.ActionResponse).Message)
+			return
+		}
+	},
+}
+
+var editLoginCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edits a login in your vault",
+	Long:  `Edits a login in your vault. Only the given flags are changed, --uri and the field flags replace all existing uris or fields.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := loginIfRequired()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		uuid, _ := cmd.Flags().GetString("uuid")
+		lookupName, _ := cmd.Flags().GetString("name")
+		request := messages.EditLoginRequest{
+			UUID:       uuid,
+			LookupName: lookupName,
+		}
+
+		if cmd.Flags().Changed("new-name") {
+			newName, _ := cmd.Flags().GetString("new-name")
+			request.Name = &newName
+		}
+		if cmd.Flags().Changed("username") {
+			username, _ := cmd.Flags().GetString("username")
+			request.Username = &username
+		}
+		if cmd.Flags().Changed("password") || cmd.Flags().Changed("password-stdin") {
+			password, err := getPasswordFlag(cmd)
+			if err != nil {
+				fmt.Println("Error: " + err.Error())
+				return
+			}
+			request.Password = &password
+		}
+		if cmd.Flags().Changed("uri") {
+			uris, _ := cmd.Flags().GetStringArray("uri")
+			request.URIs = &uris
+		}
+		if cmd.Flags().Changed("totp") {
+			totp, _ := cmd.Flags().GetString("totp")
+			request.TOTP = &totp
+		}
+		if cmd.Flags().Changed("notes") {
+			notes, _ := cmd.Flags().GetString("notes")
+			request.Notes = &notes
+		}
+		if cmd.Flags().Changed("field") || cmd.Flags().Changed("hidden-field") {
+			fields, err := getLoginFieldFlags(cmd)
+			if err != nil {
+				fmt.Println("Error: " + err.Error())
+				return
+			}
+			request.Fields = &fields
+		}
+
+		resp, err := commandClient.SendToAgent(request)
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch resp.(type) {
+		case messages.EditLoginResponse:
+			response := resp.(messages.EditLoginResponse)
+			toPrintJSON, _ := json.Marshal(map[string]string{
+				"name": response.Name,
+				"uuid": response.UUID,
+			})
+			fmt.Println(string(toPrintJSON))
+			return
+		case messages.ActionResponse:
+			fmt.Println("Error: " + resp.(messages.ActionResponse).Message)
+			return
+		}
+	},
+}
+
+var deleteLoginCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Deletes a login in your vault",
+	Long:  `Moves a login in your vault to the trash, or deletes it permanently with --permanent.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := loginIfRequired()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		uuid, _ := cmd.Flags().GetString("uuid")
+		name, _ := cmd.Flags().GetString("name")
+		permanent, _ := cmd.Flags().GetBool("permanent")
+
+		resp, err := commandClient.SendToAgent(messages.DeleteLoginRequest{
+			UUID:      uuid,
+			Name:      name,
+			Permanent: permanent,
+		})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch resp.(type) {
+		case messages.ActionResponse:
+			response := resp.(messages.ActionResponse)
+			if response.Success {
+				fmt.Println("Done")
+			} else {
+				fmt.Println("Error: " + response.Message)
+			}
+			return
+		}
+	},
+}
+
+var totpLoginCmd = &cobra.Command{
+	Use:   "totp",
+	Short: "Gets the current totp code of a login in your vault",
+	Long:  `Gets the current totp code of a login in your vault. The totp secret is not sent to the client.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := loginIfRequired()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		uuid, _ := cmd.Flags().GetString("uuid")
+		name, _ := cmd.Flags().GetString("name")
+		username, _ := cmd.Flags().GetString("username")
+		fullOutput, _ := cmd.Flags().GetBool("full")
+
+		resp, err := commandClient.SendToAgent(messages.GetTOTPRequest{
+			Name:     name,
+			Username: username,
+			UUID:     uuid,
+		})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch resp.(type) {
+		case messages.GetTOTPResponse:
+			response := resp.(messages.GetTOTPResponse)
+			if fullOutput {
+				toPrintJSON, _ := json.Marshal(map[string]interface{}{
+					"code":             response.Code,
+					"period":           response.Period,
+					"secondsRemaining": response.SecondsRemaining,
+				})
+				fmt.Println(string(toPrintJSON))
+			} else {
+				fmt.Println(response.Code)
+			}
+			return
+		case messages.ActionResponse:
+			fmt.Println("Error: " + resp.(messages.ActionResponse).Message)
+			return
+		}
+	},
+}
+
+func getPasswordFlag(cmd *cobra.Command) (string, error) {
+	passwordFromStdin, _ := cmd.Flags().GetBool("password-stdin")
+	if !passwordFromStdin {
+		password, _ := cmd.Flags().GetString("password")
+		return password, nil
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	password, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(password, "\r\n"), nil
+}
+
+func getLoginFieldFlags(cmd *cobra.Command) ([]messages.LoginField, error) {
+	fields := make([]messages.LoginField, 0)
+	for _, flag := range []string{"field", "hidden-field"} {
+		values, _ := cmd.Flags().GetStringArray(flag)
+		for _, value := range values {
+			name, fieldValue, found := strings.Cut(value, "=")
+			if !found || name == "" {
+				return nil, errors.New("invalid field " + value + ", expected name=value")
+			}
+			fields = append(fields, messages.LoginField{
+				Name:   name,
+				Value:  fieldValue,
+				Hidden: flag == "hidden-field",
+			})
+		}
+	}
+	return fields, nil
+}
+
+func addLoginDataFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("username", "", "")
+	cmd.PersistentFlags().String("password", "", "")
+	cmd.PersistentFlags().Bool("password-stdin", false, "read the password from stdin")
+	cmd.PersistentFlags().StringArray("uri", []string{}, "can be given multiple times")
+	cmd.PersistentFlags().String("totp", "", "")
+	cmd.PersistentFlags().String("notes", "", "")
+	cmd.PersistentFlags().StringArray("field", []string{}, "custom field as name=value, can be given multiple times")
+	cmd.PersistentFlags().StringArray("hidden-field", []string{}, "hidden custom field as name=value, can be given multiple times")
+}
+
+func ListLogins(client client.UnixSocketClient, folder string, collection string) ([]messages.DecryptedLoginCipher, error) {
+	resp, err := client.SendToAgent(messages.ListLoginsRequest{
+		Folder:     folder,
+		Collection: collection,
+	})
 	if err != nil {
 		return []messages.DecryptedLoginCipher{}, err
 	}
@@ -124,4 +400,25 @@ func init() {
 	getLoginCmd.PersistentFlags().String("uuid", "", "")
 	getLoginCmd.PersistentFlags().Bool("full", false, "")
 	baseLoginCmd.AddCommand(listLoginsCmd)
+	listLoginsCmd.PersistentFlags().String("folder", "", "only list logins in this folder (name or id)")
+	listLoginsCmd.PersistentFlags().String("collection", "", "only list logins in this collection (name or id)")
+	baseLoginCmd.AddCommand(totpLoginCmd)
+	totpLoginCmd.PersistentFlags().String("name", "", "")
+	totpLoginCmd.PersistentFlags().String("username", "", "")
+	totpLoginCmd.PersistentFlags().String("uuid", "", "")
+	totpLoginCmd.PersistentFlags().Bool("full", false, "also print the period and seconds remaining")
+	baseLoginCmd.AddCommand(createLoginCmd)
+	createLoginCmd.PersistentFlags().String("name", "", "")
+	addLoginDataFlags(createLoginCmd)
+	createLoginCmd.PersistentFlags().String("org", "", "organization id")
+	createLoginCmd.PersistentFlags().StringArray("collection", []string{}, "collection id, can be given multiple times")
+	baseLoginCmd.AddCommand(editLoginCmd)
+	editLoginCmd.PersistentFlags().String("uuid", "", "")
+	editLoginCmd.PersistentFlags().String("name", "", "name of the login to edit")
+	editLoginCmd.PersistentFlags().String("new-name", "", "")
+	addLoginDataFlags(editLoginCmd)
+	baseLoginCmd.AddCommand(deleteLoginCmd)
+	deleteLoginCmd.PersistentFlags().String("uuid", "", "")
+	deleteLoginCmd.PersistentFlags().String("name", "", "")
+	deleteLoginCmd.PersistentFlags().Bool("permanent", false, "")
 }
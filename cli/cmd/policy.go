@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+	"github.com/spf13/cobra"
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Manage the access policy",
+	Long: `Manage the access policy.
+	The policy is read from policy.json next to the config file. Its rules decide whether a request is allowed, denied,
+	asked for or requires biometrics, based on the executable, process ancestry, entry, folder, ssh key and action.
+	Requests from a forwarded ssh agent or a remote ssh session only match rules with "forwarded": true.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var reloadPolicyCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Reloads the policy file",
+	Long:  `Reloads the policy file in the running daemon.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commandClient.SendToAgent(messages.ReloadPolicyRequest{})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch result.(type) {
+		case messages.ActionResponse:
+			response := result.(messages.ActionResponse)
+			if response.Success {
+				fmt.Println(response.Message)
+			} else {
+				fmt.Println("Error: " + response.Message)
+			}
+		default:
+			fmt.Println("Wrong response type")
+		}
+	},
+}
+
+var checkPolicyCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Shows which rule applies to a request",
+	Long:  `Shows which rule of the loaded policy applies to a request, without performing any action.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		action, _ := cmd.Flags().GetString("action")
+		executable, _ := cmd.Flags().GetString("executable")
+		process, _ := cmd.Flags().GetString("process")
+		parent, _ := cmd.Flags().GetString("parent")
+		grandparent, _ := cmd.Flags().GetString("grandparent")
+		cipher, _ := cmd.Flags().GetString("cipher")
+		folder, _ := cmd.Flags().GetString("folder")
+		key, _ := cmd.Flags().GetString("key")
+		forwarded, _ := cmd.Flags().GetBool("forwarded")
+		remoteHost, _ := cmd.Flags().GetString("remote-host")
+
+		result, err := commandClient.SendToAgent(messages.CheckPolicyRequest{
+			Action:         action,
+			ExecutablePath: executable,
+			Ancestry:       []string{process, parent, grandparent},
+			Cipher:         cipher,
+			Folder:         folder,
+			Key:            key,
+			Forwarded:      forwarded || remoteHost != "",
+			RemoteHost:     remoteHost,
+		})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch result.(type) {
+		case messages.CheckPolicyResponse:
+			response := result.(messages.CheckPolicyResponse)
+			output := map[string]interface{}{
+				"decision": response.Decision,
+				"rule":     response.RuleIndex,
+				"ruleName": response.RuleName,
+				"ttl":      response.TTL,
+			}
+			if response.Decision == "" {
+				output["decision"] = "none (built-in approval)"
+			}
+			outputJSON, _ := json.Marshal(output)
+			fmt.Println(string(outputJSON))
+		case messages.ActionResponse:
+			fmt.Println("Error: " + result.(messages.ActionResponse).Message)
+		default:
+			fmt.Println("Wrong response type")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(policyCmd)
+	policyCmd.AddCommand(reloadPolicyCmd)
+	policyCmd.AddCommand(checkPolicyCmd)
+	checkPolicyCmd.PersistentFlags().String("action", "", "e.g. access-vault, get-login, ssh-sign, git-sign, edit-ssh-key")
+	_ = checkPolicyCmd.MarkPersistentFlagRequired("action")
+	checkPolicyCmd.PersistentFlags().String("executable", "", "full path of the calling executable")
+	checkPolicyCmd.PersistentFlags().String("process", "", "name of the calling process")
+	checkPolicyCmd.PersistentFlags().String("parent", "", "name of the parent process")
+	checkPolicyCmd.PersistentFlags().String("grandparent", "", "name of the grandparent process")
+	checkPolicyCmd.PersistentFlags().String("cipher", "", "entry name")
+	checkPolicyCmd.PersistentFlags().String("folder", "", "folder name")
+	checkPolicyCmd.PersistentFlags().String("key", "", "ssh key name")
+	checkPolicyCmd.PersistentFlags().Bool("forwarded", false, "request from a forwarded ssh agent or remote ssh session")
+	checkPolicyCmd.PersistentFlags().String("remote-host", "", "remote host of a forwarded request")
+}
@@ -25,6 +25,7 @@ func Execute(cfg config.RuntimeConfig) {
 	runtimeConfig = cfg
 
 	commandClient = client.NewUnixSocketClient(&cfg)
+	rootCmd.PersistentFlags().StringVar(&cfg.Account, "account", cfg.Account, "account to use, defaults to the default account")
 
 	err := rootCmd.Execute()
 	if err != nil {
@@ -29,8 +29,12 @@ var runCmd = &cobra.Command{
 
 		env := []string{}
 
+		folder, _ := cmd.Flags().GetString("folder")
+		collection, _ := cmd.Flags().GetString("collection")
 		result, err := commandClient.SendToAgent(messages.GetCLICredentialsRequest{
 			ApplicationName: executable,
+			Folder:          folder,
+			Collection:      collection,
 		})
 		if err != nil {
 			handleSendToAgentError(err)
@@ -60,4 +64,7 @@ var runCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(runCmd)
+	runCmd.Flags().String("folder", "", "only use credentials in this folder (name or id)")
+	runCmd.Flags().String("collection", "", "only use credentials in this collection (name or id)")
+	runCmd.Flags().SetInterspersed(false)
 }
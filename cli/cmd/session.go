@@ -46,6 +46,9 @@ var pinentry = &cobra.Command{
 
 		for {
 			response := conn.ReadMessage()
+			if response == nil {
+				return
+			}
 			switch response.(type) {
 			case messages.PinentryPinRequest:
 				fmt.Println("pin-request" + "," + response.(messages.PinentryPinRequest).Message)
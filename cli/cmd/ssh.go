@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 
@@ -24,7 +25,9 @@ var sshAddCmd = &cobra.Command{
 	Use:   "add",
 	Short: "Creates a new SSH key and adds it to the SSH Agent.",
 	Long: `Creates a new SSH key and adds it to the SSH Agent.
-	The key is stored as a secure note. Consult the documentation for more information.`,
+	The key is stored as an SSH key item. Consult the documentation for more information.
+	The ed25519-sk and ecdsa-sk types create the key on a FIDO2 security key, which has to be touched for every signature;
+	only the key handle is stored in your vault.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		err := loginIfRequired()
 		if err != nil {
@@ -33,10 +36,12 @@ var sshAddCmd = &cobra.Command{
 		}
 
 		name, _ := cmd.Flags().GetString("name")
+		keyType, _ := cmd.Flags().GetString("type")
 		copyToClipboard, _ := cmd.Flags().GetBool("clipboard")
 
 		result, err := commandClient.SendToAgent(messages.CreateSSHKeyRequest{
 			Name: name,
+			Type: keyType,
 		})
 		if err != nil {
 			handleSendToAgentError(err)
@@ -65,7 +70,11 @@ var sshAddCmd = &cobra.Command{
 var listSSHCmd = &cobra.Command{
 	Use:   "list",
 	Short: "Lists all SSH keys in your vault",
-	Long:  `Lists all SSH keys in your vault.`,
+	Long: `Lists all SSH keys in your vault.
+	Keys with "allowed-hosts" or "allowed-users" fields (comma separated host names, SHA256 host key fingerprints or user names)
+	are only used for those destinations and show their restrictions.
+	Keys with an "agent-forwarding" field set to "never" are not offered to forwarded agents and remote ssh sessions.
+	Other forwarded requests are confirmed one by one and only match policy rules with "forwarded": true.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		err := loginIfRequired()
 		if err != nil {
@@ -73,7 +82,12 @@ var listSSHCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		result, err := commandClient.SendToAgent(messages.GetSSHKeysRequest{})
+		folder, _ := cmd.Flags().GetString("folder")
+		collection, _ := cmd.Flags().GetString("collection")
+		result, err := commandClient.SendToAgent(messages.GetSSHKeysRequest{
+			Folder:     folder,
+			Collection: collection,
+		})
 		if err != nil {
 			handleSendToAgentError(err)
 			return
@@ -96,7 +110,10 @@ var listSSHCmd = &cobra.Command{
 var importSSHCmd = &cobra.Command{
 	Use:   "import",
 	Short: "Imports an SSH key into your vault",
-	Long:  `Imports an SSH key into your vault.`,
+	Long: `Imports an SSH key into your vault.
+	OpenSSH, PEM, PKCS#8 and PuTTY (.ppk) keys are supported. The passphrase of an encrypted key is asked for via pinentry,
+	the key is stored without passphrase in your vault.
+	Security key (ed25519-sk, ecdsa-sk) files from ssh-keygen are supported if they have no passphrase.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) == 0 {
 			fmt.Println("Error: No filename for SSH key specified")
@@ -151,13 +168,100 @@ var importSSHCmd = &cobra.Command{
 	},
 }
 
+var setSSHCertificateCmd = &cobra.Command{
+	Use:   "set-certificate [certificate file]",
+	Short: "Attaches an OpenSSH certificate to an SSH key in your vault",
+	Long: `Attaches an OpenSSH certificate (e.g. id_ed25519-cert.pub) to an SSH key in your vault, replacing the previous one.
+	The SSH agent offers the certificate alongside the key while it is valid.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uuid, _ := cmd.Flags().GetString("uuid")
+		name, _ := cmd.Flags().GetString("name")
+		if uuid == "" && name == "" {
+			fmt.Println("Error: --uuid or --name is required")
+			return
+		}
+
+		certificate, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			return
+		}
+
+		result, err := commandClient.SendToAgent(messages.SetSSHCertificateRequest{
+			UUID:        uuid,
+			Name:        name,
+			Certificate: string(certificate),
+		})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+		printActionResponse(result)
+	},
+}
+
+var migrateSSHCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Converts SSH keys stored as secure notes to SSH key items",
+	Long: `Converts SSH keys stored as secure notes (the format of older goldwarden versions) to native SSH key items.
+	Use --dry-run to only report which keys would be converted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := loginIfRequired()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		result, err := commandClient.SendToAgent(messages.MigrateSSHKeysRequest{
+			DryRun: dryRun,
+		})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch result.(type) {
+		case messages.MigrateSSHKeysResponse:
+			output := []map[string]interface{}{}
+			for _, migration := range result.(messages.MigrateSSHKeysResponse).Results {
+				entry := map[string]interface{}{
+					"uuid":        migration.UUID,
+					"name":        migration.Name,
+					"fingerprint": migration.Fingerprint,
+					"status":      migration.Status,
+				}
+				if migration.Error != "" {
+					entry["error"] = migration.Error
+				}
+				output = append(output, entry)
+			}
+			outputJSON, _ := json.Marshal(output)
+			fmt.Println(string(outputJSON))
+		case messages.ActionResponse:
+			fmt.Println("Error: " + result.(messages.ActionResponse).Message)
+		default:
+			fmt.Println("Wrong response type")
+		}
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(sshCmd)
 	sshCmd.AddCommand(sshAddCmd)
 	sshAddCmd.PersistentFlags().String("name", "", "")
 	_ = sshAddCmd.MarkFlagRequired("name")
 	sshAddCmd.PersistentFlags().Bool("clipboard", false, "Copy the public key to the clipboard")
+	sshAddCmd.PersistentFlags().String("type", "ed25519", "key type: ed25519, ecdsa-p256, ecdsa-p384, rsa-3072, rsa-4096, ed25519-sk or ecdsa-sk")
 	sshCmd.AddCommand(listSSHCmd)
+	listSSHCmd.PersistentFlags().String("folder", "", "only list keys in this folder (name or id)")
+	listSSHCmd.PersistentFlags().String("collection", "", "only list keys in this collection (name or id)")
 	importSSHCmd.PersistentFlags().String("name", "", "")
 	sshCmd.AddCommand(importSSHCmd)
+	sshCmd.AddCommand(setSSHCertificateCmd)
+	sshCmd.AddCommand(migrateSSHCmd)
+	migrateSSHCmd.PersistentFlags().Bool("dry-run", false, "only report which keys would be converted")
+	setSSHCertificateCmd.PersistentFlags().String("uuid", "", "id of the ssh key")
+	setSSHCertificateCmd.PersistentFlags().String("name", "", "name of the ssh key")
 }
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+	"github.com/spf13/cobra"
+)
+
+var sshAgentsCmd = &cobra.Command{
+	Use:   "agents",
+	Short: "Manage additional SSH agent sockets",
+	Long: `Manage SSH agent profiles: additional agent sockets that each serve only a subset of the SSH keys in your vault.
+	For example, a "work" socket that is forwarded to bastion hosts can expose only the work keys, while the main socket stays private.
+	Keys added with ssh-add are only served on the main socket, and the profile sockets do not accept ssh-add, ssh-add -d/-D or ssh-add -x/-X.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var listSSHAgentsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the SSH agent profiles",
+	Long:  `Lists the SSH agent profiles, their sockets and key selections.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commandClient.SendToAgent(messages.ListSSHAgentProfilesRequest{})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch result.(type) {
+		case messages.ListSSHAgentProfilesResponse:
+			output := []map[string]interface{}{}
+			for _, profile := range result.(messages.ListSSHAgentProfilesResponse).Profiles {
+				output = append(output, map[string]interface{}{
+					"name":         profile.Name,
+					"socketPath":   profile.SocketPath,
+					"folders":      profile.Folders,
+					"namePatterns": profile.NamePatterns,
+					"fields":       profile.Fields,
+				})
+			}
+			outputJSON, _ := json.Marshal(output)
+			fmt.Println(string(outputJSON))
+		case messages.ActionResponse:
+			fmt.Println("Error: " + result.(messages.ActionResponse).Message)
+		default:
+			fmt.Println("Wrong response type")
+		}
+	},
+}
+
+var setSSHAgentCmd = &cobra.Command{
+	Use:   "set [name]",
+	Short: "Adds or replaces an SSH agent profile",
+	Long: `Adds or replaces an SSH agent profile and starts its socket.
+	Keys are selected by folder, name pattern (e.g. "work-*") or custom field (e.g. "env=work", the value may be a pattern).
+	Each option can be given multiple times; a key is served if it matches one of the values of every given option.
+	Point SSH_AUTH_SOCK at the socket, or use ssh's IdentityAgent option, e.g. to forward it with ForwardAgent.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		socketPath, _ := cmd.Flags().GetString("socket")
+		folders, _ := cmd.Flags().GetStringArray("folder")
+		namePatterns, _ := cmd.Flags().GetStringArray("name")
+		fields, _ := cmd.Flags().GetStringArray("field")
+
+		result, err := commandClient.SendToAgent(messages.SetSSHAgentProfileRequest{
+			Profile: messages.SSHAgentProfile{
+				Name:         args[0],
+				SocketPath:   socketPath,
+				Folders:      folders,
+				NamePatterns: namePatterns,
+				Fields:       fields,
+			},
+		})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+		printActionResponse(result)
+	},
+}
+
+var removeSSHAgentCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Removes an SSH agent profile",
+	Long:  `Removes an SSH agent profile and closes its socket.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commandClient.SendToAgent(messages.RemoveSSHAgentProfileRequest{Name: args[0]})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+		printActionResponse(result)
+	},
+}
+
+func init() {
+	sshCmd.AddCommand(sshAgentsCmd)
+	sshAgentsCmd.AddCommand(listSSHAgentsCmd)
+	sshAgentsCmd.AddCommand(setSSHAgentCmd)
+	setSSHAgentCmd.PersistentFlags().String("socket", "", "socket path, next to the main agent socket if empty")
+	setSSHAgentCmd.PersistentFlags().StringArray("folder", nil, "serve keys in this folder")
+	setSSHAgentCmd.PersistentFlags().StringArray("name", nil, "serve keys whose name matches this pattern")
+	setSSHAgentCmd.PersistentFlags().StringArray("field", nil, "serve keys with this custom field, as name=value")
+	sshAgentsCmd.AddCommand(removeSSHAgentCmd)
+}
@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+	"github.com/spf13/cobra"
+)
+
+var unsafeFileNameCharacters = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+var exportSSHCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports the public keys of the SSH keys in your vault",
+	Long: `Exports the public keys of the SSH keys in your vault, to distribute them straight from the vault.
+	Formats:
+	  authorized_keys  lines for ~/.ssh/authorized_keys, prefixed with --options if given
+	  allowed_signers  lines for git's gpg.ssh.allowedSignersFile, with the git-email field, the key name or --principal as principal
+	  pubkey           one <name>.pub file per key (and <name>-cert.pub for certificates) in --output-dir
+	  ssh_config       a Host block per key with allowed-hosts names, using the <name>.pub files of the pubkey
+	                   format (in --output-dir or ~/.ssh) as IdentityFile; allowed host fingerprints are listed
+	                   as comments to compare against the known_hosts entries
+	Each key is preceded by a comment with its name, type and fingerprint.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := loginIfRequired()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		format, _ := cmd.Flags().GetString("format")
+		folder, _ := cmd.Flags().GetString("folder")
+		collection, _ := cmd.Flags().GetString("collection")
+		options, _ := cmd.Flags().GetString("options")
+		principal, _ := cmd.Flags().GetString("principal")
+		namespaces, _ := cmd.Flags().GetString("namespaces")
+		outputDir, _ := cmd.Flags().GetString("output-dir")
+		force, _ := cmd.Flags().GetBool("force")
+
+		if format != "authorized_keys" && format != "allowed_signers" && format != "pubkey" && format != "ssh_config" {
+			fmt.Println("Error: unknown format " + format + ", use authorized_keys, allowed_signers, pubkey or ssh_config")
+			return
+		}
+		if format == "pubkey" && outputDir == "" {
+			fmt.Println("Error: --output-dir is required for the pubkey format")
+			return
+		}
+
+		result, err := commandClient.SendToAgent(messages.ExportSSHKeysRequest{
+			Folder:     folder,
+			Collection: collection,
+		})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch result.(type) {
+		case messages.ExportSSHKeysResponse:
+			keys := result.(messages.ExportSSHKeysResponse).Keys
+			switch format {
+			case "authorized_keys":
+				for _, key := range keys {
+					fmt.Println(sshKeyExportComment(key))
+					line := key.PublicKey + " " + sshKeyExportName(key)
+					if options != "" {
+						line = options + " " + line
+					}
+					fmt.Println(line)
+				}
+			case "allowed_signers":
+				for _, key := range keys {
+					principals := principal
+					if principals == "" {
+						principals = strings.Join(sshKeyPrincipals(key), ",")
+					}
+					fmt.Println(sshKeyExportComment(key))
+					if principals == "" {
+						fmt.Println("# skipped, the key has no name or git-email usable as principal, use --principal")
+						continue
+					}
+					fmt.Println(principals + " namespaces=\"" + namespaces + "\" " + key.PublicKey)
+				}
+			case "pubkey":
+				writeSSHPublicKeyFiles(keys, outputDir, force)
+			case "ssh_config":
+				printSSHConfig(keys, outputDir)
+			}
+		case messages.ActionResponse:
+			fmt.Println("Error: " + result.(messages.ActionResponse).Message)
+		default:
+			fmt.Println("Wrong response type")
+		}
+	},
+}
+
+func sshKeyExportName(key messages.SSHPublicKey) string {
+	return strings.ReplaceAll(key.Name, "\n", " ")
+}
+
+// sshKeyPrincipals returns the git-email fields of a key, or its name if it has none. Principals
+// which allowed signers files would read as patterns or as several principals are skipped, so
+// that e.g. a shared key named * does not match every committer.
+func sshKeyPrincipals(key messages.SSHPublicKey) []string {
+	candidates := key.GitEmails
+	if len(candidates) == 0 {
+		candidates = []string{strings.ReplaceAll(sshKeyExportName(key), " ", "_")}
+	}
+
+	principals := make([]string, 0, len(candidates))
+	for _, principal := range candidates {
+		if principal == "" || strings.ContainsAny(principal, "*?[],\"\\ \t") {
+			continue
+		}
+		principals = append(principals, principal)
+	}
+	return principals
+}
+
+func sshKeyExportComment(key messages.SSHPublicKey) string {
+	return fmt.Sprintf("# %s (%d %s) %s", sshKeyExportName(key), key.Bits, key.Type, key.Fingerprint)
+}
+
+// sshPublicKeyFileBaseNames returns the file names of the keys in the pubkey format, without extension.
+func sshPublicKeyFileBaseNames(keys []messages.SSHPublicKey) []string {
+	baseNames := make([]string, 0, len(keys))
+	written := make(map[string]bool)
+	for _, key := range keys {
+		baseName := unsafeFileNameCharacters.ReplaceAllString(key.Name, "_")
+		// keys with the same name get their id appended
+		if written[baseName] {
+			baseName += "-" + key.UUID
+		}
+		written[baseName] = true
+		baseNames = append(baseNames, baseName)
+	}
+	return baseNames
+}
+
+// printSSHConfig prints a Host block per key, so that ssh offers the key from the agent to its
+// allowed hosts only.
+func printSSHConfig(keys []messages.SSHPublicKey, outputDir string) {
+	if outputDir == "" {
+		outputDir = "~/.ssh"
+	}
+
+	baseNames := sshPublicKeyFileBaseNames(keys)
+	for i, key := range keys {
+		var hosts, fingerprints []string
+		for _, host := range key.AllowedHosts {
+			if strings.HasPrefix(host, "SHA256:") {
+				fingerprints = append(fingerprints, host)
+			} else if !strings.ContainsAny(host, " \t\"") {
+				hosts = append(hosts, host)
+			}
+		}
+
+		fmt.Println(sshKeyExportComment(key))
+		for _, fingerprint := range fingerprints {
+			fmt.Println("# allowed host key " + fingerprint)
+		}
+		if len(hosts) == 0 {
+			fmt.Println("# skipped, the key has no allowed-hosts names")
+			continue
+		}
+		fmt.Println("Host " + strings.Join(hosts, " "))
+		fmt.Println("\tIdentityFile " + filepath.ToSlash(filepath.Join(outputDir, baseNames[i]+".pub")))
+		fmt.Println("\tIdentitiesOnly yes")
+		fmt.Println()
+	}
+}
+
+func writeSSHPublicKeyFiles(keys []messages.SSHPublicKey, outputDir string, force bool) {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		fmt.Println("Error: " + err.Error())
+		return
+	}
+
+	output := []map[string]interface{}{}
+	baseNames := sshPublicKeyFileBaseNames(keys)
+	for i, key := range keys {
+		baseName := baseNames[i]
+
+		files := map[string]string{
+			baseName + ".pub": key.PublicKey + " " + sshKeyExportName(key) + "\n",
+		}
+		if key.Certificate != "" {
+			files[baseName+"-cert.pub"] = key.Certificate + "\n"
+		}
+
+		entry := map[string]interface{}{
+			"name":        key.Name,
+			"type":        key.Type,
+			"bits":        key.Bits,
+			"fingerprint": key.Fingerprint,
+		}
+		for fileName, content := range files {
+			path := filepath.Join(outputDir, fileName)
+			flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			if !force {
+				flags |= os.O_EXCL
+			}
+			file, err := os.OpenFile(path, flags, 0644)
+			if err == nil {
+				_, err = file.WriteString(content)
+				file.Close()
+			}
+			if err != nil {
+				entry["error"] = err.Error()
+				continue
+			}
+			if strings.HasSuffix(fileName, "-cert.pub") {
+				entry["certificateFile"] = path
+			} else {
+				entry["file"] = path
+			}
+		}
+		output = append(output, entry)
+	}
+
+	outputJSON, _ := json.Marshal(output)
+	fmt.Println(string(outputJSON))
+}
+
+func init() {
+	sshCmd.AddCommand(exportSSHCmd)
+	exportSSHCmd.PersistentFlags().String("format", "authorized_keys", "authorized_keys, allowed_signers, pubkey or ssh_config")
+	exportSSHCmd.PersistentFlags().String("folder", "", "only export keys in this folder (name or id)")
+	exportSSHCmd.PersistentFlags().String("collection", "", "only export keys in this collection (name or id)")
+	exportSSHCmd.PersistentFlags().String("options", "", "authorized_keys options, e.g. no-agent-forwarding,from=\"10.0.0.0/8\"")
+	exportSSHCmd.PersistentFlags().String("principal", "", "allowed_signers principals (comma separated), the key name if empty")
+	exportSSHCmd.PersistentFlags().String("namespaces", "git", "allowed_signers namespaces")
+	exportSSHCmd.PersistentFlags().String("output-dir", "", "directory for the pubkey format, and of the IdentityFile paths of the ssh_config format")
+	exportSSHCmd.PersistentFlags().Bool("force", false, "overwrite existing files")
+}
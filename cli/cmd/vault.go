@@ -113,7 +113,11 @@ var statusCmd = &cobra.Command{
 			response["locked"] = status.Locked
 			response["loginEntries"] = status.NumberOfLogins
 			response["noteEntries"] = status.NumberOfNotes
+			response["cardEntries"] = status.NumberOfCards
+			response["identityEntries"] = status.NumberOfIdentities
+			response["sshKeyEntries"] = status.NumberOfSSHKeys
 			response["lastSynced"] = time.Unix(status.LastSynced, 0).String()
+			response["loadedFromCache"] = status.LoadedFromCache
 			response["websocketConnected"] = status.WebsocketConnected
 			response["pinSet"] = status.PinSet
 			response["loggedIn"] = status.LoggedIn
@@ -125,10 +129,73 @@ var statusCmd = &cobra.Command{
 	},
 }
 
+var foldersCmd = &cobra.Command{
+	Use:   "folders",
+	Short: "Lists the folders in your vault",
+	Long:  `Lists the folders in your vault.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commandClient.SendToAgent(messages.ListFoldersRequest{})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch result.(type) {
+		case messages.ListFoldersResponse:
+			folders := make([]map[string]string, 0)
+			for _, folder := range result.(messages.ListFoldersResponse).Folders {
+				folders = append(folders, map[string]string{
+					"uuid": folder.ID,
+					"name": folder.Name,
+				})
+			}
+			responseJSON, _ := json.Marshal(folders)
+			fmt.Println(string(responseJSON))
+		case messages.ActionResponse:
+			fmt.Println("Error: " + result.(messages.ActionResponse).Message)
+		default:
+			fmt.Println("Wrong response type")
+		}
+	},
+}
+
+var collectionsCmd = &cobra.Command{
+	Use:   "collections",
+	Short: "Lists the organization collections in your vault",
+	Long:  `Lists the organization collections in your vault.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := commandClient.SendToAgent(messages.ListCollectionsRequest{})
+		if err != nil {
+			handleSendToAgentError(err)
+			return
+		}
+
+		switch result.(type) {
+		case messages.ListCollectionsResponse:
+			collections := make([]map[string]string, 0)
+			for _, collection := range result.(messages.ListCollectionsResponse).Collections {
+				collections = append(collections, map[string]string{
+					"uuid":           collection.ID,
+					"organizationId": collection.OrganizationID,
+					"name":           collection.Name,
+				})
+			}
+			responseJSON, _ := json.Marshal(collections)
+			fmt.Println(string(responseJSON))
+		case messages.ActionResponse:
+			fmt.Println("Error: " + result.(messages.ActionResponse).Message)
+		default:
+			fmt.Println("Wrong response type")
+		}
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(vaultCmd)
 	vaultCmd.AddCommand(unlockCmd)
 	vaultCmd.AddCommand(lockCmd)
 	vaultCmd.AddCommand(purgeCmd)
 	vaultCmd.AddCommand(statusCmd)
+	vaultCmd.AddCommand(foldersCmd)
+	vaultCmd.AddCommand(collectionsCmd)
 }
@@ -0,0 +1,127 @@
+package ipc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+)
+
+// Framed protocol: every frame is a 4 byte big endian length followed by a json encoded Frame.
+// The first frame on a connection is a ProtocolHandshakeRequest. Clients of the legacy protocol
+// send bare json objects instead, which is how the agent tells both apart.
+const (
+	ProtocolVersion = 2
+	MaxFrameSize    = 64 * 1024 * 1024
+)
+
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// Frame carries a request or, if Reply is set, the response to the request with the same ID
+// sent by the other side. Both sides number their own requests. Requests are handled by the
+// given account, or by the default account if it is empty.
+type Frame struct {
+	ID      uint64               `json:"id"`
+	Reply   bool                 `json:"reply,omitempty"`
+	Account string               `json:"account,omitempty"`
+	Message *messages.IPCMessage `json:"message,omitempty"`
+	Error   *messages.IPCError   `json:"error,omitempty"`
+}
+
+func RequestFrame(id uint64, payload interface{}) (Frame, error) {
+	message, err := messages.IPCMessageFromPayload(payload)
+	if err != nil {
+		return Frame{}, err
+	}
+	return Frame{ID: id, Message: &message}, nil
+}
+
+func ReplyFrame(id uint64, message messages.IPCMessage) Frame {
+	return Frame{
+		ID:      id,
+		Reply:   true,
+		Message: &message,
+		Error:   messages.ErrorForPayload(messages.ParsePayload(message)),
+	}
+}
+
+// ErrorFrame replies with an error. A failed ActionResponse is included so that callers which only
+// look at the payload keep working.
+func ErrorFrame(id uint64, code messages.ErrorCode, errorMessage string) Frame {
+	frame := Frame{
+		ID:    id,
+		Reply: true,
+		Error: &messages.IPCError{Code: code, Message: errorMessage},
+	}
+	message, err := messages.IPCMessageFromPayload(messages.ActionResponse{
+		Success: false,
+		Message: errorMessage,
+		Code:    code,
+	})
+	if err == nil {
+		frame.Message = &message
+	}
+	return frame
+}
+
+// Payload returns the parsed payload of a reply, or its error if it carries no payload.
+func (frame Frame) Payload() (interface{}, error) {
+	if frame.Message != nil {
+		return messages.ParsePayload(*frame.Message), nil
+	}
+	if frame.Error != nil {
+		return nil, frame.Error
+	}
+	return nil, errors.New("empty frame")
+}
+
+func WriteFrame(w io.Writer, frame Frame) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	_, err = w.Write(buf)
+	return err
+}
+
+func ReadFrame(r io.Reader) (Frame, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Frame{}, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxFrameSize {
+		return Frame{}, ErrFrameTooLarge
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return Frame{}, err
+	}
+
+	var frame Frame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return Frame{}, fmt.Errorf("invalid frame: %w", err)
+	}
+	return frame, nil
+}
+
+// IsLegacyMessage reports whether the first byte sent on a connection belongs to the legacy
+// protocol. Length prefixes are bounded by MaxFrameSize and never start with '{'.
+func IsLegacyMessage(firstByte byte) bool {
+	return firstByte == '{'
+}
@@ -0,0 +1,133 @@
+package ipc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/quexten/goldwarden/cli/ipc/messages"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	request, err := RequestFrame(7, messages.GetLoginRequest{UUID: "cipher"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Account = "work"
+
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, request); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFrame(&buf, ErrorFrame(7, messages.ErrorCodeLocked, "vault is locked")); err != nil {
+		t.Fatal(err)
+	}
+
+	frame, err := ReadFrame(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.ID != 7 || frame.Reply || frame.Account != "work" {
+		t.Fatalf("unexpected frame %+v", frame)
+	}
+	payload, err := frame.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req, ok := payload.(messages.GetLoginRequest); !ok || req.UUID != "cipher" {
+		t.Fatalf("unexpected payload %+v", payload)
+	}
+
+	reply, err := ReadFrame(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reply.Reply || reply.Error == nil || reply.Error.Code != messages.ErrorCodeLocked {
+		t.Fatalf("unexpected reply %+v", reply)
+	}
+	payload, err = reply.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response, ok := payload.(messages.ActionResponse); !ok || response.Success || response.Code != messages.ErrorCodeLocked {
+		t.Fatalf("unexpected reply payload %+v", payload)
+	}
+
+	if _, err := ReadFrame(&buf); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF after the last frame, got %v", err)
+	}
+}
+
+func TestReadFrameTooLarge(t *testing.T) {
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], MaxFrameSize+1)
+	if _, err := ReadFrame(bytes.NewReader(header[:])); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+	}
+}
+
+func TestWriteFrameTooLarge(t *testing.T) {
+	message := messages.IPCMessage{Payload: make([]byte, MaxFrameSize)}
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, Frame{Message: &message}); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatal("oversized frame was written")
+	}
+}
+
+func TestReadFrameShortRead(t *testing.T) {
+	frame, err := RequestFrame(1, messages.GetLoginRequest{UUID: "cipher"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, frame); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	if _, err := ReadFrame(bytes.NewReader(data[:2])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("truncated header: expected ErrUnexpectedEOF, got %v", err)
+	}
+	if _, err := ReadFrame(bytes.NewReader(data[:4])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("missing body: expected ErrUnexpectedEOF, got %v", err)
+	}
+	if _, err := ReadFrame(bytes.NewReader(data[:len(data)-1])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("truncated body: expected ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestReadFrameInvalidJSON(t *testing.T) {
+	body := []byte("{not json")
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(len(body)))
+	buf.Write(body)
+
+	if _, err := ReadFrame(&buf); err == nil {
+		t.Fatal("expected invalid frame error")
+	}
+}
+
+func TestValidatePayload(t *testing.T) {
+	frame, err := RequestFrame(1, messages.GetLoginRequest{UUID: "cipher"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := messages.ValidatePayload(*frame.Message); err != nil {
+		t.Fatalf("valid payload rejected: %v", err)
+	}
+
+	malformed := messages.IPCMessage{Type: frame.Message.Type, Payload: []byte("{")}
+	if err := messages.ValidatePayload(malformed); err == nil {
+		t.Fatal("expected malformed payload to be rejected")
+	}
+
+	unknown := messages.IPCMessage{Type: 1, Payload: []byte("{}")}
+	if err := messages.ValidatePayload(unknown); err == nil {
+		t.Fatal("expected unregistered message type to be rejected")
+	}
+}
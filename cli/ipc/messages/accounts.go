@@ -0,0 +1,63 @@
+package messages
+
+import "encoding/json"
+
+type Account struct {
+	Name     string
+	LoggedIn bool
+	Locked   bool
+	ApiUrl   string
+}
+
+type ListAccountsRequest struct {
+}
+
+type ListAccountsResponse struct {
+	Accounts []Account
+}
+
+type AddAccountRequest struct {
+	Name string
+}
+
+type RemoveAccountRequest struct {
+	Name string
+}
+
+func init() {
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ListAccountsRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ListAccountsRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ListAccountsResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ListAccountsResponse{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req AddAccountRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, AddAccountRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req RemoveAccountRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, RemoveAccountRequest{})
+}
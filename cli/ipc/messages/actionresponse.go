@@ -5,6 +5,7 @@ import "encoding/json"
 type ActionResponse struct {
 	Success bool
 	Message string
+	Code    ErrorCode `json:",omitempty"`
 }
 
 func init() {
@@ -0,0 +1,76 @@
+package messages
+
+import "encoding/json"
+
+type AuditRecord struct {
+	Sequence               uint64
+	Time                   int64
+	Action                 string
+	CipherID               string
+	Detail                 string
+	Decision               string
+	Method                 string
+	UserName               string
+	ProcessName            string
+	ProcessPath            string
+	ParentProcessName      string
+	GrandParentProcessName string
+	ProcessPid             int
+	Hash                   string
+}
+
+type ListAuditLogRequest struct {
+	Action string
+	Limit  int
+}
+
+type ListAuditLogResponse struct {
+	Records []AuditRecord
+}
+
+type VerifyAuditLogRequest struct {
+}
+
+type VerifyAuditLogResponse struct {
+	Valid   bool
+	Records int
+	Message string
+}
+
+func init() {
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ListAuditLogRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ListAuditLogRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ListAuditLogResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ListAuditLogResponse{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req VerifyAuditLogRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, VerifyAuditLogRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req VerifyAuditLogResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, VerifyAuditLogResponse{})
+}
@@ -0,0 +1,73 @@
+package messages
+
+import "encoding/json"
+
+type GetCardRequest struct {
+	Name  string
+	UUID  string
+	OrgId string
+}
+
+type GetCardResponse struct {
+	Found  bool
+	Result DecryptedCardCipher
+}
+
+type ListCardsRequest struct {
+}
+
+type GetCardsResponse struct {
+	Found  bool
+	Result []DecryptedCardCipher
+}
+
+type DecryptedCardCipher struct {
+	Name           string
+	UUID           string
+	OrganizationID string
+	CardholderName string
+	Brand          string
+	Number         string
+	ExpMonth       string
+	ExpYear        string
+	Code           string
+	Notes          string
+}
+
+func init() {
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req GetCardRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, GetCardRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req GetCardResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, GetCardResponse{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ListCardsRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ListCardsRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req GetCardsResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, GetCardsResponse{})
+}
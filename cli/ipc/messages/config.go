@@ -48,6 +48,24 @@ type GetRuntimeConfigResponse struct {
 	GoldwardenSocketPath string
 }
 
+type HTTPSettings struct {
+	CABundle          string
+	ClientCertificate string
+	ClientKey         string
+	Proxy             string
+	Retries           int
+}
+
+type GetHTTPSettingsRequest struct{}
+
+type GetHTTPSettingsResponse struct {
+	Settings HTTPSettings
+}
+
+type SetHTTPSettingsRequest struct {
+	Settings HTTPSettings
+}
+
 func init() {
 	registerPayloadParser(func(payload []byte) (interface{}, error) {
 		var req SetApiURLRequest
@@ -143,4 +161,31 @@ func init() {
 		}
 		return req, nil
 	}, GetConfigEnvironmentResponse{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req GetHTTPSettingsRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, GetHTTPSettingsRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req GetHTTPSettingsResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, GetHTTPSettingsResponse{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req SetHTTPSettingsRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, SetHTTPSettingsRequest{})
 }
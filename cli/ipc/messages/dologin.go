@@ -6,6 +6,8 @@ type DoLoginRequest struct {
 	Email        string `json:"email"`
 	Password     string `json:"password"`
 	Passwordless bool   `json:"passwordless"`
+	// two-factor method to use, asked for if empty and the account has several
+	TwoFactorMethod string `json:"twoFactorMethod"`
 }
 
 func init() {
@@ -0,0 +1,45 @@
+package messages
+
+type ErrorCode string
+
+const (
+	ErrorCodeFailed             ErrorCode = "failed"
+	ErrorCodeInternal           ErrorCode = "internal"
+	ErrorCodeInvalidMessage     ErrorCode = "invalid_message"
+	ErrorCodeUnknownAction      ErrorCode = "unknown_action"
+	ErrorCodeUnsupportedVersion ErrorCode = "unsupported_version"
+	ErrorCodeNotLoggedIn        ErrorCode = "not_logged_in"
+	ErrorCodeLocked             ErrorCode = "locked"
+	ErrorCodeNotApproved        ErrorCode = "not_approved"
+	ErrorCodeNotFound           ErrorCode = "not_found"
+)
+
+// IPCError is the structured error attached to framed responses.
+type IPCError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+func (err *IPCError) Error() string {
+	if err.Message == "" {
+		return string(err.Code)
+	}
+	return string(err.Code) + ": " + err.Message
+}
+
+// ErrorForPayload returns the error describing a failed ActionResponse, or nil for any other payload.
+func ErrorForPayload(payload interface{}) *IPCError {
+	response, ok := payload.(ActionResponse)
+	if !ok || response.Success {
+		return nil
+	}
+
+	code := response.Code
+	if code == "" {
+		code = ErrorCodeFailed
+	}
+	return &IPCError{
+		Code:    code,
+		Message: response.Message,
+	}
+}
@@ -0,0 +1,50 @@
+package messages
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type SubscribeEventsRequest struct {
+	// empty for all event types
+	Types []string
+}
+
+type SubscribeEventsResponse struct {
+	Success bool
+}
+
+type AgentEvent struct {
+	Type string
+	Time time.Time
+	Data map[string]string
+}
+
+func init() {
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req SubscribeEventsRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, SubscribeEventsRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req SubscribeEventsResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, SubscribeEventsResponse{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req AgentEvent
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, AgentEvent{})
+}
@@ -0,0 +1,66 @@
+package messages
+
+import "encoding/json"
+
+type Folder struct {
+	ID   string
+	Name string
+}
+
+type Collection struct {
+	ID             string
+	OrganizationID string
+	Name           string
+}
+
+type ListFoldersRequest struct {
+}
+
+type ListFoldersResponse struct {
+	Folders []Folder
+}
+
+type ListCollectionsRequest struct {
+}
+
+type ListCollectionsResponse struct {
+	Collections []Collection
+}
+
+func init() {
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ListFoldersRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ListFoldersRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ListFoldersResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ListFoldersResponse{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ListCollectionsRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ListCollectionsRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ListCollectionsResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ListCollectionsResponse{})
+}
@@ -4,6 +4,8 @@ import "encoding/json"
 
 type GetCLICredentialsRequest struct {
 	ApplicationName string
+	Folder          string
+	Collection      string
 }
 
 type GetCLICredentialsResponse struct {
@@ -0,0 +1,88 @@
+package messages
+
+import "encoding/json"
+
+type GetIdentityRequest struct {
+	Name  string
+	UUID  string
+	OrgId string
+}
+
+type GetIdentityResponse struct {
+	Found  bool
+	Result DecryptedIdentityCipher
+}
+
+type ListIdentitiesRequest struct {
+}
+
+type GetIdentitiesResponse struct {
+	Found  bool
+	Result []DecryptedIdentityCipher
+}
+
+type DecryptedIdentityCipher struct {
+	Name           string
+	UUID           string
+	OrganizationID string
+	Notes          string
+
+	Title      string
+	FirstName  string
+	MiddleName string
+	LastName   string
+
+	Username       string
+	Company        string
+	SSN            string
+	PassportNumber string
+	LicenseNumber  string
+
+	Email      string
+	Phone      string
+	Address1   string
+	Address2   string
+	Address3   string
+	City       string
+	State      string
+	PostalCode string
+	Country    string
+}
+
+func init() {
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req GetIdentityRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, GetIdentityRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req GetIdentityResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, GetIdentityResponse{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ListIdentitiesRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ListIdentitiesRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req GetIdentitiesResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, GetIdentitiesResponse{})
+}
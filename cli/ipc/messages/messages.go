@@ -3,6 +3,7 @@ package messages
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"hash/fnv"
 	"reflect"
 
@@ -50,6 +51,24 @@ func ParsePayload(message IPCMessage) interface{} {
 	}
 }
 
+// ValidatePayload reports whether the payload of a registered message type can be parsed.
+// The parsers panic on malformed payloads, so messages read from a connection are checked
+// before they are handled.
+func ValidatePayload(message IPCMessage) (err error) {
+	typeName, ok := messageTypes[message.Type]
+	if !ok {
+		return fmt.Errorf("unregistered message type %d", int64(message.Type))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid %s payload: %v", typeName, r)
+		}
+	}()
+	_, err = messages[typeName](message.Payload)
+	return err
+}
+
 func IPCMessageFromPayload(payload interface{}) (IPCMessage, error) {
 	payloadTypeName := reflect.TypeOf(payload).Name()
 	if _, ok := messages[payloadTypeName]; !ok {
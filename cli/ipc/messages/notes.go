@@ -28,21 +28,75 @@ type DecryptedLoginCipher struct {
 	UUID          string
 	OrgaizationID string
 	Notes         string
-	TOTPSeed      string
+	HasTOTP       bool
 	URI           string
+	URIs          []string
+	Fields        []LoginField
+}
+
+type LoginField struct {
+	Name   string
+	Value  string
+	Hidden bool
 }
 
 type AddLoginRequest struct {
+	Name          string
+	Username      string
+	Password      string
+	URIs          []string
+	TOTP          string
+	Notes         string
+	Fields        []LoginField
+	OrgId         string
+	CollectionIDs []string
+}
+
+type AddLoginResponse struct {
 	Name string
 	UUID string
 }
 
-type AddLoginResponse struct {
+// EditLoginRequest only changes the fields that are set, URIs and Fields replace the existing lists.
+type EditLoginRequest struct {
+	UUID       string
+	LookupName string
+	Name       *string
+	Username   *string
+	Password   *string
+	URIs       *[]string
+	TOTP       *string
+	Notes      *string
+	Fields     *[]LoginField
+}
+
+type EditLoginResponse struct {
 	Name string
 	UUID string
 }
 
+type DeleteLoginRequest struct {
+	UUID      string
+	Name      string
+	Permanent bool
+}
+
+type GetTOTPRequest struct {
+	Name     string
+	Username string
+	UUID     string
+	OrgId    string
+}
+
+type GetTOTPResponse struct {
+	Code             string
+	Period           int
+	SecondsRemaining int
+}
+
 type ListLoginsRequest struct {
+	Folder     string
+	Collection string
 }
 
 func init() {
@@ -99,4 +153,49 @@ func init() {
 		}
 		return req, nil
 	}, ListLoginsRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req EditLoginRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, EditLoginRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req EditLoginResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, EditLoginResponse{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req DeleteLoginRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, DeleteLoginRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req GetTOTPRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, GetTOTPRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req GetTOTPResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, GetTOTPResponse{})
 }
@@ -0,0 +1,53 @@
+package messages
+
+import "encoding/json"
+
+type ReloadPolicyRequest struct {
+}
+
+type CheckPolicyRequest struct {
+	Action         string
+	ExecutablePath string
+	Ancestry       []string
+	Cipher         string
+	Folder         string
+	Key            string
+	Forwarded      bool
+	RemoteHost     string
+}
+
+type CheckPolicyResponse struct {
+	Decision  string
+	RuleIndex int
+	RuleName  string
+	TTL       string
+}
+
+func init() {
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ReloadPolicyRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ReloadPolicyRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req CheckPolicyRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, CheckPolicyRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req CheckPolicyResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, CheckPolicyResponse{})
+}
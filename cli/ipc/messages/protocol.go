@@ -0,0 +1,31 @@
+package messages
+
+import "encoding/json"
+
+type ProtocolHandshakeRequest struct {
+	Version int
+}
+
+type ProtocolHandshakeResponse struct {
+	Version int
+}
+
+func init() {
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ProtocolHandshakeRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ProtocolHandshakeRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ProtocolHandshakeResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ProtocolHandshakeResponse{})
+}
@@ -4,6 +4,8 @@ import "encoding/json"
 
 type CreateSSHKeyRequest struct {
 	Name string
+	// one of ed25519, ecdsa-p256, ecdsa-p384, rsa-3072 and rsa-4096, ed25519 if empty
+	Type string
 }
 
 type CreateSSHKeyResponse struct {
@@ -11,6 +13,8 @@ type CreateSSHKeyResponse struct {
 }
 
 type GetSSHKeysRequest struct {
+	Folder     string
+	Collection string
 }
 
 type GetSSHKeysResponse struct {
@@ -27,6 +31,85 @@ type ImportSSHKeyResponse struct {
 	ErrorMsg string
 }
 
+type ExportSSHKeysRequest struct {
+	Folder     string
+	Collection string
+}
+
+type SSHPublicKey struct {
+	UUID string
+	Name string
+	// as shown by ssh-keygen -l, e.g. ED25519
+	Type        string
+	Bits        int
+	PublicKey   string
+	Fingerprint string
+	Certificate string
+	GitEmails   []string
+	// host names and SHA256 host key fingerprints the key may be used for
+	AllowedHosts []string
+}
+
+type ExportSSHKeysResponse struct {
+	Keys []SSHPublicKey
+}
+
+type MigrateSSHKeysRequest struct {
+	DryRun bool
+}
+
+type SSHKeyMigrationStatus string
+
+const (
+	SSHKeyMigrationMigrated SSHKeyMigrationStatus = "migrated"
+	// reported by dry runs
+	SSHKeyMigrationPending SSHKeyMigrationStatus = "pending"
+	SSHKeyMigrationSkipped SSHKeyMigrationStatus = "skipped"
+	SSHKeyMigrationFailed  SSHKeyMigrationStatus = "failed"
+)
+
+type SSHKeyMigrationResult struct {
+	UUID        string
+	Name        string
+	Fingerprint string
+	Status      SSHKeyMigrationStatus
+	Error       string
+}
+
+type MigrateSSHKeysResponse struct {
+	DryRun  bool
+	Results []SSHKeyMigrationResult
+}
+
+type SetSSHCertificateRequest struct {
+	UUID        string
+	Name        string
+	Certificate string
+}
+
+type SSHAgentProfile struct {
+	Name         string
+	SocketPath   string
+	Folders      []string
+	NamePatterns []string
+	Fields       []string
+}
+
+type ListSSHAgentProfilesRequest struct {
+}
+
+type ListSSHAgentProfilesResponse struct {
+	Profiles []SSHAgentProfile
+}
+
+type SetSSHAgentProfileRequest struct {
+	Profile SSHAgentProfile
+}
+
+type RemoveSSHAgentProfileRequest struct {
+	Name string
+}
+
 func init() {
 	registerPayloadParser(func(payload []byte) (interface{}, error) {
 		var req CreateSSHKeyRequest
@@ -81,4 +164,85 @@ func init() {
 		}
 		return req, nil
 	}, ImportSSHKeyResponse{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req SetSSHCertificateRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, SetSSHCertificateRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req MigrateSSHKeysRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, MigrateSSHKeysRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req MigrateSSHKeysResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, MigrateSSHKeysResponse{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ExportSSHKeysRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ExportSSHKeysRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ExportSSHKeysResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ExportSSHKeysResponse{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ListSSHAgentProfilesRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ListSSHAgentProfilesRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req ListSSHAgentProfilesResponse
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, ListSSHAgentProfilesResponse{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req SetSSHAgentProfileRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, SetSSHAgentProfileRequest{})
+
+	registerPayloadParser(func(payload []byte) (interface{}, error) {
+		var req RemoveSSHAgentProfileRequest
+		err := json.Unmarshal(payload, &req)
+		if err != nil {
+			panic("Unmarshal: " + err.Error())
+		}
+		return req, nil
+	}, RemoveSSHAgentProfileRequest{})
 }
@@ -26,7 +26,11 @@ type VaultStatusResponse struct {
 	PinSet             bool
 	NumberOfLogins     int
 	NumberOfNotes      int
+	NumberOfCards      int
+	NumberOfIdentities int
+	NumberOfSSHKeys    int
 	LastSynced         int64
+	LoadedFromCache    bool
 	WebsocketConnected bool
 }
 
@@ -11,7 +11,6 @@ from threading import Thread
 from .resource_loader import load_template
 import sys
 import os
-from ..services import totp
 
 class GoldwardenQuickAccessApp(Adw.Application):
     def __init__(self, **kwargs):
@@ -73,12 +72,15 @@ class GoldwardenQuickAccessApp(Adw.Application):
 
         # totp code
         if keyval == Gdk.KEY_t or keyval == Gdk.KEY_T:
-            if self.filtered_logins[self.selected_index]["totp"] == "":
+            if self.filtered_logins[self.selected_index].get("hasTotp") != "true":
+                return
+            code = goldwarden.get_totp_code(self.filtered_logins[self.selected_index]["uuid"])
+            if code == None:
                 return
             if auto_type_combo:
-                self.run_autotype(totp.totp(self.filtered_logins[self.selected_index]["totp"]))
+                self.run_autotype(code)
             if copy_combo:
-                self.set_clipboard(totp.totp(self.filtered_logins[self.selected_index]["totp"]))
+                self.set_clipboard(code)
 
         if keyval == Gdk.KEY_u or keyval == Gdk.KEY_U:
             if auto_type_combo:
@@ -180,10 +182,7 @@ class GoldwardenQuickAccessApp(Adw.Application):
                 action_row.uuid = i["uuid"]
             else:
                 action_row.uuid = "[no uuid]"
-            if "totp" in i:
-                action_row.totp = i["totp"]
-            else:
-                action_row.totp = ""
+            action_row.has_totp = i.get("hasTotp") == "true"
             action_row.set_icon_name("dialog-password")
             action_row.set_activatable(True)
             self.results_list.append(action_row)
@@ -130,6 +130,12 @@ def get_vault_logins():
     except Exception as e:
         return None
 
+def get_totp_code(uuid):
+    result = send_authenticated_command(f"logins totp --uuid {uuid}").strip()
+    if result == "" or result.startswith("Error"):
+        return None
+    return result
+
 def get_runtime_config():
     result = send_authenticated_command(f"config get-runtime-config")
     try:
@@ -32,6 +32,7 @@ func main() {
 		SSHAgentSocketPath:   os.Getenv("GOLDWARDEN_SSH_AUTH_SOCK"),
 		GoldwardenSocketPath: os.Getenv("GOLDWARDEN_SOCKET_PATH"),
 		DaemonAuthToken:      os.Getenv("GOLDWARDEN_DAEMON_AUTH_TOKEN"),
+		Account:              os.Getenv("GOLDWARDEN_ACCOUNT"),
 
 		ConfigDirectory: configPath,
 	}